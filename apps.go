@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	netURL "net/url"
 )
@@ -44,9 +45,13 @@ type AppsService interface {
 	CreateDeployment(ctx context.Context, appID string, create ...*DeploymentCreateRequest) (*Deployment, *Response, error)
 
 	GetLogs(ctx context.Context, appID, deploymentID, component string, logType AppLogType, follow bool, tailLines int) (*AppLogs, *Response, error)
+	StreamLogs(ctx context.Context, appID, deploymentID, component string, opts *StreamLogsOptions) (*AppLogStream, error)
+	FetchHistoricLogs(ctx context.Context, logs *AppLogs) (io.ReadCloser, error)
 	// Deprecated: Use GetExecWithOpts instead.
 	GetExec(ctx context.Context, appID, deploymentID, component string) (*AppExec, *Response, error)
 	GetExecWithOpts(ctx context.Context, appID, componentName string, opts *AppGetExecOptions) (*AppExec, *Response, error)
+	Exec(ctx context.Context, appID, component string, opts *AppGetExecOptions) (*AppExecSession, error)
+	RunCommand(ctx context.Context, appID, component, cmd string) (stdout string, stderr string, exitCode int, err error)
 
 	ListRegions(ctx context.Context) ([]*AppRegion, *Response, error)
 
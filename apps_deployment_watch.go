@@ -0,0 +1,231 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDeploymentPollInterval = 5 * time.Second
+
+	// deploymentPollFailures is the number of consecutive polling errors
+	// tolerated before WatchDeployment gives up.
+	deploymentPollFailures = 3
+)
+
+// DeploymentEventType is the type of a DeploymentEvent.
+type DeploymentEventType string
+
+const (
+	// DeploymentEventPhase is emitted when the deployment phase changes.
+	DeploymentEventPhase DeploymentEventType = "phase"
+	// DeploymentEventStep is emitted when the status of a progress step changes.
+	DeploymentEventStep DeploymentEventType = "step"
+)
+
+// DeploymentEvent describes a change observed while watching a deployment.
+type DeploymentEvent struct {
+	Type DeploymentEventType
+	// Deployment is the deployment as of the poll that observed the change.
+	Deployment *Deployment
+
+	// PreviousPhase is the phase before a DeploymentEventPhase change. It is
+	// empty for the first poll.
+	PreviousPhase DeploymentPhase
+
+	// Step is the step whose status changed for a DeploymentEventStep.
+	Step *DeploymentProgressStep
+	// Path holds the names of the step's ancestors followed by its own name.
+	Path []string
+	// PreviousStatus is the step's status before the change. It is empty
+	// when the step is seen for the first time.
+	PreviousStatus DeploymentProgressStepStatus
+}
+
+// StepPath returns the step path joined with "/".
+func (e *DeploymentEvent) StepPath() string {
+	return strings.Join(e.Path, "/")
+}
+
+// WatchDeploymentOptions configures WatchDeployment.
+type WatchDeploymentOptions struct {
+	// PollInterval is the delay between polls. Defaults to five seconds.
+	PollInterval time.Duration
+}
+
+// IsDeploymentPhaseTerminal reports whether a deployment in the given phase
+// will not make further progress.
+func IsDeploymentPhaseTerminal(phase DeploymentPhase) bool {
+	switch phase {
+	case DeploymentPhase_Active, DeploymentPhase_Error, DeploymentPhase_Canceled, DeploymentPhase_Superseded:
+		return true
+	}
+	return false
+}
+
+// WatchDeployment polls a deployment until it reaches a terminal phase
+// (ACTIVE, ERROR, CANCELED or SUPERSEDED) and returns it. fn, if not nil, is
+// called for each phase change and each progress step status change, in
+// order; an error returned by fn stops the watch and is returned.
+//
+// The deployment is returned with a nil error whatever its terminal phase;
+// callers should inspect Phase to find out whether it succeeded.
+func WatchDeployment(ctx context.Context, client *Client, appID, deploymentID string, opts *WatchDeploymentOptions, fn func(*DeploymentEvent) error) (*Deployment, error) {
+	interval := defaultDeploymentPollInterval
+	if opts != nil && opts.PollInterval > 0 {
+		interval = opts.PollInterval
+	}
+	if fn == nil {
+		fn = func(*DeploymentEvent) error { return nil }
+	}
+
+	var (
+		phase     DeploymentPhase
+		statuses  = make(map[string]DeploymentProgressStepStatus)
+		failCount = 0
+	)
+	for {
+		deployment, _, err := client.Apps.GetDeployment(ctx, appID, deploymentID)
+		if err != nil {
+			if ctx.Err() != nil || failCount >= deploymentPollFailures {
+				return nil, err
+			}
+			failCount++
+		} else {
+			failCount = 0
+
+			if deployment.Phase != phase {
+				if err := fn(&DeploymentEvent{
+					Type:          DeploymentEventPhase,
+					Deployment:    deployment,
+					PreviousPhase: phase,
+				}); err != nil {
+					return deployment, err
+				}
+				phase = deployment.Phase
+			}
+
+			var stepErr error
+			walkDeploymentSteps(deployment.Progress, func(path []string, step *DeploymentProgressStep) bool {
+				key := strings.Join(path, "/")
+				prev, seen := statuses[key]
+				if seen && prev == step.Status {
+					return true
+				}
+				statuses[key] = step.Status
+				stepErr = fn(&DeploymentEvent{
+					Type:           DeploymentEventStep,
+					Deployment:     deployment,
+					Step:           step,
+					Path:           append([]string(nil), path...),
+					PreviousStatus: prev,
+				})
+				return stepErr == nil
+			})
+			if stepErr != nil {
+				return deployment, stepErr
+			}
+
+			if IsDeploymentPhaseTerminal(deployment.Phase) {
+				return deployment, nil
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// walkDeploymentSteps calls fn for every step of the progress tree in
+// depth-first order until fn returns false.
+func walkDeploymentSteps(p *DeploymentProgress, fn func(path []string, step *DeploymentProgressStep) bool) {
+	if p == nil {
+		return
+	}
+	var walk func(path []string, steps []*DeploymentProgressStep) bool
+	walk = func(path []string, steps []*DeploymentProgressStep) bool {
+		for _, step := range steps {
+			stepPath := append(path[:len(path):len(path)], step.Name)
+			if !fn(stepPath, step) || !walk(stepPath, step.Steps) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(nil, p.Steps)
+}
+
+// RenderDeploymentProgress writes the progress step tree of a deployment as
+// indented plain text, one step per line, with the status, the time spent in
+// the step and the failure reason, if any. Steps that are still running are
+// timed up to now. The output contains no terminal control sequences, so it
+// is suitable for CI logs.
+func RenderDeploymentProgress(w io.Writer, p *DeploymentProgress, now time.Time) error {
+	if p == nil {
+		return nil
+	}
+	var err error
+	walkDeploymentSteps(p, func(path []string, step *DeploymentProgressStep) bool {
+		var b strings.Builder
+		b.WriteString(strings.Repeat("  ", len(path)-1))
+		fmt.Fprintf(&b, "[%s] %s", deploymentStepStatusLabel(step.Status), deploymentStepTitle(step))
+		if d := deploymentStepDuration(step, now); d > 0 {
+			fmt.Fprintf(&b, " (%s)", d)
+		}
+		if r := step.Reason; r != nil && (r.Code != "" || r.Message != "") {
+			b.WriteString(": ")
+			if r.Code != "" {
+				b.WriteString(r.Code)
+				if r.Message != "" {
+					b.WriteString(": ")
+				}
+			}
+			b.WriteString(r.Message)
+		}
+		b.WriteByte('\n')
+		_, err = io.WriteString(w, b.String())
+		return err == nil
+	})
+	return err
+}
+
+func deploymentStepStatusLabel(s DeploymentProgressStepStatus) string {
+	switch s {
+	case DeploymentProgressStepStatus_Success:
+		return "ok"
+	case DeploymentProgressStepStatus_Error:
+		return "error"
+	case DeploymentProgressStepStatus_Running:
+		return "running"
+	case DeploymentProgressStepStatus_Pending:
+		return "pending"
+	}
+	return "unknown"
+}
+
+func deploymentStepTitle(step *DeploymentProgressStep) string {
+	if step.MessageBase != "" {
+		return strings.TrimSpace(step.MessageBase + " " + step.ComponentName)
+	}
+	return step.Name
+}
+
+func deploymentStepDuration(step *DeploymentProgressStep, now time.Time) time.Duration {
+	if step.StartedAt.IsZero() {
+		return 0
+	}
+	end := step.EndedAt
+	if end.IsZero() {
+		if step.Status != DeploymentProgressStepStatus_Running {
+			return 0
+		}
+		end = now
+	}
+	return end.Sub(step.StartedAt).Round(time.Second)
+}
@@ -0,0 +1,134 @@
+package godo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchDeployment(t *testing.T) {
+	setup()
+	defer teardown()
+
+	responses := []string{
+		`{"deployment": {"id": "dep", "phase": "BUILDING", "progress": {"steps": [
+			{"name": "build", "status": "RUNNING", "steps": [{"name": "web", "status": "RUNNING"}]},
+			{"name": "deploy", "status": "PENDING"}
+		]}}}`,
+		`{"deployment": {"id": "dep", "phase": "BUILDING", "progress": {"steps": [
+			{"name": "build", "status": "RUNNING", "steps": [{"name": "web", "status": "RUNNING"}]},
+			{"name": "deploy", "status": "PENDING"}
+		]}}}`,
+		`{"deployment": {"id": "dep", "phase": "ERROR", "progress": {"steps": [
+			{"name": "build", "status": "ERROR", "steps": [{"name": "web", "status": "ERROR", "reason": {"code": "BuildJobFailed", "message": "exit status 1"}}]},
+			{"name": "deploy", "status": "PENDING"}
+		]}}}`,
+	}
+	var polls int
+	mux.HandleFunc("/v2/apps/app-id/deployments/dep", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, responses[min(polls, len(responses)-1)])
+		polls++
+	})
+
+	var events []string
+	deployment, err := WatchDeployment(ctx, client, "app-id", "dep", &WatchDeploymentOptions{PollInterval: time.Millisecond}, func(e *DeploymentEvent) error {
+		switch e.Type {
+		case DeploymentEventPhase:
+			events = append(events, fmt.Sprintf("phase %s -> %s", e.PreviousPhase, e.Deployment.Phase))
+		case DeploymentEventStep:
+			event := fmt.Sprintf("step %s %s -> %s", e.StepPath(), e.PreviousStatus, e.Step.Status)
+			if e.Step.Reason != nil {
+				event += " " + e.Step.Reason.Code
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, DeploymentPhase_Error, deployment.Phase)
+	assert.Equal(t, 3, polls)
+	assert.Equal(t, []string{
+		"phase  -> BUILDING",
+		"step build  -> RUNNING",
+		"step build/web  -> RUNNING",
+		"step deploy  -> PENDING",
+		"phase BUILDING -> ERROR",
+		"step build RUNNING -> ERROR",
+		"step build/web RUNNING -> ERROR BuildJobFailed",
+	}, events)
+}
+
+func TestWatchDeployment_CallbackError(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/apps/app-id/deployments/dep", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"deployment": {"id": "dep", "phase": "BUILDING"}}`)
+	})
+
+	stop := errors.New("stop")
+	_, err := WatchDeployment(ctx, client, "app-id", "dep", nil, func(e *DeploymentEvent) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+}
+
+func TestWatchDeployment_PollErrors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var polls int
+	mux.HandleFunc("/v2/apps/app-id/deployments/dep", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := WatchDeployment(ctx, client, "app-id", "dep", &WatchDeploymentOptions{PollInterval: time.Millisecond}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, deploymentPollFailures+1, polls)
+}
+
+func TestRenderDeploymentProgress(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	progress := &DeploymentProgress{
+		Steps: []*DeploymentProgressStep{
+			{
+				Name:      "build",
+				Status:    DeploymentProgressStepStatus_Error,
+				StartedAt: start,
+				EndedAt:   start.Add(75 * time.Second),
+				Steps: []*DeploymentProgressStep{
+					{Name: "initialize", Status: DeploymentProgressStepStatus_Success, StartedAt: start, EndedAt: start.Add(3 * time.Second)},
+					{
+						Name:          "web",
+						MessageBase:   "Building service",
+						ComponentName: "web",
+						Status:        DeploymentProgressStepStatus_Error,
+						StartedAt:     start.Add(3 * time.Second),
+						EndedAt:       start.Add(75 * time.Second),
+						Reason:        &DeploymentProgressStepReason{Code: "BuildJobFailed", Message: "exit status 1"},
+					},
+				},
+			},
+			{Name: "migrate", Status: DeploymentProgressStepStatus_Running, StartedAt: start.Add(80 * time.Second)},
+			{Name: "deploy", Status: DeploymentProgressStepStatus_Pending},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, RenderDeploymentProgress(&buf, progress, start.Add(90*time.Second)))
+	expected := `[error] build (1m15s)
+  [ok] initialize (3s)
+  [error] Building service web (1m12s): BuildJobFailed: exit status 1
+[running] migrate (10s)
+[pending] deploy
+`
+	assert.Equal(t, expected, buf.String())
+}
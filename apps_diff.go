@@ -0,0 +1,587 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AppSpecChangeType is the kind of change reported by DiffAppSpecs.
+type AppSpecChangeType string
+
+const (
+	// AppSpecChangeAdded indicates a value only present in the desired spec.
+	AppSpecChangeAdded AppSpecChangeType = "added"
+	// AppSpecChangeRemoved indicates a value only present in the live spec.
+	AppSpecChangeRemoved AppSpecChangeType = "removed"
+	// AppSpecChangeModified indicates a value present in both specs that differs.
+	AppSpecChangeModified AppSpecChangeType = "modified"
+)
+
+// appSpecSecretMask replaces the values of SECRET environment variables in a diff.
+const appSpecSecretMask = "********"
+
+// AppSpecChange represents a single field-level change between two app specs.
+type AppSpecChange struct {
+	// Path is the dotted path of the field relative to its component (or the
+	// app for app-level changes), e.g. "envs.API_KEY" or "image.tag".
+	Path string `json:"path"`
+	// Type is the kind of change.
+	Type AppSpecChangeType `json:"type"`
+	// Old is the rendered live value. It is empty for additions.
+	Old string `json:"old,omitempty"`
+	// New is the rendered desired value. It is empty for removals.
+	New string `json:"new,omitempty"`
+}
+
+// AppComponentDiff represents the changes made to a single app component.
+type AppComponentDiff struct {
+	Name string           `json:"name"`
+	Type AppComponentType `json:"type"`
+	// Change is AppSpecChangeAdded or AppSpecChangeRemoved when the whole
+	// component is added or removed, and AppSpecChangeModified otherwise.
+	Change  AppSpecChangeType `json:"change"`
+	Changes []*AppSpecChange  `json:"changes,omitempty"`
+}
+
+// AppSpecDiff is the result of comparing a live app spec with a desired one.
+type AppSpecDiff struct {
+	// Changes lists app-level changes such as region, domains and shared envs.
+	Changes []*AppSpecChange `json:"changes,omitempty"`
+	// Components lists the components that were added, removed or modified.
+	Components []*AppComponentDiff `json:"components,omitempty"`
+}
+
+// HasChanges reports whether the diff contains any changes.
+func (d *AppSpecDiff) HasChanges() bool {
+	return d != nil && (len(d.Changes) > 0 || len(d.Components) > 0)
+}
+
+// String renders the diff in a human-readable form, one change per line.
+// Additions are prefixed with "+", removals with "-" and modifications with "~".
+func (d *AppSpecDiff) String() string {
+	if !d.HasChanges() {
+		return "no changes\n"
+	}
+
+	var b strings.Builder
+	if len(d.Changes) > 0 {
+		b.WriteString("app\n")
+		writeAppSpecChanges(&b, d.Changes)
+	}
+	for _, c := range d.Components {
+		fmt.Fprintf(&b, "%s %s %s\n", appSpecChangeSymbol(c.Change), c.Type, c.Name)
+		writeAppSpecChanges(&b, c.Changes)
+	}
+	return b.String()
+}
+
+func writeAppSpecChanges(b *strings.Builder, changes []*AppSpecChange) {
+	for _, c := range changes {
+		switch c.Type {
+		case AppSpecChangeAdded:
+			fmt.Fprintf(b, "  + %s: %s\n", c.Path, c.New)
+		case AppSpecChangeRemoved:
+			fmt.Fprintf(b, "  - %s: %s\n", c.Path, c.Old)
+		default:
+			fmt.Fprintf(b, "  ~ %s: %s -> %s\n", c.Path, c.Old, c.New)
+		}
+	}
+}
+
+func appSpecChangeSymbol(t AppSpecChangeType) string {
+	switch t {
+	case AppSpecChangeAdded:
+		return "+"
+	case AppSpecChangeRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// appSpecServerDefaults lists component fields, keyed by JSON name, that the
+// server fills in when they are omitted from a submitted spec. A zero desired
+// value for one of these fields is not reported as a change. A non-nil value
+// is the default the server applies, so that an explicit default matches an
+// omitted one.
+var appSpecServerDefaults = map[string]interface{}{
+	"environment_slug":   nil,
+	"instance_size_slug": nil,
+	"instance_count":     int64(1),
+	"http_port":          int64(8080),
+	"protocol":           nil,
+}
+
+// DiffAppSpecs compares the live spec of an app with a desired spec and
+// returns the field-level changes needed to go from live to desired.
+//
+// Components are matched by name and type. Environment variables are matched
+// by key and the values of SECRET variables are masked. A plaintext SECRET
+// can't be compared with the encrypted value returned by the API, so only its
+// scope and type are compared. Fields that the server populates with defaults
+// are ignored when they are omitted from the desired spec, so that diffing a
+// spec against the spec returned by the API after deployment is not noisy.
+func DiffAppSpecs(live, desired *AppSpec) *AppSpecDiff {
+	if live == nil {
+		live = &AppSpec{}
+	}
+	if desired == nil {
+		desired = &AppSpec{}
+	}
+
+	d := &AppSpecDiff{}
+	d.Changes = diffAppLevel(live, desired)
+
+	liveComponents := appSpecComponentsByKey(live)
+	desiredComponents := appSpecComponentsByKey(desired)
+
+	for _, key := range appSpecComponentKeys(live, desired) {
+		l, inLive := liveComponents[key]
+		n, inDesired := desiredComponents[key]
+		switch {
+		case inLive && !inDesired:
+			d.Components = append(d.Components, &AppComponentDiff{
+				Name: l.GetName(), Type: l.GetType(), Change: AppSpecChangeRemoved,
+			})
+		case !inLive && inDesired:
+			d.Components = append(d.Components, &AppComponentDiff{
+				Name: n.GetName(), Type: n.GetType(), Change: AppSpecChangeAdded,
+			})
+		default:
+			if changes := diffAppComponent(l, n); len(changes) > 0 {
+				d.Components = append(d.Components, &AppComponentDiff{
+					Name: n.GetName(), Type: n.GetType(), Change: AppSpecChangeModified, Changes: changes,
+				})
+			}
+		}
+	}
+
+	return d
+}
+
+func appSpecComponentKey(c AppComponentSpec) string {
+	return string(c.GetType()) + "/" + c.GetName()
+}
+
+func appSpecComponentsByKey(s *AppSpec) map[string]AppComponentSpec {
+	m := make(map[string]AppComponentSpec)
+	_ = s.ForEachAppComponentSpec(func(c AppComponentSpec) error {
+		m[appSpecComponentKey(c)] = c
+		return nil
+	})
+	return m
+}
+
+// appSpecComponentKeys returns the keys of the components in both specs,
+// in live order followed by any components only present in desired.
+func appSpecComponentKeys(live, desired *AppSpec) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	collect := func(c AppComponentSpec) error {
+		key := appSpecComponentKey(c)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		return nil
+	}
+	_ = live.ForEachAppComponentSpec(collect)
+	_ = desired.ForEachAppComponentSpec(collect)
+	return keys
+}
+
+func diffAppLevel(live, desired *AppSpec) []*AppSpecChange {
+	var changes []*AppSpecChange
+
+	changes = appendScalarChange(changes, "name", live.Name, desired.Name)
+	if desired.Region != "" {
+		changes = appendScalarChange(changes, "region", live.Region, desired.Region)
+	}
+	changes = append(changes, diffAppEnvs("envs", live.Envs, desired.Envs)...)
+	changes = append(changes, diffAppDomains(live.Domains, desired.Domains)...)
+	// The server derives ingress rules from component routes when they are
+	// omitted, so only compare them when the desired spec sets them.
+	if desired.Ingress != nil {
+		changes = append(changes, diffAppIngress(live.Ingress, desired.Ingress)...)
+	}
+	changes = appendJSONChange(changes, "alerts", live.Alerts, desired.Alerts)
+	changes = appendJSONChange(changes, "egress", live.Egress, desired.Egress)
+	changes = appendJSONChange(changes, "features", live.Features, desired.Features)
+	changes = appendJSONChange(changes, "maintenance", live.Maintenance, desired.Maintenance)
+	changes = appendJSONChange(changes, "vpc", live.Vpc, desired.Vpc)
+	changes = appendScalarChange(changes, "disable_edge_cache", live.DisableEdgeCache, desired.DisableEdgeCache)
+	changes = appendScalarChange(changes, "disable_email_obfuscation", live.DisableEmailObfuscation, desired.DisableEmailObfuscation)
+	changes = appendScalarChange(changes, "enhanced_threat_control_enabled", live.EnhancedThreatControlEnabled, desired.EnhancedThreatControlEnabled)
+
+	return changes
+}
+
+func diffAppComponent(live, desired AppComponentSpec) []*AppSpecChange {
+	var changes []*AppSpecChange
+
+	lv := reflect.Indirect(reflect.ValueOf(live))
+	dv := reflect.Indirect(reflect.ValueOf(desired))
+	t := dv.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonFieldName(field)
+		if name == "" || name == "name" {
+			continue
+		}
+		lf, df := lv.Field(i), dv.Field(i)
+
+		switch name {
+		case "envs":
+			changes = append(changes, diffAppEnvs(name, lf.Interface().([]*AppVariableDefinition), df.Interface().([]*AppVariableDefinition))...)
+			continue
+		case "image":
+			changes = append(changes, diffAppImage(lf.Interface().(*ImageSourceSpec), df.Interface().(*ImageSourceSpec))...)
+			continue
+		case "routes":
+			changes = append(changes, diffAppRoutes(lf.Interface().([]*AppRouteSpec), df.Interface().([]*AppRouteSpec))...)
+			continue
+		}
+
+		if def, ok := appSpecServerDefaults[name]; ok {
+			if df.IsZero() {
+				continue
+			}
+			if def != nil && lf.IsZero() {
+				lf = reflect.ValueOf(def)
+			}
+		}
+
+		switch df.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64:
+			changes = appendScalarChange(changes, name, lf.Interface(), df.Interface())
+		default:
+			changes = appendJSONChange(changes, name, lf.Interface(), df.Interface())
+		}
+	}
+
+	return changes
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "" || tag == "-" {
+		return ""
+	}
+	return strings.Split(tag, ",")[0]
+}
+
+func appendScalarChange(changes []*AppSpecChange, path string, live, desired interface{}) []*AppSpecChange {
+	if reflect.DeepEqual(live, desired) {
+		return changes
+	}
+	c := &AppSpecChange{Path: path, Type: AppSpecChangeModified}
+	if !reflect.ValueOf(live).IsZero() {
+		c.Old = fmt.Sprint(live)
+	}
+	if !reflect.ValueOf(desired).IsZero() {
+		c.New = fmt.Sprint(desired)
+	}
+	switch {
+	case c.Old == "":
+		c.Type = AppSpecChangeAdded
+	case c.New == "":
+		c.Type = AppSpecChangeRemoved
+	}
+	return append(changes, c)
+}
+
+// appendJSONChange compares two values by their JSON encoding, which treats
+// nil and empty values the same way the API does.
+func appendJSONChange(changes []*AppSpecChange, path string, live, desired interface{}) []*AppSpecChange {
+	l, d := compactJSON(live), compactJSON(desired)
+	if l == d {
+		return changes
+	}
+	c := &AppSpecChange{Path: path, Type: AppSpecChangeModified, Old: l, New: d}
+	switch {
+	case l == "":
+		c.Type = AppSpecChangeAdded
+	case d == "":
+		c.Type = AppSpecChangeRemoved
+	}
+	return append(changes, c)
+}
+
+func compactJSON(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.IsZero() || (rv.Kind() == reflect.Slice && rv.Len() == 0) {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func normalizeAppEnv(e *AppVariableDefinition) AppVariableDefinition {
+	n := *e
+	if n.Scope == "" || n.Scope == AppVariableScope_Unset {
+		n.Scope = AppVariableScope_RunAndBuildTime
+	}
+	if n.Type == "" {
+		n.Type = AppVariableType_General
+	}
+	return n
+}
+
+// isEncryptedAppSecret reports whether e is a SECRET whose value is in the
+// encrypted EV[...] form returned by the API.
+func isEncryptedAppSecret(e AppVariableDefinition) bool {
+	return e.Type == AppVariableType_Secret && strings.HasPrefix(e.Value, "EV[") && strings.HasSuffix(e.Value, "]")
+}
+
+func renderAppEnv(e AppVariableDefinition) string {
+	value := e.Value
+	if e.Type == AppVariableType_Secret {
+		value = appSpecSecretMask
+	}
+	if e.Scope != AppVariableScope_RunAndBuildTime {
+		return fmt.Sprintf("%s (%s)", value, e.Scope)
+	}
+	return value
+}
+
+func diffAppEnvs(path string, live, desired []*AppVariableDefinition) []*AppSpecChange {
+	var changes []*AppSpecChange
+
+	liveByKey := make(map[string]AppVariableDefinition, len(live))
+	for _, e := range live {
+		liveByKey[e.Key] = normalizeAppEnv(e)
+	}
+	desiredKeys := make(map[string]bool, len(desired))
+
+	for _, e := range desired {
+		n := normalizeAppEnv(e)
+		desiredKeys[n.Key] = true
+		p := path + "." + n.Key
+		l, ok := liveByKey[n.Key]
+		if ok && isEncryptedAppSecret(l) && n.Type == AppVariableType_Secret && !isEncryptedAppSecret(n) {
+			// The live value is encrypted and can't be compared with a
+			// plaintext one, so only the scope and type are compared.
+			l.Value = n.Value
+		}
+		switch {
+		case !ok:
+			changes = append(changes, &AppSpecChange{Path: p, Type: AppSpecChangeAdded, New: renderAppEnv(n)})
+		case l != n:
+			oldValue, newValue := renderAppEnv(l), renderAppEnv(n)
+			if oldValue == newValue {
+				// Both values are masked secrets; make it clear the value changed.
+				newValue += " (changed)"
+			}
+			changes = append(changes, &AppSpecChange{Path: p, Type: AppSpecChangeModified, Old: oldValue, New: newValue})
+		}
+	}
+	for _, e := range live {
+		if !desiredKeys[e.Key] {
+			changes = append(changes, &AppSpecChange{
+				Path: path + "." + e.Key, Type: AppSpecChangeRemoved, Old: renderAppEnv(normalizeAppEnv(e)),
+			})
+		}
+	}
+
+	return changes
+}
+
+func diffAppImage(live, desired *ImageSourceSpec) []*AppSpecChange {
+	if live == nil && desired == nil {
+		return nil
+	}
+	if live == nil || desired == nil {
+		return appendJSONChange(nil, "image", live, desired)
+	}
+
+	var changes []*AppSpecChange
+	l, d := *live, *desired
+	// An image without a tag or digest is deployed as "latest".
+	if l.Tag == "" && l.Digest == "" {
+		l.Tag = "latest"
+	}
+	if d.Tag == "" && d.Digest == "" {
+		d.Tag = "latest"
+	}
+	changes = appendScalarChange(changes, "image.registry_type", l.RegistryType, d.RegistryType)
+	changes = appendScalarChange(changes, "image.registry", l.Registry, d.Registry)
+	changes = appendScalarChange(changes, "image.repository", l.Repository, d.Repository)
+	changes = appendScalarChange(changes, "image.tag", l.Tag, d.Tag)
+	changes = appendScalarChange(changes, "image.digest", l.Digest, d.Digest)
+	changes = appendJSONChange(changes, "image.deploy_on_push", l.DeployOnPush, d.DeployOnPush)
+	// Registry credentials are encrypted by the server and can't be compared.
+	return changes
+}
+
+func diffAppRoutes(live, desired []*AppRouteSpec) []*AppSpecChange {
+	var changes []*AppSpecChange
+
+	liveByPath := make(map[string]*AppRouteSpec, len(live))
+	for _, r := range live {
+		liveByPath[r.Path] = r
+	}
+	desiredPaths := make(map[string]bool, len(desired))
+
+	for _, r := range desired {
+		desiredPaths[r.Path] = true
+		l, ok := liveByPath[r.Path]
+		switch {
+		case !ok:
+			changes = append(changes, &AppSpecChange{Path: "routes", Type: AppSpecChangeAdded, New: renderAppRoute(r)})
+		case l.PreservePathPrefix != r.PreservePathPrefix:
+			changes = append(changes, &AppSpecChange{
+				Path: "routes", Type: AppSpecChangeModified, Old: renderAppRoute(l), New: renderAppRoute(r),
+			})
+		}
+	}
+	for _, r := range live {
+		if !desiredPaths[r.Path] {
+			changes = append(changes, &AppSpecChange{Path: "routes", Type: AppSpecChangeRemoved, Old: renderAppRoute(r)})
+		}
+	}
+
+	return changes
+}
+
+func renderAppRoute(r *AppRouteSpec) string {
+	if r.PreservePathPrefix {
+		return r.Path + " (preserve path prefix)"
+	}
+	return r.Path
+}
+
+func diffAppDomains(live, desired []*AppDomainSpec) []*AppSpecChange {
+	var changes []*AppSpecChange
+
+	normalize := func(d *AppDomainSpec) AppDomainSpec {
+		n := *d
+		if n.Type == "" || n.Type == AppDomainSpecType_Unspecified {
+			n.Type = AppDomainSpecType_Default
+		}
+		return n
+	}
+
+	liveByName := make(map[string]AppDomainSpec, len(live))
+	for _, d := range live {
+		liveByName[d.Domain] = normalize(d)
+	}
+	desiredNames := make(map[string]bool, len(desired))
+
+	for _, d := range desired {
+		n := normalize(d)
+		desiredNames[n.Domain] = true
+		p := "domains." + n.Domain
+		l, ok := liveByName[n.Domain]
+		switch {
+		case !ok:
+			changes = append(changes, &AppSpecChange{Path: p, Type: AppSpecChangeAdded, New: renderAppDomain(n)})
+		case l != n:
+			changes = append(changes, &AppSpecChange{
+				Path: p, Type: AppSpecChangeModified, Old: renderAppDomain(l), New: renderAppDomain(n),
+			})
+		}
+	}
+	for _, d := range live {
+		if !desiredNames[d.Domain] {
+			changes = append(changes, &AppSpecChange{
+				Path: "domains." + d.Domain, Type: AppSpecChangeRemoved, Old: renderAppDomain(normalize(d)),
+			})
+		}
+	}
+
+	return changes
+}
+
+func renderAppDomain(d AppDomainSpec) string {
+	parts := []string{string(d.Type)}
+	if d.Wildcard {
+		parts = append(parts, "wildcard")
+	}
+	if d.Zone != "" {
+		parts = append(parts, "zone="+d.Zone)
+	}
+	if d.Certificate != "" {
+		parts = append(parts, "certificate="+d.Certificate)
+	}
+	if d.MinimumTLSVersion != "" {
+		parts = append(parts, "min_tls="+d.MinimumTLSVersion)
+	}
+	return strings.Join(parts, " ")
+}
+
+func diffAppIngress(live, desired *AppIngressSpec) []*AppSpecChange {
+	if live == nil {
+		live = &AppIngressSpec{}
+	}
+
+	var changes []*AppSpecChange
+	changes = appendScalarChange(changes, "ingress.load_balancer", live.LoadBalancer, desired.LoadBalancer)
+	changes = appendScalarChange(changes, "ingress.load_balancer_size", live.LoadBalancerSize, desired.LoadBalancerSize)
+	changes = appendJSONChange(changes, "ingress.secure_header", live.SecureHeader, desired.SecureHeader)
+
+	liveByMatch := make(map[string]*AppIngressSpecRule, len(live.Rules))
+	for _, r := range live.Rules {
+		liveByMatch[ingressRuleMatchKey(r)] = r
+	}
+	desiredMatches := make(map[string]bool, len(desired.Rules))
+
+	for _, r := range desired.Rules {
+		key := ingressRuleMatchKey(r)
+		desiredMatches[key] = true
+		changes = appendJSONChange(changes, "ingress.rules["+key+"]", ruleTarget(liveByMatch[key]), ruleTarget(r))
+	}
+	var removed []string
+	for _, r := range live.Rules {
+		if key := ingressRuleMatchKey(r); !desiredMatches[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		changes = appendJSONChange(changes, "ingress.rules["+key+"]", ruleTarget(liveByMatch[key]), nil)
+	}
+
+	return changes
+}
+
+// ruleTarget returns an ingress rule without its match, which is used as the
+// rule's identity.
+func ruleTarget(r *AppIngressSpecRule) *AppIngressSpecRule {
+	if r == nil {
+		return nil
+	}
+	t := *r
+	t.Match = nil
+	return &t
+}
+
+func ingressRuleMatchKey(r *AppIngressSpecRule) string {
+	if r.Match == nil {
+		return ""
+	}
+	var parts []string
+	if r.Match.Authority != nil {
+		parts = append(parts, "authority="+renderStringMatch(r.Match.Authority))
+	}
+	if r.Match.Path != nil {
+		parts = append(parts, "path="+renderStringMatch(r.Match.Path))
+	}
+	return strings.Join(parts, ",")
+}
+
+func renderStringMatch(m *AppIngressSpecRuleStringMatch) string {
+	switch {
+	case m.Exact != nil:
+		return *m.Exact
+	case m.Prefix != nil:
+		return *m.Prefix + "*"
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package godo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffAppSpecs(t *testing.T) {
+	live := &AppSpec{
+		Name:   "app",
+		Region: "nyc",
+		Domains: []*AppDomainSpec{
+			{Domain: "example.com", Type: AppDomainSpecType_Primary},
+			{Domain: "old.example.com", Type: AppDomainSpecType_Alias},
+		},
+		Services: []*AppServiceSpec{{
+			Name:             "web",
+			EnvironmentSlug:  "node-js",
+			InstanceSizeSlug: "apps-s-1vcpu-0.5gb",
+			InstanceCount:    1,
+			HTTPPort:         8080,
+			Image: &ImageSourceSpec{
+				RegistryType: ImageSourceSpecRegistryType_DOCR,
+				Repository:   "web",
+				Tag:          "v1",
+			},
+			Routes: []*AppRouteSpec{{Path: "/"}},
+			Envs: []*AppVariableDefinition{
+				{Key: "LOG_LEVEL", Value: "info", Scope: AppVariableScope_RunAndBuildTime, Type: AppVariableType_General},
+				{Key: "API_KEY", Value: "EV[1:abc]", Scope: AppVariableScope_RunTime, Type: AppVariableType_Secret},
+				{Key: "TOKEN", Value: "EV[1:def]", Scope: AppVariableScope_RunTime, Type: AppVariableType_Secret},
+				{Key: "ROTATED", Value: "EV[1:ghi]", Type: AppVariableType_Secret},
+				{Key: "OLD", Value: "x"},
+			},
+		}},
+		Workers: []*AppWorkerSpec{{Name: "queue"}},
+	}
+	desired := &AppSpec{
+		Name: "app",
+		Domains: []*AppDomainSpec{
+			{Domain: "example.com", Type: AppDomainSpecType_Primary},
+			{Domain: "new.example.com"},
+		},
+		Services: []*AppServiceSpec{{
+			Name:             "web",
+			InstanceSizeSlug: "apps-s-1vcpu-1gb",
+			InstanceCount:    3,
+			Image: &ImageSourceSpec{
+				RegistryType: ImageSourceSpecRegistryType_DOCR,
+				Repository:   "web",
+				Tag:          "v2",
+			},
+			Routes: []*AppRouteSpec{{Path: "/"}, {Path: "/api"}},
+			Envs: []*AppVariableDefinition{
+				{Key: "LOG_LEVEL", Value: "debug"},
+				{Key: "API_KEY", Value: "s3cr3t", Scope: AppVariableScope_RunTime, Type: AppVariableType_Secret},
+				{Key: "TOKEN", Value: "t0k3n", Type: AppVariableType_Secret},
+				{Key: "ROTATED", Value: "EV[1:jkl]", Type: AppVariableType_Secret},
+				{Key: "NEW_SECRET", Value: "hunter2", Type: AppVariableType_Secret},
+			},
+		}},
+		Jobs: []*AppJobSpec{{Name: "migrate"}},
+	}
+
+	diff := DiffAppSpecs(live, desired)
+	require.True(t, diff.HasChanges())
+
+	assert.Equal(t, []*AppSpecChange{
+		{Path: "domains.new.example.com", Type: AppSpecChangeAdded, New: "DEFAULT"},
+		{Path: "domains.old.example.com", Type: AppSpecChangeRemoved, Old: "ALIAS"},
+	}, diff.Changes)
+
+	require.Len(t, diff.Components, 3)
+	assert.Equal(t, &AppComponentDiff{
+		Name:   "web",
+		Type:   AppComponentTypeService,
+		Change: AppSpecChangeModified,
+		Changes: []*AppSpecChange{
+			{Path: "image.tag", Type: AppSpecChangeModified, Old: "v1", New: "v2"},
+			{Path: "envs.LOG_LEVEL", Type: AppSpecChangeModified, Old: "info", New: "debug"},
+			{Path: "envs.TOKEN", Type: AppSpecChangeModified, Old: "******** (RUN_TIME)", New: "********"},
+			{Path: "envs.ROTATED", Type: AppSpecChangeModified, Old: "********", New: "******** (changed)"},
+			{Path: "envs.NEW_SECRET", Type: AppSpecChangeAdded, New: "********"},
+			{Path: "envs.OLD", Type: AppSpecChangeRemoved, Old: "x"},
+			{Path: "instance_size_slug", Type: AppSpecChangeModified, Old: "apps-s-1vcpu-0.5gb", New: "apps-s-1vcpu-1gb"},
+			{Path: "instance_count", Type: AppSpecChangeModified, Old: "1", New: "3"},
+			{Path: "routes", Type: AppSpecChangeAdded, New: "/api"},
+		},
+	}, diff.Components[0])
+	assert.Equal(t, &AppComponentDiff{Name: "queue", Type: AppComponentTypeWorker, Change: AppSpecChangeRemoved}, diff.Components[1])
+	assert.Equal(t, &AppComponentDiff{Name: "migrate", Type: AppComponentTypeJob, Change: AppSpecChangeAdded}, diff.Components[2])
+
+	assert.NotContains(t, diff.String(), "s3cr3t")
+	assert.NotContains(t, diff.String(), "hunter2")
+}
+
+func TestDiffAppSpecs_IgnoresServerDefaults(t *testing.T) {
+	desired := &AppSpec{
+		Name: "app",
+		Services: []*AppServiceSpec{{
+			Name:  "web",
+			Image: &ImageSourceSpec{RegistryType: ImageSourceSpecRegistryType_DOCR, Repository: "web"},
+			Envs:  []*AppVariableDefinition{{Key: "A", Value: "1"}},
+		}},
+	}
+	live := &AppSpec{
+		Name:    "app",
+		Region:  "ams",
+		Domains: []*AppDomainSpec{},
+		Ingress: &AppIngressSpec{Rules: []*AppIngressSpecRule{{
+			Match:     &AppIngressSpecRuleMatch{Path: &AppIngressSpecRuleStringMatch{Prefix: PtrTo("/")}},
+			Component: &AppIngressSpecRuleRoutingComponent{Name: "web"},
+		}}},
+		Services: []*AppServiceSpec{{
+			Name:             "web",
+			EnvironmentSlug:  "node-js",
+			InstanceSizeSlug: "apps-s-1vcpu-0.5gb",
+			InstanceCount:    1,
+			HTTPPort:         8080,
+			Image:            &ImageSourceSpec{RegistryType: ImageSourceSpecRegistryType_DOCR, Repository: "web", Tag: "latest"},
+			Envs:             []*AppVariableDefinition{{Key: "A", Value: "1", Scope: AppVariableScope_RunAndBuildTime, Type: AppVariableType_General}},
+		}},
+	}
+
+	diff := DiffAppSpecs(live, desired)
+	assert.False(t, diff.HasChanges(), diff.String())
+	assert.Equal(t, "no changes\n", diff.String())
+}
+
+func TestDiffAppSpecs_Ingress(t *testing.T) {
+	rule := func(prefix, component string) *AppIngressSpecRule {
+		return &AppIngressSpecRule{
+			Match:     &AppIngressSpecRuleMatch{Path: &AppIngressSpecRuleStringMatch{Prefix: PtrTo(prefix)}},
+			Component: &AppIngressSpecRuleRoutingComponent{Name: component},
+		}
+	}
+	live := &AppSpec{Ingress: &AppIngressSpec{Rules: []*AppIngressSpecRule{rule("/", "web"), rule("/old", "web")}}}
+	desired := &AppSpec{Ingress: &AppIngressSpec{Rules: []*AppIngressSpecRule{rule("/", "api")}}}
+
+	diff := DiffAppSpecs(live, desired)
+	assert.Equal(t, []*AppSpecChange{
+		{Path: "ingress.rules[path=/*]", Type: AppSpecChangeModified, Old: `{"component":{"name":"web"}}`, New: `{"component":{"name":"api"}}`},
+		{Path: "ingress.rules[path=/old*]", Type: AppSpecChangeRemoved, Old: `{"component":{"name":"web"}}`},
+	}, diff.Changes)
+}
+
+func TestAppSpecDiff_String(t *testing.T) {
+	diff := &AppSpecDiff{
+		Changes: []*AppSpecChange{
+			{Path: "region", Type: AppSpecChangeModified, Old: "nyc", New: "ams"},
+		},
+		Components: []*AppComponentDiff{
+			{
+				Name:   "web",
+				Type:   AppComponentTypeService,
+				Change: AppSpecChangeModified,
+				Changes: []*AppSpecChange{
+					{Path: "envs.A", Type: AppSpecChangeAdded, New: "1"},
+					{Path: "envs.B", Type: AppSpecChangeRemoved, Old: "2"},
+				},
+			},
+			{Name: "queue", Type: AppComponentTypeWorker, Change: AppSpecChangeRemoved},
+		},
+	}
+
+	expected := `app
+  ~ region: nyc -> ams
+~ service web
+  + envs.A: 1
+  - envs.B: 2
+- worker queue
+`
+	assert.Equal(t, expected, diff.String())
+}
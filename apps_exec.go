@@ -0,0 +1,219 @@
+package godo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// AppExecNoExitCode is reported as the exit code of an exec session that
+// ended without the server sending one.
+const AppExecNoExitCode = -1
+
+// Operations of the messages exchanged over an app exec websocket.
+const (
+	appExecOpStdin  = "stdin"
+	appExecOpStdout = "stdout"
+	appExecOpStderr = "stderr"
+	appExecOpResize = "resize"
+	appExecOpExit   = "exit"
+)
+
+// appExecMessage is a frame exchanged over an app exec websocket. Every
+// frame is a JSON text message whose Op selects the stream it belongs to.
+type appExecMessage struct {
+	Op       string `json:"op"`
+	Data     string `json:"data,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// AppExecSession is a console session opened on an app component instance.
+type AppExecSession struct {
+	conn *wsConn
+
+	streamMu sync.Mutex
+}
+
+// AppExecStreamOptions configures the streams attached to an exec session.
+type AppExecStreamOptions struct {
+	// Stdin, if set, is forwarded to the remote process until it returns EOF.
+	Stdin io.Reader
+	// Stdout receives the remote process's standard output. Discarded if nil.
+	Stdout io.Writer
+	// Stderr receives the remote process's standard error. Discarded if nil.
+	Stderr io.Writer
+}
+
+// Exec opens a console session on a component of an app. opts selects the
+// deployment and instance to connect to, as for GetExecWithOpts.
+func (s *AppsServiceOp) Exec(ctx context.Context, appID, component string, opts *AppGetExecOptions) (*AppExecSession, error) {
+	if opts == nil {
+		opts = &AppGetExecOptions{}
+	}
+	exec, _, err := s.GetExecWithOpts(ctx, appID, component, opts)
+	if err != nil {
+		return nil, err
+	}
+	return DialAppExec(ctx, s.client, exec)
+}
+
+// DialAppExec connects to the websocket URL of an AppExec, as returned by
+// AppsService.GetExec and GetExecWithOpts.
+func DialAppExec(ctx context.Context, client *Client, exec *AppExec) (*AppExecSession, error) {
+	if exec == nil || exec.URL == "" {
+		return nil, NewArgError("exec", "must have a URL")
+	}
+
+	req, err := client.NewRequest(ctx, http.MethodGet, exec.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Del("Accept")
+
+	// The exec URL is presigned, so the API token must not be sent to it.
+	conn, resp, err := dialWebsocket(ctx, presignedURLClient(client.HTTPClient), req)
+	if errors.Is(err, errNotWebsocket) {
+		defer resp.Body.Close()
+		if err := CheckResponse(resp); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &AppExecSession{conn: conn}, nil
+}
+
+// Stream attaches the given streams to the session and blocks until the
+// remote process exits, the connection is closed or ctx is done. It returns
+// the exit code reported by the server, or AppExecNoExitCode if none was sent.
+// Stream may only be called once per session.
+func (e *AppExecSession) Stream(ctx context.Context, opts AppExecStreamOptions) (int, error) {
+	if !e.streamMu.TryLock() {
+		return AppExecNoExitCode, errors.New("godo: exec session is already streaming")
+	}
+	defer e.streamMu.Unlock()
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	stop := context.AfterFunc(ctx, func() { e.Close() })
+	defer stop()
+
+	if opts.Stdin != nil {
+		go e.forwardStdin(opts.Stdin)
+	}
+
+	for {
+		_, msg, err := e.conn.readMessage()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return AppExecNoExitCode, ctxErr
+			}
+			var closeErr *wsCloseError
+			if errors.As(err, &closeErr) && closeErr.Code == wsCloseNormal {
+				return AppExecNoExitCode, nil
+			}
+			return AppExecNoExitCode, err
+		}
+
+		var m appExecMessage
+		if err := json.Unmarshal(msg, &m); err != nil {
+			return AppExecNoExitCode, fmt.Errorf("godo: decoding exec message: %w", err)
+		}
+		switch m.Op {
+		case appExecOpStdout:
+			if _, err := io.WriteString(stdout, m.Data); err != nil {
+				return AppExecNoExitCode, err
+			}
+		case appExecOpStderr:
+			if _, err := io.WriteString(stderr, m.Data); err != nil {
+				return AppExecNoExitCode, err
+			}
+		case appExecOpExit:
+			e.Close()
+			if m.ExitCode == nil {
+				return AppExecNoExitCode, nil
+			}
+			return *m.ExitCode, nil
+		}
+	}
+}
+
+func (e *AppExecSession) forwardStdin(r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := e.send(appExecMessage{Op: appExecOpStdin, Data: string(buf[:n])}); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Write sends p to the remote process's standard input.
+func (e *AppExecSession) Write(p []byte) (int, error) {
+	if err := e.send(appExecMessage{Op: appExecOpStdin, Data: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize notifies the remote terminal of a new window size, in characters.
+func (e *AppExecSession) Resize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return NewArgError("width, height", "must be greater than 0")
+	}
+	return e.send(appExecMessage{Op: appExecOpResize, Width: width, Height: height})
+}
+
+func (e *AppExecSession) send(m appExecMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return e.conn.writeMessage(wsOpText, b)
+}
+
+// Close ends the session.
+func (e *AppExecSession) Close() error {
+	return e.conn.close()
+}
+
+// RunCommand runs cmd non-interactively in the console of an app component
+// and returns its output and exit code. The command is sent to the console's
+// shell followed by an exit, so cmd may use shell syntax. Output echoed by the
+// remote terminal, if any, is included in stdout.
+func (s *AppsServiceOp) RunCommand(ctx context.Context, appID, component, cmd string) (string, string, int, error) {
+	session, err := s.Exec(ctx, appID, component, nil)
+	if err != nil {
+		return "", "", AppExecNoExitCode, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := session.Stream(ctx, AppExecStreamOptions{
+		Stdin:  bytes.NewBufferString(cmd + "\nexit $?\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	return stdout.String(), stderr.String(), exitCode, err
+}
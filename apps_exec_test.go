@@ -0,0 +1,117 @@
+package godo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// serveTestAppExec serves the exec URL endpoint for app-id/web and runs fn
+// against the server end of the console websocket.
+func serveTestAppExec(t *testing.T, fn func(conn *wsConn)) {
+	mux.HandleFunc("/v2/apps/app-id/components/web/exec", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, `{"url": "%s/console"}`, strings.Replace(server.URL, "http", "ws", 1))
+	})
+	mux.HandleFunc("/console", func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		fn(upgradeTestWebsocket(t, w, r))
+	})
+}
+
+func readTestAppExecMessage(t *testing.T, conn *wsConn) appExecMessage {
+	_, msg, err := conn.readMessage()
+	require.NoError(t, err)
+	var m appExecMessage
+	require.NoError(t, json.Unmarshal(msg, &m))
+	return m
+}
+
+func writeTestAppExecMessage(t *testing.T, conn *wsConn, m appExecMessage) {
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.NoError(t, conn.writeMessage(wsOpText, b))
+}
+
+func TestApps_RunCommand(t *testing.T) {
+	setup()
+	defer teardown()
+	client.HTTPClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	serveTestAppExec(t, func(conn *wsConn) {
+		var input strings.Builder
+		for !strings.HasSuffix(input.String(), "exit $?\n") {
+			m := readTestAppExecMessage(t, conn)
+			assert.Equal(t, appExecOpStdin, m.Op)
+			input.WriteString(m.Data)
+		}
+		assert.Equal(t, "ls /missing\nexit $?\n", input.String())
+
+		writeTestAppExecMessage(t, conn, appExecMessage{Op: appExecOpStdout, Data: "partial "})
+		writeTestAppExecMessage(t, conn, appExecMessage{Op: appExecOpStdout, Data: "output\n"})
+		writeTestAppExecMessage(t, conn, appExecMessage{Op: appExecOpStderr, Data: "ls: /missing: No such file or directory\n"})
+		writeTestAppExecMessage(t, conn, appExecMessage{Op: appExecOpExit, ExitCode: PtrTo(2)})
+	})
+
+	stdout, stderr, exitCode, err := client.Apps.RunCommand(ctx, "app-id", "web", "ls /missing")
+	require.NoError(t, err)
+	assert.Equal(t, "partial output\n", stdout)
+	assert.Equal(t, "ls: /missing: No such file or directory\n", stderr)
+	assert.Equal(t, 2, exitCode)
+}
+
+func TestApps_Exec_Interactive(t *testing.T) {
+	setup()
+	defer teardown()
+
+	serveTestAppExec(t, func(conn *wsConn) {
+		m := readTestAppExecMessage(t, conn)
+		assert.Equal(t, appExecMessage{Op: appExecOpResize, Width: 120, Height: 40}, m)
+
+		m = readTestAppExecMessage(t, conn)
+		assert.Equal(t, appExecMessage{Op: appExecOpStdin, Data: "whoami\n"}, m)
+
+		writeTestAppExecMessage(t, conn, appExecMessage{Op: appExecOpStdout, Data: "apps\n"})
+		conn.close()
+	})
+
+	session, err := client.Apps.Exec(ctx, "app-id", "web", nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	require.NoError(t, session.Resize(120, 40))
+	_, err = session.Write([]byte("whoami\n"))
+	require.NoError(t, err)
+
+	var stdout bytes.Buffer
+	exitCode, err := session.Stream(ctx, AppExecStreamOptions{Stdout: &stdout})
+	require.NoError(t, err)
+	assert.Equal(t, AppExecNoExitCode, exitCode)
+	assert.Equal(t, "apps\n", stdout.String())
+
+	assert.Error(t, session.Resize(0, 10))
+}
+
+func TestApps_Exec_Error(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/apps/app-id/components/web/exec", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"url": "%s/console"}`, server.URL)
+	})
+	mux.HandleFunc("/console", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"id":"unauthorized","message":"token expired"}`, http.StatusUnauthorized)
+	})
+
+	_, err := client.Apps.Exec(ctx, "app-id", "web", nil)
+	var errResp *ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, "token expired", errResp.Message)
+}
@@ -0,0 +1,520 @@
+package godo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultLogStreamMaxReconnects = 5
+	defaultLogStreamReconnectWait = time.Second
+	maxLogStreamReconnectWait     = 30 * time.Second
+)
+
+// AppLogEntry is a single decoded app log line.
+type AppLogEntry struct {
+	// Component is the name of the component that emitted the line, if present.
+	Component string
+	// Instance is the name of the component instance that emitted the line, if present.
+	Instance string
+	// Timestamp is the time the line was emitted. It is zero when the line
+	// does not carry a timestamp.
+	Timestamp time.Time
+	// Message is the log message without the component, instance and timestamp prefix.
+	Message string
+	// Raw is the line as received from the server.
+	Raw string
+}
+
+// ParseAppLogLine decodes a log line of the form
+// "<component> <instance> <timestamp> <message>" as emitted by App Platform.
+// The component and instance are optional. Lines that don't carry an
+// RFC 3339 timestamp in one of the first three fields are returned with the
+// whole line as the message.
+func ParseAppLogLine(line string) *AppLogEntry {
+	line = strings.TrimRight(line, "\r\n")
+	entry := &AppLogEntry{Raw: line, Message: line}
+
+	fields := strings.SplitN(line, " ", 4)
+	for i := 0; i < len(fields) && i < 3; i++ {
+		ts, err := time.Parse(time.RFC3339Nano, fields[i])
+		if err != nil {
+			continue
+		}
+		entry.Timestamp = ts
+		switch i {
+		case 2:
+			entry.Component, entry.Instance = fields[0], fields[1]
+		case 1:
+			entry.Component = fields[0]
+		}
+		entry.Message = strings.Join(fields[i+1:], " ")
+		break
+	}
+
+	return entry
+}
+
+// StreamLogsOptions configures AppsService.StreamLogs.
+type StreamLogsOptions struct {
+	// Type is the type of logs to stream. Defaults to AppLogTypeRun.
+	Type AppLogType
+	// TailLines is the number of past lines to include when connecting.
+	TailLines int
+	// MaxReconnects is the number of consecutive reconnection attempts made
+	// after a transient drop before giving up. Defaults to 5. Set to a
+	// negative value to disable reconnection.
+	MaxReconnects int
+	// ReconnectWait is the initial delay between reconnection attempts. It
+	// doubles on each consecutive attempt up to 30 seconds. Defaults to one
+	// second.
+	ReconnectWait time.Duration
+}
+
+// AppLogStream is a live stream of app logs returned by AppsService.StreamLogs.
+//
+// Entries can be consumed either with Next, through the channel returned by
+// Entries or as raw lines through Read; these must not be mixed. The stream
+// must be closed with Close once it is no longer needed.
+type AppLogStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	svc    *AppsServiceOp
+
+	appID        string
+	deploymentID string
+	component    string
+	opts         StreamLogsOptions
+
+	src        appLogSource
+	reconnects int
+	// resuming is set after a reconnection so that lines already delivered
+	// before the drop are skipped.
+	resuming bool
+	last     time.Time
+
+	buf []byte
+
+	errMu sync.Mutex
+	err   error
+}
+
+// StreamLogs connects to the live log endpoint of an app component and
+// returns a stream of decoded log entries. The live endpoint is consumed as a
+// websocket when the server supports it and as a chunked HTTP response
+// otherwise. When the connection drops unexpectedly, a fresh live URL is
+// requested and the stream resumes after the last delivered entry.
+func (s *AppsServiceOp) StreamLogs(ctx context.Context, appID, deploymentID, component string, opts *StreamLogsOptions) (*AppLogStream, error) {
+	o := StreamLogsOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Type == "" {
+		o.Type = AppLogTypeRun
+	}
+	if o.MaxReconnects == 0 {
+		o.MaxReconnects = defaultLogStreamMaxReconnects
+	}
+	if o.ReconnectWait <= 0 {
+		o.ReconnectWait = defaultLogStreamReconnectWait
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &AppLogStream{
+		ctx:          ctx,
+		cancel:       cancel,
+		svc:          s,
+		appID:        appID,
+		deploymentID: deploymentID,
+		component:    component,
+		opts:         o,
+	}
+	if err := stream.connect(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Next returns the next log entry. It returns io.EOF when the server ends the
+// stream, and the context's error once the stream is closed or its context is
+// done.
+func (l *AppLogStream) Next() (*AppLogEntry, error) {
+	for {
+		if err := l.Err(); err != nil {
+			return nil, err
+		}
+
+		if l.src == nil {
+			if err := l.connect(); err != nil {
+				if !l.retry(err) {
+					return nil, l.Err()
+				}
+				continue
+			}
+		}
+
+		line, err := l.src.next()
+		if err != nil {
+			l.src.close()
+			l.src = nil
+			if !l.retry(err) {
+				return nil, l.Err()
+			}
+			continue
+		}
+
+		entry := ParseAppLogLine(line)
+		if l.resuming && !entry.Timestamp.IsZero() && !entry.Timestamp.After(l.last) {
+			continue
+		}
+		l.resuming = false
+		l.reconnects = 0
+		if !entry.Timestamp.IsZero() {
+			l.last = entry.Timestamp
+		}
+		return entry, nil
+	}
+}
+
+// Entries returns a channel that yields log entries until the stream ends or
+// is closed. Err reports the reason the channel was closed.
+func (l *AppLogStream) Entries() <-chan *AppLogEntry {
+	ch := make(chan *AppLogEntry)
+	go func() {
+		defer close(ch)
+		for {
+			entry, err := l.Next()
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- entry:
+			case <-l.ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Read implements io.Reader over the raw log lines, each terminated by a newline.
+func (l *AppLogStream) Read(p []byte) (int, error) {
+	if len(l.buf) == 0 {
+		entry, err := l.Next()
+		if err != nil {
+			return 0, err
+		}
+		l.buf = append(l.buf, entry.Raw...)
+		l.buf = append(l.buf, '\n')
+	}
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
+
+// Err returns the error that ended the stream, or nil if it is still open.
+// A stream ended by the server reports io.EOF.
+func (l *AppLogStream) Err() error {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	return l.err
+}
+
+// Close closes the stream and releases the underlying connection.
+func (l *AppLogStream) Close() error {
+	l.setErr(context.Canceled)
+	l.cancel()
+	return nil
+}
+
+func (l *AppLogStream) setErr(err error) {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// retry records err and reports whether the stream should reconnect, in
+// which case it waits for the backoff delay first.
+func (l *AppLogStream) retry(err error) bool {
+	if ctxErr := l.ctx.Err(); ctxErr != nil {
+		l.setErr(ctxErr)
+		return false
+	}
+	if isNormalWebsocketClose(err) {
+		// The server ended the stream, like at the end of a chunked response.
+		l.setErr(io.EOF)
+		return false
+	}
+	if !isTransientLogStreamError(err) || l.reconnects >= l.opts.MaxReconnects {
+		l.setErr(err)
+		return false
+	}
+
+	wait := l.opts.ReconnectWait << l.reconnects
+	if wait > maxLogStreamReconnectWait || wait <= 0 {
+		wait = maxLogStreamReconnectWait
+	}
+	l.reconnects++
+	l.resuming = true
+
+	select {
+	case <-time.After(wait):
+		return true
+	case <-l.ctx.Done():
+		l.setErr(l.ctx.Err())
+		return false
+	}
+}
+
+func isNormalWebsocketClose(err error) bool {
+	var closeErr *wsCloseError
+	return errors.As(err, &closeErr) && closeErr.Code == wsCloseNormal
+}
+
+func isTransientLogStreamError(err error) bool {
+	if err == io.EOF {
+		return false
+	}
+	var closeErr *wsCloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code != wsCloseNormal
+	}
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) {
+		code := errResp.Response.StatusCode
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	return true
+}
+
+func (l *AppLogStream) connect() error {
+	logs, _, err := l.svc.GetLogs(l.ctx, l.appID, l.deploymentID, l.component, l.opts.Type, true, l.opts.TailLines)
+	if err != nil {
+		return err
+	}
+	if logs.LiveURL == "" {
+		return errors.New("godo: no live log URL returned for app")
+	}
+
+	req, err := l.svc.client.NewRequest(l.ctx, http.MethodGet, logs.LiveURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Del("Accept")
+
+	// The live URL is presigned, so the API token must not be sent to it.
+	conn, resp, err := dialWebsocket(l.ctx, presignedURLClient(l.svc.client.HTTPClient), req)
+	var src appLogSource
+	switch {
+	case err == nil:
+		src = &wsLogSource{conn: conn}
+	case errors.Is(err, errNotWebsocket):
+		if err := CheckResponse(resp); err != nil {
+			resp.Body.Close()
+			return err
+		}
+		src = &httpLogSource{body: resp.Body, r: bufio.NewReader(resp.Body)}
+	default:
+		return err
+	}
+
+	// Unblock any pending read once the stream is closed.
+	stop := context.AfterFunc(l.ctx, func() { src.close() })
+	l.src = &stoppableLogSource{appLogSource: src, stop: stop}
+	return nil
+}
+
+// appLogSource yields raw log lines from a single live log connection.
+type appLogSource interface {
+	next() (string, error)
+	close() error
+}
+
+type stoppableLogSource struct {
+	appLogSource
+	stop func() bool
+}
+
+func (s *stoppableLogSource) close() error {
+	s.stop()
+	return s.appLogSource.close()
+}
+
+// wsLogSource reads log lines from websocket messages. Each message is either
+// a JSON object with the log data in its "data" field or plain text, and may
+// contain several lines.
+type wsLogSource struct {
+	conn    *wsConn
+	pending []string
+}
+
+func (s *wsLogSource) next() (string, error) {
+	for len(s.pending) == 0 {
+		_, msg, err := s.conn.readMessage()
+		if err != nil {
+			return "", err
+		}
+
+		data := string(msg)
+		var envelope struct {
+			Data *string `json:"data"`
+		}
+		if json.Unmarshal(msg, &envelope) == nil && envelope.Data != nil {
+			data = *envelope.Data
+		}
+		for _, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+			if line != "" {
+				s.pending = append(s.pending, line)
+			}
+		}
+	}
+	line := s.pending[0]
+	s.pending = s.pending[1:]
+	return line, nil
+}
+
+func (s *wsLogSource) close() error {
+	return s.conn.close()
+}
+
+// httpLogSource reads newline-delimited log lines from a chunked HTTP response.
+type httpLogSource struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+}
+
+func (s *httpLogSource) next() (string, error) {
+	for {
+		line, err := s.r.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			return line, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (s *httpLogSource) close() error {
+	return s.body.Close()
+}
+
+// FetchHistoricLogs downloads the archived log files referenced by
+// logs.HistoricURLs and returns them as a single reader, in order. Each file
+// is only requested once the previous one has been fully read. The returned
+// reader must be closed.
+//
+// logs is typically the result of AppsService.GetLogs,
+// GetJobInvocationLogs or GetEventLogs.
+func (s *AppsServiceOp) FetchHistoricLogs(ctx context.Context, logs *AppLogs) (io.ReadCloser, error) {
+	if logs == nil {
+		return nil, NewArgError("logs", "cannot be nil")
+	}
+	return &historicLogsReader{
+		ctx:        ctx,
+		httpClient: presignedURLClient(s.client.HTTPClient),
+		urls:       logs.HistoricURLs,
+	}, nil
+}
+
+// presignedURLClient returns an HTTP client suitable for fetching presigned
+// URLs, which must not carry the API token.
+func presignedURLClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	if t, ok := c.Transport.(*oauth2.Transport); ok {
+		unauthenticated := *c
+		unauthenticated.Transport = t.Base
+		return &unauthenticated
+	}
+	return c
+}
+
+type historicLogsReader struct {
+	ctx        context.Context
+	httpClient *http.Client
+	urls       []string
+	current    io.ReadCloser
+	// last is the last byte read, used to separate files that don't end
+	// with a newline.
+	last byte
+}
+
+func (h *historicLogsReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if h.current == nil {
+			if len(h.urls) == 0 {
+				return 0, io.EOF
+			}
+			if h.last != 0 && h.last != '\n' {
+				// Keep the last line of the previous file separate from the
+				// first line of the next one.
+				p[0] = '\n'
+				h.last = '\n'
+				return 1, nil
+			}
+			if err := h.open(h.urls[0]); err != nil {
+				return 0, err
+			}
+			h.urls = h.urls[1:]
+		}
+
+		n, err := h.current.Read(p)
+		if n > 0 {
+			h.last = p[n-1]
+		}
+		if err == io.EOF {
+			h.current.Close()
+			h.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (h *historicLogsReader) open(u string) error {
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return fmt.Errorf("godo: fetching historic logs: unexpected status %s", resp.Status)
+	}
+	h.current = resp.Body
+	return nil
+}
+
+func (h *historicLogsReader) Close() error {
+	h.urls = nil
+	if h.current != nil {
+		err := h.current.Close()
+		h.current = nil
+		return err
+	}
+	return nil
+}
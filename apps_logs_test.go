@@ -0,0 +1,183 @@
+package godo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestParseAppLogLine(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+
+	tests := []struct {
+		line     string
+		expected *AppLogEntry
+	}{
+		{
+			line: "web web-6c4b7d9f8-x2k4q 2024-01-02T03:04:05.6Z listening on :8080",
+			expected: &AppLogEntry{
+				Component: "web",
+				Instance:  "web-6c4b7d9f8-x2k4q",
+				Timestamp: ts,
+				Message:   "listening on :8080",
+			},
+		},
+		{
+			line: "web 2024-01-02T03:04:05.6Z building",
+			expected: &AppLogEntry{
+				Component: "web",
+				Timestamp: ts,
+				Message:   "building",
+			},
+		},
+		{
+			line:     "no timestamp here",
+			expected: &AppLogEntry{Message: "no timestamp here"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt.expected.Raw = tt.line
+		assert.Equal(t, tt.expected, ParseAppLogLine(tt.line+"\n"))
+	}
+}
+
+func TestApps_StreamLogs_Websocket(t *testing.T) {
+	setup()
+	defer teardown()
+	client.HTTPClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	var connections int32
+	mux.HandleFunc("/v2/apps/app-id/deployments/deployment-id/logs", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "true", r.URL.Query().Get("follow"))
+		assert.Equal(t, "RUN", r.URL.Query().Get("type"))
+		assert.Equal(t, "web", r.URL.Query().Get("component_name"))
+		fmt.Fprintf(w, `{"live_url": "%s/live"}`, server.URL)
+	})
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		conn := upgradeTestWebsocket(t, w, r)
+		switch atomic.AddInt32(&connections, 1) {
+		case 1:
+			conn.writeMessage(wsOpText, []byte(`{"data":"web web-1 2024-01-02T03:04:05Z one\nweb web-1 2024-01-02T03:04:06Z two\n"}`))
+			// Drop the connection without a close frame.
+			conn.rw.Close()
+		default:
+			// The reconnection replays already delivered lines.
+			conn.writeMessage(wsOpText, []byte(`{"data":"web web-1 2024-01-02T03:04:06Z two"}`))
+			conn.writeMessage(wsOpText, []byte(`web web-1 2024-01-02T03:04:07Z three`))
+			conn.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+		}
+	})
+
+	stream, err := client.Apps.StreamLogs(ctx, "app-id", "deployment-id", "web", &StreamLogsOptions{
+		ReconnectWait: time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var messages []string
+	for entry := range stream.Entries() {
+		assert.Equal(t, "web", entry.Component)
+		assert.Equal(t, "web-1", entry.Instance)
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{"one", "two", "three"}, messages)
+
+	assert.Equal(t, io.EOF, stream.Err())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&connections))
+}
+
+func TestApps_StreamLogs_ChunkedHTTP(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/apps/app-id/logs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "BUILD", r.URL.Query().Get("type"))
+		assert.Equal(t, "10", r.URL.Query().Get("tail_lines"))
+		fmt.Fprintf(w, `{"live_url": "%s/live"}`, server.URL)
+	})
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		fmt.Fprint(w, "web 2024-01-02T03:04:05Z step 1\n")
+		flusher.Flush()
+		fmt.Fprint(w, "web 2024-01-02T03:04:06Z step 2\n")
+	})
+
+	stream, err := client.Apps.StreamLogs(ctx, "app-id", "", "", &StreamLogsOptions{
+		Type:      AppLogTypeBuild,
+		TailLines: 10,
+	})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	out, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "web 2024-01-02T03:04:05Z step 1\nweb 2024-01-02T03:04:06Z step 2\n", string(out))
+	assert.Equal(t, io.EOF, stream.Err())
+}
+
+func TestApps_StreamLogs_Error(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/apps/app-id/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"live_url": "%s/live"}`, server.URL)
+	})
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"id":"forbidden","message":"expired"}`, http.StatusForbidden)
+	})
+
+	_, err := client.Apps.StreamLogs(ctx, "app-id", "", "web", nil)
+	var errResp *ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, http.StatusForbidden, errResp.Response.StatusCode)
+}
+
+func TestApps_FetchHistoricLogs(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/archive/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "line 1\nline 2")
+	})
+	mux.HandleFunc("/archive/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "line 3\n")
+	})
+
+	r, err := client.Apps.FetchHistoricLogs(ctx, &AppLogs{
+		HistoricURLs: []string{server.URL + "/archive/1", server.URL + "/archive/2"},
+	})
+	require.NoError(t, err)
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\nline 3\n", string(out))
+}
+
+func TestApps_FetchHistoricLogs_Error(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/archive/1", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	r, err := client.Apps.FetchHistoricLogs(ctx, &AppLogs{HistoricURLs: []string{server.URL + "/archive/1"}})
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	assert.Error(t, err)
+}
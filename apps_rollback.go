@@ -0,0 +1,258 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+// DeployOutcome is the result of a DeployWithRollback run.
+type DeployOutcome string
+
+const (
+	// DeployOutcomeSucceeded means the new deployment became active and stayed healthy.
+	DeployOutcomeSucceeded DeployOutcome = "succeeded"
+	// DeployOutcomeRolledBack means the new deployment failed and the previous
+	// spec was successfully re-applied.
+	DeployOutcomeRolledBack DeployOutcome = "rolled_back"
+	// DeployOutcomeRollbackFailed means the new deployment failed and so did
+	// the rollback deployment.
+	DeployOutcomeRollbackFailed DeployOutcome = "rollback_failed"
+	// DeployOutcomeFailed means the new deployment failed and there was no
+	// previous active deployment to roll back to.
+	DeployOutcomeFailed DeployOutcome = "failed"
+	// DeployOutcomeSuperseded means another deployment replaced the new one
+	// before it finished. No rollback is attempted.
+	DeployOutcomeSuperseded DeployOutcome = "superseded"
+)
+
+// DeployWithRollbackRequest configures DeployWithRollback.
+type DeployWithRollbackRequest struct {
+	AppID string
+	// Spec is applied with AppsService.Update. When nil, a new deployment of
+	// the current spec is created with AppsService.CreateDeployment instead.
+	Spec *AppSpec
+	// UpdateAllSourceVersions is passed to AppsService.Update with Spec.
+	UpdateAllSourceVersions bool
+	// ForceBuild is passed to AppsService.CreateDeployment when Spec is nil.
+	ForceBuild bool
+
+	// HealthCheckWindow is how long component health is checked with
+	// AppsService.GetAppHealth once the deployment is active. A component
+	// reported as UNHEALTHY during the window triggers a rollback. Health
+	// checks are skipped when zero.
+	HealthCheckWindow time.Duration
+	// HealthCheckInterval is the delay between health checks. Defaults to ten seconds.
+	HealthCheckInterval time.Duration
+
+	// Watch configures how the deployments are polled.
+	Watch *WatchDeploymentOptions
+	// OnEvent, if set, receives the events of both the new and the rollback
+	// deployment, as for WatchDeployment.
+	OnEvent func(*DeploymentEvent) error
+}
+
+// DeployWithRollbackReport describes what DeployWithRollback did.
+type DeployWithRollbackReport struct {
+	AppID   string
+	Outcome DeployOutcome
+	// Reason explains why the new deployment was considered failed.
+	Reason string
+
+	// DeploymentID is the ID of the new deployment and Phase its final phase.
+	DeploymentID string
+	Phase        DeploymentPhase
+	// UnhealthyComponents lists the components reported unhealthy during
+	// the health check window.
+	UnhealthyComponents []string
+
+	// PreviousDeploymentID is the ID of the last active deployment before the
+	// new one, whose spec is used for the rollback.
+	PreviousDeploymentID string
+	// RollbackDeploymentID is the ID of the deployment created by the
+	// rollback and RollbackPhase its final phase.
+	RollbackDeploymentID string
+	RollbackPhase        DeploymentPhase
+}
+
+// DeployWithRollback deploys an app, waits for the deployment to finish and,
+// if it fails or the app becomes unhealthy within the health check window,
+// re-applies the spec of the last deployment that was active before it.
+//
+// An error is only returned when the workflow can't be carried out, for
+// example because an API call fails; a failed deployment is reported through
+// the Outcome of the returned report.
+func DeployWithRollback(ctx context.Context, client *Client, req *DeployWithRollbackRequest) (*DeployWithRollbackReport, error) {
+	if req == nil || req.AppID == "" {
+		return nil, NewArgError("req.AppID", "cannot be empty")
+	}
+	report := &DeployWithRollbackReport{AppID: req.AppID}
+
+	previous, err := lastActiveDeployment(ctx, client, req.AppID)
+	if err != nil {
+		return report, err
+	}
+	if previous != nil {
+		report.PreviousDeploymentID = previous.ID
+	}
+
+	deploymentID, err := startDeployment(ctx, client, req)
+	if err != nil {
+		return report, err
+	}
+	report.DeploymentID = deploymentID
+
+	deployment, err := WatchDeployment(ctx, client, req.AppID, deploymentID, req.Watch, req.OnEvent)
+	if err != nil {
+		return report, err
+	}
+	report.Phase = deployment.Phase
+
+	switch deployment.Phase {
+	case DeploymentPhase_Superseded:
+		report.Outcome = DeployOutcomeSuperseded
+		return report, nil
+	case DeploymentPhase_Active:
+		unhealthy, err := checkAppHealth(ctx, client, req)
+		if err != nil {
+			return report, err
+		}
+		if len(unhealthy) == 0 {
+			report.Outcome = DeployOutcomeSucceeded
+			return report, nil
+		}
+		report.UnhealthyComponents = unhealthy
+		report.Reason = fmt.Sprintf("components became unhealthy: %v", unhealthy)
+	default:
+		report.Reason = fmt.Sprintf("deployment ended in phase %s", deployment.Phase)
+	}
+
+	if previous == nil || previous.Spec == nil {
+		report.Outcome = DeployOutcomeFailed
+		return report, nil
+	}
+
+	app, _, err := client.Apps.Update(ctx, req.AppID, &AppUpdateRequest{Spec: previous.Spec})
+	if err != nil {
+		return report, err
+	}
+	rollbackID := appDeploymentID(app)
+	if rollbackID == "" {
+		return report, errors.New("godo: rollback update did not create a deployment")
+	}
+	report.RollbackDeploymentID = rollbackID
+
+	rollback, err := WatchDeployment(ctx, client, req.AppID, rollbackID, req.Watch, req.OnEvent)
+	if err != nil {
+		return report, err
+	}
+	report.RollbackPhase = rollback.Phase
+	if rollback.Phase == DeploymentPhase_Active {
+		report.Outcome = DeployOutcomeRolledBack
+	} else {
+		report.Outcome = DeployOutcomeRollbackFailed
+	}
+	return report, nil
+}
+
+// lastActiveDeployment returns the most recent deployment of an app that
+// reached the ACTIVE phase, or nil if there is none.
+func lastActiveDeployment(ctx context.Context, client *Client, appID string) (*Deployment, error) {
+	opt := &ListOptions{PerPage: 20}
+	for {
+		deployments, resp, err := client.Apps.ListDeployments(ctx, appID, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deployments {
+			if d.Phase == DeploymentPhase_Active {
+				return d, nil
+			}
+		}
+		if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+			return nil, nil
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+		opt.Page = page + 1
+	}
+}
+
+func startDeployment(ctx context.Context, client *Client, req *DeployWithRollbackRequest) (string, error) {
+	if req.Spec == nil {
+		deployment, _, err := client.Apps.CreateDeployment(ctx, req.AppID, &DeploymentCreateRequest{ForceBuild: req.ForceBuild})
+		if err != nil {
+			return "", err
+		}
+		return deployment.ID, nil
+	}
+
+	app, _, err := client.Apps.Update(ctx, req.AppID, &AppUpdateRequest{
+		Spec:                    req.Spec,
+		UpdateAllSourceVersions: req.UpdateAllSourceVersions,
+	})
+	if err != nil {
+		return "", err
+	}
+	id := appDeploymentID(app)
+	if id == "" {
+		return "", errors.New("godo: app update did not create a deployment")
+	}
+	return id, nil
+}
+
+// appDeploymentID returns the ID of the deployment triggered by an app update.
+func appDeploymentID(app *App) string {
+	switch {
+	case app == nil:
+		return ""
+	case app.PendingDeployment != nil && app.PendingDeployment.ID != "":
+		return app.PendingDeployment.ID
+	case app.InProgressDeployment != nil:
+		return app.InProgressDeployment.ID
+	}
+	return ""
+}
+
+// checkAppHealth polls the app's health for the configured window and
+// returns the names of the components reported unhealthy.
+func checkAppHealth(ctx context.Context, client *Client, req *DeployWithRollbackRequest) ([]string, error) {
+	if req.HealthCheckWindow <= 0 {
+		return nil, nil
+	}
+	interval := req.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	deadline := time.Now().Add(req.HealthCheckWindow)
+	for {
+		health, _, err := client.Apps.GetAppHealth(ctx, req.AppID)
+		if err != nil {
+			return nil, err
+		}
+		var unhealthy []string
+		for _, c := range health.Components {
+			if c.State == COMPONENTHEALTHSTATUS_Unhealthy {
+				unhealthy = append(unhealthy, c.Name)
+			}
+		}
+		if len(unhealthy) > 0 {
+			return unhealthy, nil
+		}
+
+		if !time.Now().Add(interval).Before(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
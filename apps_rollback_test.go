@@ -0,0 +1,130 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTestRollbackApp serves the app endpoints used by DeployWithRollback.
+// phases maps deployment IDs to the phase they end in, and updates records
+// the specs applied through Apps.Update.
+func serveTestRollbackApp(t *testing.T, phases map[string]DeploymentPhase, health ComponentHealthStatus, updates *[]*AppSpec) {
+	mux.HandleFunc("/v2/apps/app-id/deployments", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			// The first page has an ACTIVE deployment, so the others aren't
+			// needed.
+			assert.Empty(t, r.URL.Query().Get("page"))
+			fmt.Fprint(w, `{"deployments": [
+				{"id": "failed", "phase": "ERROR", "spec": {"name": "broken"}},
+				{"id": "previous", "phase": "ACTIVE", "spec": {"name": "good"}}
+			], "links": {"pages": {"next": "https://api.digitalocean.com/v2/apps/app-id/deployments?page=2", "last": "https://api.digitalocean.com/v2/apps/app-id/deployments?page=5"}}}`)
+		case http.MethodPost:
+			fmt.Fprint(w, `{"deployment": {"id": "new", "phase": "PENDING_BUILD"}}`)
+		}
+	})
+	mux.HandleFunc("/v2/apps/app-id", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPut)
+		var req AppUpdateRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*updates = append(*updates, req.Spec)
+		id := "new"
+		if req.Spec.Name == "good" {
+			id = "rollback"
+		}
+		fmt.Fprintf(w, `{"app": {"id": "app-id", "pending_deployment": {"id": %q}}}`, id)
+	})
+	for id, phase := range phases {
+		id, phase := id, phase
+		mux.HandleFunc("/v2/apps/app-id/deployments/"+id, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"deployment": {"id": %q, "phase": %q}}`, id, phase)
+		})
+	}
+	mux.HandleFunc("/v2/apps/app-id/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"app_health": {"components": [{"name": "web", "state": %q}]}}`, health)
+	})
+}
+
+func TestDeployWithRollback_Succeeded(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var updates []*AppSpec
+	serveTestRollbackApp(t, map[string]DeploymentPhase{"new": DeploymentPhase_Active}, COMPONENTHEALTHSTATUS_Healthy, &updates)
+
+	report, err := DeployWithRollback(ctx, client, &DeployWithRollbackRequest{
+		AppID:               "app-id",
+		Spec:                &AppSpec{Name: "next"},
+		HealthCheckWindow:   5 * time.Millisecond,
+		HealthCheckInterval: time.Millisecond,
+		Watch:               &WatchDeploymentOptions{PollInterval: time.Millisecond},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &DeployWithRollbackReport{
+		AppID:                "app-id",
+		Outcome:              DeployOutcomeSucceeded,
+		DeploymentID:         "new",
+		Phase:                DeploymentPhase_Active,
+		PreviousDeploymentID: "previous",
+	}, report)
+	assert.Equal(t, []*AppSpec{{Name: "next"}}, updates)
+}
+
+func TestDeployWithRollback_FailedDeployment(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var updates []*AppSpec
+	serveTestRollbackApp(t, map[string]DeploymentPhase{
+		"new":      DeploymentPhase_Error,
+		"rollback": DeploymentPhase_Active,
+	}, COMPONENTHEALTHSTATUS_Healthy, &updates)
+
+	report, err := DeployWithRollback(ctx, client, &DeployWithRollbackRequest{
+		AppID: "app-id",
+		Watch: &WatchDeploymentOptions{PollInterval: time.Millisecond},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &DeployWithRollbackReport{
+		AppID:                "app-id",
+		Outcome:              DeployOutcomeRolledBack,
+		Reason:               "deployment ended in phase ERROR",
+		DeploymentID:         "new",
+		Phase:                DeploymentPhase_Error,
+		PreviousDeploymentID: "previous",
+		RollbackDeploymentID: "rollback",
+		RollbackPhase:        DeploymentPhase_Active,
+	}, report)
+	assert.Equal(t, []*AppSpec{{Name: "good"}}, updates)
+}
+
+func TestDeployWithRollback_Unhealthy(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var updates []*AppSpec
+	serveTestRollbackApp(t, map[string]DeploymentPhase{
+		"new":      DeploymentPhase_Active,
+		"rollback": DeploymentPhase_Error,
+	}, COMPONENTHEALTHSTATUS_Unhealthy, &updates)
+
+	report, err := DeployWithRollback(ctx, client, &DeployWithRollbackRequest{
+		AppID:               "app-id",
+		Spec:                &AppSpec{Name: "next"},
+		HealthCheckWindow:   time.Minute,
+		HealthCheckInterval: time.Millisecond,
+		Watch:               &WatchDeploymentOptions{PollInterval: time.Millisecond},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, DeployOutcomeRollbackFailed, report.Outcome)
+	assert.Equal(t, []string{"web"}, report.UnhealthyComponents)
+	assert.Equal(t, "rollback", report.RollbackDeploymentID)
+	assert.Equal(t, DeploymentPhase_Error, report.RollbackPhase)
+	assert.Equal(t, []*AppSpec{{Name: "next"}, {Name: "good"}}, updates)
+}
@@ -0,0 +1,270 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultCertificateWatchInterval = 5 * time.Minute
+
+// CertificateVerified is the state of a certificate that can be used.
+const CertificateVerified = "verified"
+
+// CertificateBinding is a reference to a certificate by a load balancer
+// forwarding rule or a CDN endpoint. Exactly one of LoadBalancerID and
+// CDNID is set.
+type CertificateBinding struct {
+	LoadBalancerID string
+	// Rule is the forwarding rule as it was before the certificate was
+	// replaced.
+	Rule *ForwardingRule
+
+	CDNID string
+	// CustomDomain is the custom domain of the CDN endpoint.
+	CustomDomain string
+	// CertificateID is the certificate that was referenced.
+	CertificateID string
+}
+
+// CertificateRebindResult describes what a CertificateBindingManager did for
+// a certificate name.
+type CertificateRebindResult struct {
+	Name string
+	// CertificateID is the ID of the newest certificate with the name, which
+	// the bindings now reference.
+	CertificateID string
+	Rebound       []CertificateBinding
+}
+
+// CertificateBindingManager keeps load balancers and CDN endpoints pointed at
+// the newest certificate of a name. When a Let's Encrypt certificate is
+// reissued, its replacement has the same name and a new ID, and forwarding
+// rules and CDN endpoints still referencing the old ID break.
+//
+// A binding is recognized by the ID it references: either the ID of a
+// certificate that currently has the name, or one the manager has seen with
+// the name before. A reissued certificate may already be deleted when
+// Rebind runs, so a manager should live as long as the certificates it
+// watches. A manager is safe for concurrent use.
+type CertificateBindingManager struct {
+	client *Client
+
+	mu    sync.Mutex
+	known map[string]map[string]bool
+}
+
+// NewCertificateBindingManager returns a manager that uses the
+// Certificates, LoadBalancers and CDNs services of client.
+func NewCertificateBindingManager(client *Client) *CertificateBindingManager {
+	return &CertificateBindingManager{client: client, known: make(map[string]map[string]bool)}
+}
+
+// Remember records certificate IDs that had a name before, such as the ID of
+// a certificate deleted before the manager was created, so that the bindings
+// still referencing them are rebound.
+func (m *CertificateBindingManager) Remember(name string, ids ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.known[name] == nil {
+		m.known[name] = make(map[string]bool)
+	}
+	for _, id := range ids {
+		m.known[name][id] = true
+	}
+}
+
+// newestCertificate returns the newest verified certificate with a name and
+// records the IDs of all of them.
+func (m *CertificateBindingManager) newestCertificate(ctx context.Context, name string) (*Certificate, error) {
+	certs, err := collectPages(func(opt *ListOptions) ([]Certificate, *Response, error) {
+		return m.client.Certificates.ListByName(ctx, name, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *Certificate
+	var newestCreated time.Time
+	for i, c := range certs {
+		m.Remember(name, c.ID)
+		if c.Name != name || c.State != CertificateVerified {
+			continue
+		}
+		created, _ := time.Parse(time.RFC3339, c.Created)
+		if newest == nil || created.After(newestCreated) {
+			newest, newestCreated = &certs[i], created
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("godo: no verified certificate named %s", name)
+	}
+	return newest, nil
+}
+
+// Rebind points every forwarding rule and CDN endpoint that references a
+// certificate with a name to the newest verified certificate with that
+// name. The forwarding rules of a load balancer are changed in a single
+// Update rather than with RemoveForwardingRules and AddForwardingRules, so
+// that its HTTPS listeners stay up and a failed update leaves it unchanged.
+// The load balancer is read again right before the update, so that the
+// update doesn't undo changes made since it was listed. CDN endpoints are
+// updated with UpdateCustomDomain. Resources that fail don't stop the
+// others; their errors are joined and returned with the bindings that were
+// rebound.
+func (m *CertificateBindingManager) Rebind(ctx context.Context, name string) (*CertificateRebindResult, error) {
+	if name == "" {
+		return nil, NewArgError("name", "cannot be empty")
+	}
+	newest, err := m.newestCertificate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	stale := make(map[string]bool, len(m.known[name]))
+	for id := range m.known[name] {
+		stale[id] = id != newest.ID
+	}
+	m.mu.Unlock()
+
+	result := &CertificateRebindResult{Name: name, CertificateID: newest.ID}
+	var errs []error
+
+	lbs, err := collectPages(func(opt *ListOptions) ([]LoadBalancer, *Response, error) {
+		return m.client.LoadBalancers.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, listed := range lbs {
+		if !slices.ContainsFunc(listed.ForwardingRules, func(r ForwardingRule) bool { return stale[r.CertificateID] }) {
+			continue
+		}
+		lb, _, err := m.client.LoadBalancers.Get(ctx, listed.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("godo: getting load balancer %s: %w", listed.ID, err))
+			continue
+		}
+		var old []ForwardingRule
+		update := lb.AsRequest()
+		if lb.Tag != "" {
+			// The API fills in the droplets of a tag, and rejects a request
+			// that sets both.
+			update.DropletIDs = nil
+		}
+		for i, r := range update.ForwardingRules {
+			if stale[r.CertificateID] {
+				old = append(old, r)
+				update.ForwardingRules[i].CertificateID = newest.ID
+			}
+		}
+		if len(old) == 0 {
+			continue
+		}
+		if _, _, err := m.client.LoadBalancers.Update(ctx, lb.ID, update); err != nil {
+			errs = append(errs, fmt.Errorf("godo: updating forwarding rules of load balancer %s: %w", lb.ID, err))
+			continue
+		}
+		for i := range old {
+			result.Rebound = append(result.Rebound, CertificateBinding{
+				LoadBalancerID: lb.ID,
+				Rule:           &old[i],
+				CertificateID:  old[i].CertificateID,
+			})
+		}
+	}
+
+	cdns, err := collectPages(func(opt *ListOptions) ([]CDN, *Response, error) {
+		return m.client.CDNs.List(ctx, opt)
+	})
+	if err != nil {
+		return result, errors.Join(append(errs, err)...)
+	}
+	for _, cdn := range cdns {
+		if !stale[cdn.CertificateID] {
+			continue
+		}
+		_, _, err := m.client.CDNs.UpdateCustomDomain(ctx, cdn.ID, &CDNUpdateCustomDomainRequest{
+			CustomDomain:  cdn.CustomDomain,
+			CertificateID: newest.ID,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("godo: updating certificate of CDN %s: %w", cdn.ID, err))
+			continue
+		}
+		result.Rebound = append(result.Rebound, CertificateBinding{
+			CDNID:         cdn.ID,
+			CustomDomain:  cdn.CustomDomain,
+			CertificateID: cdn.CertificateID,
+		})
+	}
+	return result, errors.Join(errs...)
+}
+
+// CertificateWatchOptions configures CertificateBindingManager.Watch.
+type CertificateWatchOptions struct {
+	// Interval is the delay between checks for new certificates. Defaults to
+	// five minutes.
+	Interval time.Duration
+	// OnRebind, if set, receives the result of each Rebind that changed
+	// bindings.
+	OnRebind func(*CertificateRebindResult)
+	// OnError, if set, receives the errors of a check, and Watch carries on.
+	// Otherwise Watch returns the first error.
+	OnError func(name string, err error)
+}
+
+// Watch rebinds the certificates with the given names when they are
+// replaced. Every name is rebound on the first check, then only when the ID
+// of its newest certificate changes. Watch runs until ctx is done, and
+// returns ctx.Err().
+func (m *CertificateBindingManager) Watch(ctx context.Context, opts *CertificateWatchOptions, names ...string) error {
+	if len(names) == 0 {
+		return NewArgError("names", "cannot be empty")
+	}
+	if opts == nil {
+		opts = &CertificateWatchOptions{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultCertificateWatchInterval
+	}
+
+	current := make(map[string]string, len(names))
+	for {
+		for _, name := range names {
+			err := m.watchOnce(ctx, name, current, opts)
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			if opts.OnError == nil {
+				return err
+			}
+			opts.OnError(name, err)
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *CertificateBindingManager) watchOnce(ctx context.Context, name string, current map[string]string, opts *CertificateWatchOptions) error {
+	newest, err := m.newestCertificate(ctx, name)
+	if err != nil {
+		return err
+	}
+	if current[name] == newest.ID {
+		return nil
+	}
+	result, err := m.Rebind(ctx, name)
+	if result != nil && len(result.Rebound) > 0 && opts.OnRebind != nil {
+		opts.OnRebind(result)
+	}
+	if err != nil {
+		return err
+	}
+	current[name] = newest.ID
+	return nil
+}
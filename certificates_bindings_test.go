@@ -0,0 +1,176 @@
+package godo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTestCertificateBindings serves certificates named "web", three load
+// balancers and two CDN endpoints, and records the changes made to them.
+// certs returns the certificates at each list call.
+func serveTestCertificateBindings(t *testing.T, certs func() string) *[]string {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(s string) {
+		mu.Lock()
+		calls = append(calls, s)
+		mu.Unlock()
+	}
+	mux.HandleFunc("/v2/certificates", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "web", r.URL.Query().Get("name"))
+		fmt.Fprintf(w, `{"certificates": [%s]}`, certs())
+	})
+	mux.HandleFunc("/v2/load_balancers", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"load_balancers": [
+			{"id": "lb-1", "droplet_ids": [1], "forwarding_rules": [
+				{"entry_protocol": "https", "entry_port": 443, "target_protocol": "http", "target_port": 80, "certificate_id": "cert-old"},
+				{"entry_protocol": "http", "entry_port": 80, "target_protocol": "http", "target_port": 80}
+			]},
+			{"id": "lb-2", "forwarding_rules": [
+				{"entry_protocol": "https", "entry_port": 443, "target_protocol": "http", "target_port": 80, "certificate_id": "cert-other"}
+			]},
+			{"id": "lb-3", "tag": "web", "droplet_ids": [3], "forwarding_rules": [
+				{"entry_protocol": "https", "entry_port": 443, "target_protocol": "http", "target_port": 80, "certificate_id": "cert-old"}
+			]}
+		]}`)
+	})
+	serveLB := func(id, lb string) {
+		mux.HandleFunc("/v2/load_balancers/"+id, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				fmt.Fprintf(w, `{"load_balancer": %s}`, lb)
+				return
+			}
+			testMethod(t, r, http.MethodPut)
+			var req LoadBalancerRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			var rules []string
+			for _, rule := range req.ForwardingRules {
+				rules = append(rules, fmt.Sprintf("%d:%s", rule.EntryPort, rule.CertificateID))
+			}
+			record(fmt.Sprintf("PUT %s droplets=%v tag=%s rules=%v", id, req.DropletIDs, req.Tag, rules))
+			fmt.Fprintf(w, `{"load_balancer": {"id": %q}}`, id)
+		})
+	}
+	// A droplet was added to lb-1 since it was listed.
+	serveLB("lb-1", `{"id": "lb-1", "droplet_ids": [1, 2], "forwarding_rules": [
+		{"entry_protocol": "https", "entry_port": 443, "target_protocol": "http", "target_port": 80, "certificate_id": "cert-old"},
+		{"entry_protocol": "http", "entry_port": 80, "target_protocol": "http", "target_port": 80}
+	]}`)
+	serveLB("lb-3", `{"id": "lb-3", "tag": "web", "droplet_ids": [3], "forwarding_rules": [
+		{"entry_protocol": "https", "entry_port": 443, "target_protocol": "http", "target_port": 80, "certificate_id": "cert-old"}
+	]}`)
+	mux.HandleFunc("/v2/cdn/endpoints", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"endpoints": [
+			{"id": "cdn-1", "custom_domain": "static.example.com", "certificate_id": "cert-old"},
+			{"id": "cdn-2", "custom_domain": "assets.example.com", "certificate_id": "cert-new"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/cdn/endpoints/cdn-1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPut)
+		var req CDNUpdateCustomDomainRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		record(fmt.Sprintf("PUT cdn-1 %s %s", req.CustomDomain, req.CertificateID))
+		fmt.Fprint(w, `{"endpoint": {"id": "cdn-1"}}`)
+	})
+	return &calls
+}
+
+func TestCertificateBindingManager_Rebind(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := serveTestCertificateBindings(t, func() string {
+		return `{"id": "cert-old", "name": "web", "state": "verified", "created_at": "2026-01-01T00:00:00Z"},
+			{"id": "cert-new", "name": "web", "state": "verified", "created_at": "2026-04-01T00:00:00Z"},
+			{"id": "cert-pending", "name": "web", "state": "pending", "created_at": "2026-05-01T00:00:00Z"}`
+	})
+
+	result, err := NewCertificateBindingManager(client).Rebind(ctx, "web")
+	require.NoError(t, err)
+	assert.Equal(t, "cert-new", result.CertificateID)
+	assert.Equal(t, []string{
+		"PUT lb-1 droplets=[1 2] tag= rules=[443:cert-new 80:]",
+		"PUT lb-3 droplets=[] tag=web rules=[443:cert-new]",
+		"PUT cdn-1 static.example.com cert-new",
+	}, *calls)
+	require.Len(t, result.Rebound, 3)
+	assert.Equal(t, "lb-1", result.Rebound[0].LoadBalancerID)
+	assert.Equal(t, 443, result.Rebound[0].Rule.EntryPort)
+	assert.Equal(t, "lb-3", result.Rebound[1].LoadBalancerID)
+	assert.Equal(t, CertificateBinding{CDNID: "cdn-1", CustomDomain: "static.example.com", CertificateID: "cert-old"}, result.Rebound[2])
+}
+
+func TestCertificateBindingManager_Watch(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var (
+		mu       sync.Mutex
+		reissued bool
+	)
+	calls := serveTestCertificateBindings(t, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if !reissued {
+			return `{"id": "cert-old", "name": "web", "state": "verified", "created_at": "2026-01-01T00:00:00Z"}`
+		}
+		return `{"id": "cert-new", "name": "web", "state": "verified", "created_at": "2026-04-01T00:00:00Z"}`
+	})
+
+	m := NewCertificateBindingManager(client)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rebinds := make(chan *CertificateRebindResult, 1)
+	done := make(chan error)
+	go func() {
+		done <- m.Watch(ctx, &CertificateWatchOptions{
+			Interval: time.Millisecond,
+			OnRebind: func(r *CertificateRebindResult) { rebinds <- r },
+			OnError:  func(name string, err error) { t.Errorf("%s: %v", name, err) },
+		}, "web")
+	}()
+
+	// The first check finds nothing to rebind; after the reissue, the old
+	// certificate is gone from the list but still known to the manager.
+	time.Sleep(5 * time.Millisecond)
+	assert.Empty(t, *calls)
+	mu.Lock()
+	reissued = true
+	mu.Unlock()
+
+	select {
+	case r := <-rebinds:
+		assert.Equal(t, "cert-new", r.CertificateID)
+		assert.Len(t, r.Rebound, 3)
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate was not rebound")
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, []string{
+		"PUT lb-1 droplets=[1 2] tag= rules=[443:cert-new 80:]",
+		"PUT lb-3 droplets=[] tag=web rules=[443:cert-new]",
+		"PUT cdn-1 static.example.com cert-new",
+	}, *calls)
+}
+
+func TestCertificateBindingManager_NoCertificate(t *testing.T) {
+	setup()
+	defer teardown()
+
+	serveTestCertificateBindings(t, func() string {
+		return `{"id": "cert-pending", "name": "web", "state": "pending"}`
+	})
+	_, err := NewCertificateBindingManager(client).Rebind(ctx, "web")
+	assert.EqualError(t, err, "godo: no verified certificate named web")
+}
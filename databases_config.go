@@ -0,0 +1,328 @@
+package godo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DatabaseEngineConfig is the set of engine config types supported by
+// DiffDatabaseConfig, PatchDatabaseConfig and the YAML helpers.
+type DatabaseEngineConfig interface {
+	PostgreSQLConfig | MySQLConfig | RedisConfig | ValkeyConfig | MongoDBConfig | OpensearchConfig | KafkaConfig
+}
+
+// DatabaseConfigChange is a single setting changed by a config patch.
+type DatabaseConfigChange struct {
+	// Field is the JSON name of the setting, with nested settings joined by
+	// a dot, e.g. "pgbouncer.min_pool_size".
+	Field string
+	// Old is the current value, empty when the setting is unset.
+	Old string
+	New string
+}
+
+// DatabaseConfigDiff is the result of comparing a config with a patch.
+type DatabaseConfigDiff struct {
+	Changes []*DatabaseConfigChange
+}
+
+// HasChanges reports whether the diff contains any changes.
+func (d *DatabaseConfigDiff) HasChanges() bool {
+	return d != nil && len(d.Changes) > 0
+}
+
+// String renders the diff in a human-readable form, one change per line.
+func (d *DatabaseConfigDiff) String() string {
+	if !d.HasChanges() {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	for _, c := range d.Changes {
+		if c.Old == "" {
+			fmt.Fprintf(&b, "+ %s: %s\n", c.Field, c.New)
+		} else {
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", c.Field, c.Old, c.New)
+		}
+	}
+	return b.String()
+}
+
+// DiffDatabaseConfig compares a partial config with the current one. It
+// returns the settings of patch that differ from current, and a config
+// holding only those settings, suitable for the engine's Update*Config
+// method. Settings left nil in patch are ignored.
+func DiffDatabaseConfig[T DatabaseEngineConfig](current, patch *T) (*DatabaseConfigDiff, *T) {
+	diff := &DatabaseConfigDiff{}
+	changed := new(T)
+	if patch == nil {
+		return diff, changed
+	}
+	if current == nil {
+		current = new(T)
+	}
+	diffConfigStruct(diff, "", reflect.ValueOf(current).Elem(), reflect.ValueOf(patch).Elem(), reflect.ValueOf(changed).Elem())
+	return diff, changed
+}
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+func diffConfigStruct(diff *DatabaseConfigDiff, prefix string, current, patch, changed reflect.Value) {
+	t := patch.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonFieldName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		p := patch.Field(i)
+		if p.IsNil() {
+			continue
+		}
+		c := current.Field(i)
+		path := prefix + name
+
+		// Nested settings, such as pgbouncer, are compared field by field.
+		if p.Kind() == reflect.Ptr && p.Elem().Kind() == reflect.Struct && p.Elem().Type() != bigIntType {
+			if c.IsNil() {
+				c = reflect.New(p.Elem().Type())
+			}
+			nested := reflect.New(p.Elem().Type())
+			before := len(diff.Changes)
+			diffConfigStruct(diff, path+".", c.Elem(), p.Elem(), nested.Elem())
+			if len(diff.Changes) > before {
+				changed.Field(i).Set(nested)
+			}
+			continue
+		}
+
+		if configValuesEqual(c, p) {
+			continue
+		}
+		change := &DatabaseConfigChange{Field: path, New: renderConfigValue(p)}
+		if !c.IsNil() {
+			change.Old = renderConfigValue(c)
+		}
+		diff.Changes = append(diff.Changes, change)
+		changed.Field(i).Set(p)
+	}
+}
+
+func configValuesEqual(current, patch reflect.Value) bool {
+	if current.IsNil() {
+		return false
+	}
+	if patch.Type().Elem() == bigIntType {
+		return current.Interface().(*big.Int).Cmp(patch.Interface().(*big.Int)) == 0
+	}
+	return reflect.DeepEqual(current.Interface(), patch.Interface())
+}
+
+func renderConfigValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr && v.Type().Elem() != bigIntType {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// PatchDatabaseConfigOptions configures PatchDatabaseConfig.
+type PatchDatabaseConfigOptions struct {
+	// DryRun computes the diff without updating the config.
+	DryRun bool
+}
+
+// PatchDatabaseConfig fetches the config of a database cluster, compares it
+// with a partial config and sends only the settings that changed. The diff
+// is returned whether or not the update was made. Nothing is sent when the
+// diff is empty.
+func PatchDatabaseConfig[T DatabaseEngineConfig](ctx context.Context, client *Client, databaseID string, patch *T, opts *PatchDatabaseConfigOptions) (*DatabaseConfigDiff, error) {
+	if databaseID == "" {
+		return nil, NewArgError("databaseID", "cannot be empty")
+	}
+	if patch == nil {
+		return nil, NewArgError("patch", "cannot be nil")
+	}
+
+	current, err := getDatabaseConfig[T](ctx, client, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	diff, changed := DiffDatabaseConfig(current, patch)
+	if !diff.HasChanges() || (opts != nil && opts.DryRun) {
+		return diff, nil
+	}
+	if err := updateDatabaseConfig(ctx, client, databaseID, changed); err != nil {
+		return diff, err
+	}
+	return diff, nil
+}
+
+func getDatabaseConfig[T DatabaseEngineConfig](ctx context.Context, client *Client, databaseID string) (*T, error) {
+	var (
+		cfg interface{}
+		err error
+	)
+	switch any(new(T)).(type) {
+	case *PostgreSQLConfig:
+		cfg, _, err = client.Databases.GetPostgreSQLConfig(ctx, databaseID)
+	case *MySQLConfig:
+		cfg, _, err = client.Databases.GetMySQLConfig(ctx, databaseID)
+	case *RedisConfig:
+		cfg, _, err = client.Databases.GetRedisConfig(ctx, databaseID)
+	case *ValkeyConfig:
+		cfg, _, err = client.Databases.GetValkeyConfig(ctx, databaseID)
+	case *MongoDBConfig:
+		cfg, _, err = client.Databases.GetMongoDBConfig(ctx, databaseID)
+	case *OpensearchConfig:
+		cfg, _, err = client.Databases.GetOpensearchConfig(ctx, databaseID)
+	case *KafkaConfig:
+		cfg, _, err = client.Databases.GetKafkaConfig(ctx, databaseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg.(*T), nil
+}
+
+func updateDatabaseConfig[T DatabaseEngineConfig](ctx context.Context, client *Client, databaseID string, cfg *T) error {
+	var err error
+	switch cfg := any(cfg).(type) {
+	case *PostgreSQLConfig:
+		_, err = client.Databases.UpdatePostgreSQLConfig(ctx, databaseID, cfg)
+	case *MySQLConfig:
+		_, err = client.Databases.UpdateMySQLConfig(ctx, databaseID, cfg)
+	case *RedisConfig:
+		_, err = client.Databases.UpdateRedisConfig(ctx, databaseID, cfg)
+	case *ValkeyConfig:
+		_, err = client.Databases.UpdateValkeyConfig(ctx, databaseID, cfg)
+	case *MongoDBConfig:
+		_, err = client.Databases.UpdateMongoDBConfig(ctx, databaseID, cfg)
+	case *OpensearchConfig:
+		_, err = client.Databases.UpdateOpensearchConfig(ctx, databaseID, cfg)
+	case *KafkaConfig:
+		_, err = client.Databases.UpdateKafkaConfig(ctx, databaseID, cfg)
+	}
+	return err
+}
+
+// databaseConfigEngine returns the engine slug of a config type.
+func databaseConfigEngine[T DatabaseEngineConfig]() string {
+	switch any(new(T)).(type) {
+	case *PostgreSQLConfig:
+		return DatabaseEnginePostgres
+	case *MySQLConfig:
+		return DatabaseEngineMySQL
+	case *RedisConfig:
+		return DatabaseEngineRedis
+	case *ValkeyConfig:
+		return DatabaseEngineValkey
+	case *MongoDBConfig:
+		return DatabaseEngineMongoDB
+	case *OpensearchConfig:
+		return DatabaseEngineOpenSearch
+	case *KafkaConfig:
+		return DatabaseEngineKafka
+	}
+	return ""
+}
+
+// databaseConfigDocument is the YAML layout used by ExportDatabaseConfigYAML.
+type databaseConfigDocument struct {
+	Engine string                 `yaml:"engine"`
+	Config map[string]interface{} `yaml:"config"`
+}
+
+// ExportDatabaseConfigYAML writes a config as a YAML document with the
+// engine slug and the settings that are set, keyed by their API names in
+// sorted order, so that exports of the same config are identical.
+func ExportDatabaseConfigYAML[T DatabaseEngineConfig](w io.Writer, cfg *T) error {
+	if cfg == nil {
+		return NewArgError("cfg", "cannot be nil")
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var settings map[string]interface{}
+	if err := dec.Decode(&settings); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&databaseConfigDocument{
+		Engine: databaseConfigEngine[T](),
+		Config: yamlNumbers(settings).(map[string]interface{}),
+	}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ImportDatabaseConfigYAML reads a config written by ExportDatabaseConfigYAML.
+// The engine of the document must match T, and unknown settings are
+// rejected so that typos don't go unnoticed.
+func ImportDatabaseConfigYAML[T DatabaseEngineConfig](r io.Reader) (*T, error) {
+	var doc databaseConfigDocument
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("godo: decoding database config: %w", err)
+	}
+	if engine := databaseConfigEngine[T](); doc.Engine != engine {
+		return nil, fmt.Errorf("godo: database config is for engine %q, not %q", doc.Engine, engine)
+	}
+
+	b, err := json.Marshal(doc.Config)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(T)
+	jsonDec := json.NewDecoder(bytes.NewReader(b))
+	jsonDec.DisallowUnknownFields()
+	if err := jsonDec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("godo: decoding database config: %w", err)
+	}
+	return cfg, nil
+}
+
+// yamlNumbers replaces the json.Number values of a decoded JSON document
+// with integers or floats, which the YAML encoder renders as numbers.
+func yamlNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = yamlNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlNumbers(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if n, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: n.String()}
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
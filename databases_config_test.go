@@ -0,0 +1,121 @@
+package godo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffDatabaseConfig(t *testing.T) {
+	current := &PostgreSQLConfig{
+		WorkMem:               PtrTo(4),
+		DeadlockTimeoutMillis: PtrTo(100),
+		PgBouncer:             &PostgreSQLBouncerConfig{MinPoolSize: PtrTo(0)},
+	}
+	patch := &PostgreSQLConfig{
+		WorkMem:               PtrTo(4),
+		DeadlockTimeoutMillis: PtrTo(200),
+		JIT:                   PtrTo(true),
+		PgBouncer: &PostgreSQLBouncerConfig{
+			MinPoolSize:             PtrTo(5),
+			IgnoreStartupParameters: &[]string{"extra_float_digits"},
+		},
+	}
+
+	diff, changed := DiffDatabaseConfig(current, patch)
+	assert.Equal(t, "~ deadlock_timeout: 100 -> 200\n"+
+		"+ jit: true\n"+
+		"+ pgbouncer.ignore_startup_parameters: [extra_float_digits]\n"+
+		"~ pgbouncer.min_pool_size: 0 -> 5\n", diff.String())
+	assert.Equal(t, &PostgreSQLConfig{
+		DeadlockTimeoutMillis: PtrTo(200),
+		JIT:                   PtrTo(true),
+		PgBouncer: &PostgreSQLBouncerConfig{
+			MinPoolSize:             PtrTo(5),
+			IgnoreStartupParameters: &[]string{"extra_float_digits"},
+		},
+	}, changed)
+
+	diff, changed = DiffDatabaseConfig(current, &PostgreSQLConfig{WorkMem: PtrTo(4), PgBouncer: &PostgreSQLBouncerConfig{MinPoolSize: PtrTo(0)}})
+	assert.False(t, diff.HasChanges())
+	assert.Equal(t, &PostgreSQLConfig{}, changed)
+}
+
+func TestDiffDatabaseConfig_BigInt(t *testing.T) {
+	current := &KafkaConfig{LogRetentionBytes: big.NewInt(1000)}
+	diff, _ := DiffDatabaseConfig(current, &KafkaConfig{LogRetentionBytes: big.NewInt(1000)})
+	assert.False(t, diff.HasChanges())
+
+	diff, _ = DiffDatabaseConfig(current, &KafkaConfig{LogRetentionBytes: big.NewInt(-1)})
+	assert.Equal(t, "~ log_retention_bytes: 1000 -> -1\n", diff.String())
+}
+
+func TestPatchDatabaseConfig(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var patches []string
+	mux.HandleFunc("/v2/databases/db-id/config", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"config": {"redis_maxmemory_policy": "allkeys-lru", "redis_timeout": 300}}`)
+		case http.MethodPatch:
+			b, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			patches = append(patches, strings.TrimSpace(string(b)))
+		}
+	})
+
+	diff, err := PatchDatabaseConfig(ctx, client, "db-id", &RedisConfig{
+		RedisMaxmemoryPolicy: PtrTo("allkeys-lru"),
+		RedisTimeout:         PtrTo(600),
+	}, &PatchDatabaseConfigOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, "~ redis_timeout: 300 -> 600\n", diff.String())
+	assert.Empty(t, patches)
+
+	_, err = PatchDatabaseConfig(ctx, client, "db-id", &RedisConfig{
+		RedisMaxmemoryPolicy: PtrTo("allkeys-lru"),
+		RedisTimeout:         PtrTo(600),
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"config":{"redis_timeout":600}}`}, patches)
+
+	_, err = PatchDatabaseConfig(ctx, client, "db-id", &RedisConfig{RedisTimeout: PtrTo(300)}, nil)
+	require.NoError(t, err)
+	assert.Len(t, patches, 1)
+}
+
+func TestDatabaseConfigYAML(t *testing.T) {
+	cfg := &KafkaConfig{
+		MessageMaxBytes:        PtrTo(1048588),
+		AutoCreateTopicsEnable: PtrTo(false),
+		LogRetentionBytes:      new(big.Int).SetUint64(1 << 63),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportDatabaseConfigYAML(&buf, cfg))
+	assert.Equal(t, `engine: kafka
+config:
+  auto_create_topics_enable: false
+  log_retention_bytes: 9223372036854775808
+  message_max_bytes: 1048588
+`, buf.String())
+
+	imported, err := ImportDatabaseConfigYAML[KafkaConfig](bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, cfg, imported)
+
+	_, err = ImportDatabaseConfigYAML[RedisConfig](bytes.NewReader(buf.Bytes()))
+	assert.ErrorContains(t, err, `engine "kafka"`)
+
+	_, err = ImportDatabaseConfigYAML[KafkaConfig](strings.NewReader("engine: kafka\nconfig:\n  message_max_byte: 1\n"))
+	assert.ErrorContains(t, err, "message_max_byte")
+}
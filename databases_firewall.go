@@ -0,0 +1,293 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of database firewall rules.
+const (
+	DatabaseFirewallRuleIPAddr     = "ip_addr"
+	DatabaseFirewallRuleDroplet    = "droplet"
+	DatabaseFirewallRuleKubernetes = "k8s"
+	DatabaseFirewallRuleTag        = "tag"
+	DatabaseFirewallRuleApp        = "app"
+)
+
+const defaultDatabaseFirewallAttempts = 3
+
+// DatabaseFirewallManager makes incremental changes to the firewall rules
+// (trusted sources) of a database cluster. The API only supports replacing
+// the whole rule list, so every change is a read-modify-write that is
+// verified by reading the rules back and retried if a concurrent writer
+// overwrote it.
+//
+// A DatabaseFirewallManager is safe for concurrent use.
+type DatabaseFirewallManager struct {
+	client     *Client
+	databaseID string
+
+	// MaxAttempts is the number of times a change is attempted before
+	// giving up. Defaults to three.
+	MaxAttempts int
+
+	mu sync.Mutex
+	// tagged holds, for each tag synced with SyncTag, the IDs of the
+	// droplets whose rules were added by the last sync.
+	tagged map[string]map[string]bool
+}
+
+// NewDatabaseFirewallManager returns a DatabaseFirewallManager for a database cluster.
+func NewDatabaseFirewallManager(client *Client, databaseID string) *DatabaseFirewallManager {
+	return &DatabaseFirewallManager{
+		client:     client,
+		databaseID: databaseID,
+		tagged:     make(map[string]map[string]bool),
+	}
+}
+
+// AddRules adds rules to the cluster's firewall, skipping those already
+// present, and returns the resulting rules. Only the Type and Value of the
+// given rules are used. ip_addr values must be IP addresses or CIDR blocks.
+// droplet values that are not IDs are resolved as droplet names and k8s
+// values that are not IDs as Kubernetes cluster names.
+func (m *DatabaseFirewallManager) AddRules(ctx context.Context, rules ...*DatabaseFirewallRule) ([]DatabaseFirewallRule, error) {
+	add, err := m.resolveRules(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.modify(ctx, add, nil)
+}
+
+// RemoveRules removes rules from the cluster's firewall and returns the
+// resulting rules. Rules that aren't present are ignored. Values are
+// resolved as for AddRules.
+func (m *DatabaseFirewallManager) RemoveRules(ctx context.Context, rules ...*DatabaseFirewallRule) ([]DatabaseFirewallRule, error) {
+	remove, err := m.resolveRules(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.modify(ctx, nil, remove)
+}
+
+// SyncTag adds a droplet rule for every droplet with the given tag and
+// removes the droplet rules added by the previous SyncTag call for droplets
+// that no longer have it. Droplet rules that were not added by SyncTag, for
+// example before a restart, are never removed.
+//
+// Unlike a tag rule, which the cluster applies to all tagged resources, this
+// produces explicit droplet rules, which are listed individually.
+func (m *DatabaseFirewallManager) SyncTag(ctx context.Context, tag string) ([]DatabaseFirewallRule, error) {
+	if tag == "" {
+		return nil, NewArgError("tag", "cannot be empty")
+	}
+	droplets, err := collectPages(func(opt *ListOptions) ([]Droplet, *Response, error) {
+		return m.client.Droplets.ListByTag(ctx, tag, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]bool, len(droplets))
+	var add, remove []*DatabaseFirewallRule
+	for _, d := range droplets {
+		id := strconv.Itoa(d.ID)
+		current[id] = true
+		add = append(add, &DatabaseFirewallRule{Type: DatabaseFirewallRuleDroplet, Value: id})
+	}
+	for id := range m.tagged[tag] {
+		if !current[id] {
+			remove = append(remove, &DatabaseFirewallRule{Type: DatabaseFirewallRuleDroplet, Value: id})
+		}
+	}
+
+	rules, err := m.modify(ctx, add, remove)
+	if err != nil {
+		return nil, err
+	}
+	m.tagged[tag] = current
+	return rules, nil
+}
+
+// WatchTag calls SyncTag every interval until ctx is done. Errors are passed
+// to onErr, if not nil, and don't stop the watch. It returns ctx's error.
+func (m *DatabaseFirewallManager) WatchTag(ctx context.Context, tag string, interval time.Duration, onErr func(error)) error {
+	if interval <= 0 {
+		return NewArgError("interval", "must be greater than 0")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.SyncTag(ctx, tag); err != nil && ctx.Err() == nil && onErr != nil {
+			onErr(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// modify applies the additions and removals to the live rules, writes them
+// back and checks that they were persisted. It must be called with m.mu held.
+func (m *DatabaseFirewallManager) modify(ctx context.Context, add, remove []*DatabaseFirewallRule) ([]DatabaseFirewallRule, error) {
+	attempts := m.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultDatabaseFirewallAttempts
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, r := range remove {
+		removed[databaseFirewallRuleKey(r)] = true
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		live, _, err := m.client.Databases.GetFirewallRules(ctx, m.databaseID)
+		if err != nil {
+			return nil, err
+		}
+		if databaseFirewallRulesApplied(live, add, removed) {
+			return live, nil
+		}
+
+		next := make([]*DatabaseFirewallRule, 0, len(live)+len(add))
+		seen := make(map[string]bool, len(live)+len(add))
+		for i := range live {
+			key := databaseFirewallRuleKey(&live[i])
+			if removed[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			next = append(next, &live[i])
+		}
+		for _, r := range add {
+			key := databaseFirewallRuleKey(r)
+			if removed[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			next = append(next, &DatabaseFirewallRule{Type: r.Type, Value: r.Value})
+		}
+
+		if _, err := m.client.Databases.UpdateFirewallRules(ctx, m.databaseID, &DatabaseUpdateFirewallRulesRequest{Rules: next}); err != nil {
+			return nil, err
+		}
+
+		written, _, err := m.client.Databases.GetFirewallRules(ctx, m.databaseID)
+		if err != nil {
+			return nil, err
+		}
+		if databaseFirewallRulesApplied(written, add, removed) {
+			return written, nil
+		}
+	}
+	return nil, fmt.Errorf("godo: firewall rules of database %s were modified concurrently %d times", m.databaseID, attempts)
+}
+
+func databaseFirewallRulesApplied(rules []DatabaseFirewallRule, add []*DatabaseFirewallRule, removed map[string]bool) bool {
+	present := make(map[string]bool, len(rules))
+	for i := range rules {
+		key := databaseFirewallRuleKey(&rules[i])
+		if removed[key] {
+			return false
+		}
+		present[key] = true
+	}
+	for _, r := range add {
+		key := databaseFirewallRuleKey(r)
+		if !removed[key] && !present[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// databaseFirewallRuleKey identifies a rule by its type and value. IP
+// addresses and CIDR blocks are normalized, so that 10.0.0.1 and
+// 10.0.0.1/32 are the same rule.
+func databaseFirewallRuleKey(r *DatabaseFirewallRule) string {
+	value := r.Value
+	if r.Type == DatabaseFirewallRuleIPAddr {
+		if p, err := parseFirewallPrefix(value); err == nil {
+			value = p.String()
+		}
+	}
+	return r.Type + ":" + value
+}
+
+// resolveRules validates rules and resolves droplet and Kubernetes cluster
+// names to IDs.
+func (m *DatabaseFirewallManager) resolveRules(ctx context.Context, rules []*DatabaseFirewallRule) ([]*DatabaseFirewallRule, error) {
+	var clusters []*KubernetesCluster
+	resolved := make([]*DatabaseFirewallRule, 0, len(rules))
+	for _, r := range rules {
+		if r == nil || r.Value == "" {
+			return nil, NewArgError("rules", "must have a value")
+		}
+		switch r.Type {
+		case DatabaseFirewallRuleIPAddr:
+			if _, err := parseFirewallPrefix(r.Value); err != nil {
+				return nil, NewArgError("rules", fmt.Sprintf("%q is not an IP address or CIDR block", r.Value))
+			}
+			resolved = append(resolved, &DatabaseFirewallRule{Type: r.Type, Value: r.Value})
+
+		case DatabaseFirewallRuleDroplet:
+			if _, err := strconv.Atoi(r.Value); err == nil {
+				resolved = append(resolved, &DatabaseFirewallRule{Type: r.Type, Value: r.Value})
+				continue
+			}
+			droplets, err := collectPages(func(opt *ListOptions) ([]Droplet, *Response, error) {
+				return m.client.Droplets.ListByName(ctx, r.Value, opt)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(droplets) == 0 {
+				return nil, NewArgError("rules", fmt.Sprintf("no droplet named %q", r.Value))
+			}
+			// Droplet names aren't unique; every droplet with the name is allowed.
+			for _, d := range droplets {
+				resolved = append(resolved, &DatabaseFirewallRule{Type: r.Type, Value: strconv.Itoa(d.ID)})
+			}
+
+		case DatabaseFirewallRuleKubernetes:
+			if clusters == nil {
+				var err error
+				clusters, err = collectPages(func(opt *ListOptions) ([]*KubernetesCluster, *Response, error) {
+					return m.client.Kubernetes.List(ctx, opt)
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			id := ""
+			for _, c := range clusters {
+				if c.ID == r.Value || c.Name == r.Value {
+					id = c.ID
+					break
+				}
+			}
+			if id == "" {
+				return nil, NewArgError("rules", fmt.Sprintf("no Kubernetes cluster %q", r.Value))
+			}
+			resolved = append(resolved, &DatabaseFirewallRule{Type: r.Type, Value: id})
+
+		case DatabaseFirewallRuleTag, DatabaseFirewallRuleApp:
+			resolved = append(resolved, &DatabaseFirewallRule{Type: r.Type, Value: r.Value})
+
+		default:
+			return nil, NewArgError("rules", fmt.Sprintf("unknown rule type %q", r.Type))
+		}
+	}
+	return resolved, nil
+}
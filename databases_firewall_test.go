@@ -0,0 +1,154 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseFirewall serves the firewall rules of database db-id from memory.
+type testDatabaseFirewall struct {
+	mu     sync.Mutex
+	rules  []DatabaseFirewallRule
+	writes int
+	// clobber, if set, is called after each write and may overwrite the rules
+	// to simulate a concurrent writer.
+	clobber func(rules []DatabaseFirewallRule) []DatabaseFirewallRule
+}
+
+func serveTestDatabaseFirewall(t *testing.T, rules ...DatabaseFirewallRule) *testDatabaseFirewall {
+	fw := &testDatabaseFirewall{rules: rules}
+	mux.HandleFunc("/v2/databases/db-id/firewall", func(w http.ResponseWriter, r *http.Request) {
+		fw.mu.Lock()
+		defer fw.mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]interface{}{"rules": fw.rules})
+		case http.MethodPut:
+			var req DatabaseUpdateFirewallRulesRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			fw.rules = nil
+			for _, rule := range req.Rules {
+				fw.rules = append(fw.rules, DatabaseFirewallRule{Type: rule.Type, Value: rule.Value})
+			}
+			fw.writes++
+			if fw.clobber != nil {
+				fw.rules = fw.clobber(fw.rules)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return fw
+}
+
+func firewallRuleValues(rules []DatabaseFirewallRule) []string {
+	var values []string
+	for _, r := range rules {
+		values = append(values, r.Type+":"+r.Value)
+	}
+	return values
+}
+
+func TestDatabaseFirewallManager_AddRules(t *testing.T) {
+	setup()
+	defer teardown()
+
+	fw := serveTestDatabaseFirewall(t, DatabaseFirewallRule{Type: "ip_addr", Value: "10.0.0.1"})
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "worker", r.URL.Query().Get("name"))
+		fmt.Fprint(w, `{"droplets": [{"id": 11, "name": "worker"}, {"id": 12, "name": "worker"}]}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_clusters": [{"id": "k8s-uuid", "name": "prod"}]}`)
+	})
+
+	m := NewDatabaseFirewallManager(client, "db-id")
+	rules, err := m.AddRules(ctx,
+		&DatabaseFirewallRule{Type: "ip_addr", Value: "10.0.0.1/32"},
+		&DatabaseFirewallRule{Type: "ip_addr", Value: "192.168.0.0/16"},
+		&DatabaseFirewallRule{Type: "droplet", Value: "worker"},
+		&DatabaseFirewallRule{Type: "k8s", Value: "prod"},
+		&DatabaseFirewallRule{Type: "droplet", Value: "12"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ip_addr:10.0.0.1",
+		"ip_addr:192.168.0.0/16",
+		"droplet:11",
+		"droplet:12",
+		"k8s:k8s-uuid",
+	}, firewallRuleValues(rules))
+	assert.Equal(t, 1, fw.writes)
+
+	// Adding rules that are already present doesn't write.
+	_, err = m.AddRules(ctx, &DatabaseFirewallRule{Type: "ip_addr", Value: "192.168.1.0/16"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, fw.writes)
+
+	rules, err = m.RemoveRules(ctx, &DatabaseFirewallRule{Type: "droplet", Value: "worker"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ip_addr:10.0.0.1", "ip_addr:192.168.0.0/16", "k8s:k8s-uuid"}, firewallRuleValues(rules))
+}
+
+func TestDatabaseFirewallManager_InvalidRules(t *testing.T) {
+	setup()
+	defer teardown()
+
+	m := NewDatabaseFirewallManager(client, "db-id")
+	_, err := m.AddRules(ctx, &DatabaseFirewallRule{Type: "ip_addr", Value: "10.0.0.300"})
+	assert.Error(t, err)
+	_, err = m.AddRules(ctx, &DatabaseFirewallRule{Type: "vpc", Value: "x"})
+	assert.Error(t, err)
+}
+
+func TestDatabaseFirewallManager_ConcurrentWriter(t *testing.T) {
+	setup()
+	defer teardown()
+
+	fw := serveTestDatabaseFirewall(t)
+	clobbered := false
+	fw.clobber = func(rules []DatabaseFirewallRule) []DatabaseFirewallRule {
+		if clobbered {
+			return rules
+		}
+		clobbered = true
+		return []DatabaseFirewallRule{{Type: "tag", Value: "other"}}
+	}
+
+	m := NewDatabaseFirewallManager(client, "db-id")
+	rules, err := m.AddRules(ctx, &DatabaseFirewallRule{Type: "app", Value: "app-id"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag:other", "app:app-id"}, firewallRuleValues(rules))
+	assert.Equal(t, 2, fw.writes)
+
+	fw.clobber = func([]DatabaseFirewallRule) []DatabaseFirewallRule { return nil }
+	_, err = m.AddRules(ctx, &DatabaseFirewallRule{Type: "tag", Value: "web"})
+	assert.Error(t, err)
+}
+
+func TestDatabaseFirewallManager_SyncTag(t *testing.T) {
+	setup()
+	defer teardown()
+
+	serveTestDatabaseFirewall(t, DatabaseFirewallRule{Type: "droplet", Value: "99"})
+	tagged := `[{"id": 1}, {"id": 2}]`
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "web", r.URL.Query().Get("tag_name"))
+		fmt.Fprintf(w, `{"droplets": %s}`, tagged)
+	})
+
+	m := NewDatabaseFirewallManager(client, "db-id")
+	rules, err := m.SyncTag(ctx, "web")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"droplet:99", "droplet:1", "droplet:2"}, firewallRuleValues(rules))
+
+	tagged = `[{"id": 2}, {"id": 3}]`
+	rules, err = m.SyncTag(ctx, "web")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"droplet:99", "droplet:2", "droplet:3"}, firewallRuleValues(rules))
+}
@@ -0,0 +1,309 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Statuses of a database cluster.
+const (
+	DatabaseStatusCreating = "creating"
+	DatabaseStatusOnline   = "online"
+)
+
+const defaultDatabasePollInterval = 10 * time.Second
+
+// ForkDatabaseOptions configures ForkDatabase. Fields left empty are copied
+// from the source cluster, except PrivateNetworkUUID when the fork is
+// created in another region.
+type ForkDatabaseOptions struct {
+	// Name defaults to the source name followed by "-fork-" and the backup
+	// time.
+	Name               string
+	SizeSlug           string
+	NumNodes           int
+	Region             string
+	PrivateNetworkUUID string
+	Version            string
+	Tags               []string
+	ProjectID          string
+
+	// CopyFirewallRules creates the fork with the source's trusted sources.
+	CopyFirewallRules bool
+	// CopyUsers creates the source's users that the fork doesn't have. The
+	// new users get new credentials.
+	CopyUsers bool
+	// CopyPools creates the source's connection pools on the fork. Pools
+	// whose user doesn't exist on the fork are skipped, so CopyUsers is
+	// usually set too.
+	CopyPools bool
+
+	// PollInterval is the delay between checks of the fork's status.
+	// Defaults to ten seconds.
+	PollInterval time.Duration
+}
+
+// ForkDatabaseResult describes a cluster created by ForkDatabase.
+type ForkDatabaseResult struct {
+	// Database is the fork, as of when it came online.
+	Database *Database
+	// Backup is the source backup the fork was restored from.
+	Backup *DatabaseBackup
+	// Users and Pools are the users and pools created on the fork.
+	Users []*DatabaseUser
+	Pools []*DatabasePool
+	// SkippedPools are the source's pools that weren't created because their
+	// user doesn't exist on the fork.
+	SkippedPools []*DatabasePool
+}
+
+// ForkDatabase creates a new cluster from the most recent backup of the
+// source cluster taken at or before at, and waits for it to come online. A
+// zero at selects the latest backup.
+//
+// When the fork can't be brought online, or copying users or pools fails,
+// the partial result is returned with the error; the fork is not deleted.
+func ForkDatabase(ctx context.Context, client *Client, sourceID string, at time.Time, opts *ForkDatabaseOptions) (*ForkDatabaseResult, error) {
+	if sourceID == "" {
+		return nil, NewArgError("sourceID", "cannot be empty")
+	}
+	if opts == nil {
+		opts = &ForkDatabaseOptions{}
+	}
+
+	source, _, err := client.Databases.Get(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	backups, err := collectPages(func(opt *ListOptions) ([]DatabaseBackup, *Response, error) {
+		return client.Databases.ListBackups(ctx, sourceID, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	backup := selectDatabaseBackup(backups, at)
+	if backup == nil {
+		if at.IsZero() {
+			return nil, fmt.Errorf("godo: database %s has no backups", sourceID)
+		}
+		return nil, fmt.Errorf("godo: database %s has no backup taken at or before %s", sourceID, at.Format(time.RFC3339))
+	}
+
+	req := forkDatabaseCreateRequest(source, backup, opts)
+	if opts.CopyFirewallRules {
+		rules, _, err := client.Databases.GetFirewallRules(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			req.Rules = append(req.Rules, &DatabaseCreateFirewallRule{Type: r.Type, Value: r.Value})
+		}
+	}
+
+	fork, _, err := client.Databases.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	result := &ForkDatabaseResult{Database: fork, Backup: backup}
+
+	fork, err = waitForDatabaseOnline(ctx, client, fork.ID, opts.PollInterval)
+	if err != nil {
+		return result, err
+	}
+	result.Database = fork
+
+	if opts.CopyUsers {
+		if result.Users, err = copyDatabaseUsers(ctx, client, source.ID, fork.ID); err != nil {
+			return result, err
+		}
+	}
+	if opts.CopyPools {
+		if result.Pools, result.SkippedPools, err = copyDatabasePools(ctx, client, source.ID, fork.ID); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// selectDatabaseBackup returns the latest backup taken at or before at, or
+// the latest backup if at is zero.
+func selectDatabaseBackup(backups []DatabaseBackup, at time.Time) *DatabaseBackup {
+	var selected *DatabaseBackup
+	for i := range backups {
+		b := &backups[i]
+		if !at.IsZero() && b.CreatedAt.After(at) {
+			continue
+		}
+		if selected == nil || b.CreatedAt.After(selected.CreatedAt) {
+			selected = b
+		}
+	}
+	return selected
+}
+
+func forkDatabaseCreateRequest(source *Database, backup *DatabaseBackup, opts *ForkDatabaseOptions) *DatabaseCreateRequest {
+	req := &DatabaseCreateRequest{
+		Name:               opts.Name,
+		EngineSlug:         source.EngineSlug,
+		Version:            source.VersionSlug,
+		SizeSlug:           source.SizeSlug,
+		Region:             source.RegionSlug,
+		NumNodes:           source.NumNodes,
+		PrivateNetworkUUID: source.PrivateNetworkUUID,
+		Tags:               source.Tags,
+		ProjectID:          source.ProjectID,
+		StorageSizeMib:     source.StorageSizeMib,
+		BackupRestore: &DatabaseBackupRestore{
+			DatabaseName:    source.Name,
+			BackupCreatedAt: backup.CreatedAt.UTC().Format(time.RFC3339),
+		},
+	}
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("%s-fork-%s", source.Name, backup.CreatedAt.UTC().Format("20060102-150405"))
+	}
+	if opts.SizeSlug != "" {
+		req.SizeSlug = opts.SizeSlug
+	}
+	if opts.NumNodes > 0 {
+		req.NumNodes = opts.NumNodes
+	}
+	if opts.Region != "" && opts.Region != req.Region {
+		// The source's VPC is in another region, so the fork gets the
+		// default VPC of its region unless one is given.
+		req.Region = opts.Region
+		req.PrivateNetworkUUID = ""
+	}
+	if opts.PrivateNetworkUUID != "" {
+		req.PrivateNetworkUUID = opts.PrivateNetworkUUID
+	}
+	if opts.Version != "" {
+		req.Version = opts.Version
+	}
+	if opts.Tags != nil {
+		req.Tags = opts.Tags
+	}
+	if opts.ProjectID != "" {
+		req.ProjectID = opts.ProjectID
+	}
+	return req
+}
+
+// waitForDatabaseOnline polls a cluster until its status is online.
+func waitForDatabaseOnline(ctx context.Context, client *Client, databaseID string, interval time.Duration) (*Database, error) {
+	if interval <= 0 {
+		interval = defaultDatabasePollInterval
+	}
+	for {
+		db, _, err := client.Databases.Get(ctx, databaseID)
+		if err != nil {
+			return nil, err
+		}
+		switch db.Status {
+		case DatabaseStatusOnline:
+			return db, nil
+		case DatabaseStatusCreating, "":
+		default:
+			return db, fmt.Errorf("godo: database %s has status %s", databaseID, db.Status)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func copyDatabaseUsers(ctx context.Context, client *Client, sourceID, targetID string) ([]*DatabaseUser, error) {
+	sourceUsers, err := collectPages(func(opt *ListOptions) ([]DatabaseUser, *Response, error) {
+		return client.Databases.ListUsers(ctx, sourceID, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	targetUsers, err := collectPages(func(opt *ListOptions) ([]DatabaseUser, *Response, error) {
+		return client.Databases.ListUsers(ctx, targetID, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(targetUsers))
+	for _, u := range targetUsers {
+		existing[u.Name] = true
+	}
+
+	var created []*DatabaseUser
+	for _, u := range sourceUsers {
+		// The primary user is created with every cluster.
+		if existing[u.Name] || u.Role == "primary" {
+			continue
+		}
+		user, _, err := client.Databases.CreateUser(ctx, targetID, &DatabaseCreateUserRequest{
+			Name:          u.Name,
+			MySQLSettings: u.MySQLSettings,
+			Settings:      u.Settings,
+		})
+		if err != nil {
+			return created, fmt.Errorf("godo: copying user %s: %w", u.Name, err)
+		}
+		created = append(created, user)
+	}
+	return created, nil
+}
+
+// copyDatabasePools creates the pools of the source that the target doesn't
+// have. It returns the created pools and the pools skipped because their user
+// doesn't exist on the target.
+func copyDatabasePools(ctx context.Context, client *Client, sourceID, targetID string) ([]*DatabasePool, []*DatabasePool, error) {
+	sourcePools, err := collectPages(func(opt *ListOptions) ([]DatabasePool, *Response, error) {
+		return client.Databases.ListPools(ctx, sourceID, opt)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	targetPools, err := collectPages(func(opt *ListOptions) ([]DatabasePool, *Response, error) {
+		return client.Databases.ListPools(ctx, targetID, opt)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	targetUsers, err := collectPages(func(opt *ListOptions) ([]DatabaseUser, *Response, error) {
+		return client.Databases.ListUsers(ctx, targetID, opt)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := make(map[string]bool, len(targetPools))
+	for _, p := range targetPools {
+		existing[p.Name] = true
+	}
+	users := make(map[string]bool, len(targetUsers))
+	for _, u := range targetUsers {
+		users[u.Name] = true
+	}
+
+	var created, skipped []*DatabasePool
+	for _, p := range sourcePools {
+		if existing[p.Name] {
+			continue
+		}
+		// A pool without a user uses the credentials of the client.
+		if p.User != "" && !users[p.User] {
+			skipped = append(skipped, &p)
+			continue
+		}
+		pool, _, err := client.Databases.CreatePool(ctx, targetID, &DatabaseCreatePoolRequest{
+			User:     p.User,
+			Name:     p.Name,
+			Size:     p.Size,
+			Database: p.Database,
+			Mode:     p.Mode,
+		})
+		if err != nil {
+			return created, skipped, fmt.Errorf("godo: copying pool %s: %w", p.Name, err)
+		}
+		created = append(created, pool)
+	}
+	return created, skipped, nil
+}
@@ -0,0 +1,178 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectDatabaseBackup(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	backups := []DatabaseBackup{{CreatedAt: day(3)}, {CreatedAt: day(1)}, {CreatedAt: day(2)}}
+
+	assert.Equal(t, day(3), selectDatabaseBackup(backups, time.Time{}).CreatedAt)
+	assert.Equal(t, day(2), selectDatabaseBackup(backups, day(2).Add(12*time.Hour)).CreatedAt)
+	assert.Equal(t, day(1), selectDatabaseBackup(backups, day(1)).CreatedAt)
+	assert.Nil(t, selectDatabaseBackup(backups, day(1).Add(-time.Second)))
+}
+
+func TestForkDatabase(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/src-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"database": {"id": "src-id", "name": "main", "engine": "pg", "version": "16",
+			"size": "db-s-2vcpu-4gb", "region": "nyc3", "num_nodes": 2, "private_network_uuid": "vpc-id",
+			"tags": ["prod"], "project_id": "proj-id"}}`)
+	})
+	mux.HandleFunc("/v2/databases/src-id/backups", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"backups": [
+			{"created_at": "2024-03-01T00:00:00Z"}, {"created_at": "2024-03-02T00:00:00Z"}, {"created_at": "2024-03-03T00:00:00Z"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/databases/src-id/firewall", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rules": [{"uuid": "r1", "cluster_uuid": "src-id", "type": "tag", "value": "web"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/src-id/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"users": [{"name": "doadmin", "role": "primary"}, {"name": "app", "role": "normal"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/src-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"pools": [{"name": "app-pool", "user": "app", "size": 10, "db": "defaultdb", "mode": "transaction"}]}`)
+	})
+
+	var create DatabaseCreateRequest
+	mux.HandleFunc("/v2/databases", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&create))
+		fmt.Fprint(w, `{"database": {"id": "fork-id", "status": "creating"}}`)
+	})
+	polls := 0
+	mux.HandleFunc("/v2/databases/fork-id", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "creating"
+		if polls > 1 {
+			status = "online"
+		}
+		fmt.Fprintf(w, `{"database": {"id": "fork-id", "name": "main-fork", "status": %q}}`, status)
+	})
+	var createdUsers, createdPools []string
+	mux.HandleFunc("/v2/databases/fork-id/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			users := `{"name": "doadmin", "role": "primary"}`
+			for _, name := range createdUsers {
+				users += fmt.Sprintf(`, {"name": %q}`, name)
+			}
+			fmt.Fprintf(w, `{"users": [%s]}`, users)
+			return
+		}
+		var req DatabaseCreateUserRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		createdUsers = append(createdUsers, req.Name)
+		fmt.Fprintf(w, `{"user": {"name": %q, "password": "pass"}}`, req.Name)
+	})
+	mux.HandleFunc("/v2/databases/fork-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"pools": []}`)
+			return
+		}
+		var req DatabaseCreatePoolRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		createdPools = append(createdPools, req.Name)
+		fmt.Fprintf(w, `{"pool": {"name": %q}}`, req.Name)
+	})
+
+	result, err := ForkDatabase(ctx, client, "src-id", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), &ForkDatabaseOptions{
+		SizeSlug:          "db-s-1vcpu-2gb",
+		NumNodes:          1,
+		CopyFirewallRules: true,
+		CopyUsers:         true,
+		CopyPools:         true,
+		PollInterval:      time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, DatabaseCreateRequest{
+		Name:               "main-fork-20240302-000000",
+		EngineSlug:         "pg",
+		Version:            "16",
+		SizeSlug:           "db-s-1vcpu-2gb",
+		Region:             "nyc3",
+		NumNodes:           1,
+		PrivateNetworkUUID: "vpc-id",
+		Tags:               []string{"prod"},
+		ProjectID:          "proj-id",
+		BackupRestore:      &DatabaseBackupRestore{DatabaseName: "main", BackupCreatedAt: "2024-03-02T00:00:00Z"},
+		Rules:              []*DatabaseCreateFirewallRule{{Type: "tag", Value: "web"}},
+	}, create)
+	assert.Equal(t, "online", result.Database.Status)
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), result.Backup.CreatedAt)
+	assert.Equal(t, []string{"app"}, createdUsers)
+	assert.Equal(t, []string{"app-pool"}, createdPools)
+	assert.Len(t, result.Users, 1)
+	assert.Len(t, result.Pools, 1)
+}
+
+func TestForkDatabaseCreateRequest_Region(t *testing.T) {
+	source := &Database{Name: "main", RegionSlug: "nyc3", PrivateNetworkUUID: "vpc-nyc3"}
+	backup := &DatabaseBackup{CreatedAt: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)}
+
+	req := forkDatabaseCreateRequest(source, backup, &ForkDatabaseOptions{Region: "nyc3"})
+	assert.Equal(t, "vpc-nyc3", req.PrivateNetworkUUID)
+
+	req = forkDatabaseCreateRequest(source, backup, &ForkDatabaseOptions{Region: "ams3"})
+	assert.Equal(t, "ams3", req.Region)
+	assert.Empty(t, req.PrivateNetworkUUID)
+
+	req = forkDatabaseCreateRequest(source, backup, &ForkDatabaseOptions{Region: "ams3", PrivateNetworkUUID: "vpc-ams3"})
+	assert.Equal(t, "vpc-ams3", req.PrivateNetworkUUID)
+}
+
+func TestCopyDatabasePools_MissingUser(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/src-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"pools": [{"name": "app-pool", "user": "app"}, {"name": "admin-pool", "user": "doadmin"}, {"name": "inbound-pool"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/fork-id/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"users": [{"name": "doadmin", "role": "primary"}]}`)
+	})
+	var createdPools []string
+	mux.HandleFunc("/v2/databases/fork-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"pools": []}`)
+			return
+		}
+		var req DatabaseCreatePoolRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		createdPools = append(createdPools, req.Name)
+		fmt.Fprintf(w, `{"pool": {"name": %q}}`, req.Name)
+	})
+
+	created, skipped, err := copyDatabasePools(ctx, client, "src-id", "fork-id")
+	require.NoError(t, err)
+	assert.Len(t, created, 2)
+	assert.Equal(t, []string{"admin-pool", "inbound-pool"}, createdPools)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, "app-pool", skipped[0].Name)
+}
+
+func TestForkDatabase_NoBackup(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/src-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"database": {"id": "src-id", "name": "main"}}`)
+	})
+	mux.HandleFunc("/v2/databases/src-id/backups", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"backups": [{"created_at": "2024-03-03T00:00:00Z"}]}`)
+	})
+
+	_, err := ForkDatabase(ctx, client, "src-id", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), nil)
+	assert.ErrorContains(t, err, "no backup taken at or before")
+}
@@ -0,0 +1,466 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severities of a DatabaseInventoryFinding.
+const (
+	DatabaseFindingInfo     = "info"
+	DatabaseFindingWarning  = "warning"
+	DatabaseFindingCritical = "critical"
+)
+
+// Codes of a DatabaseInventoryFinding.
+const (
+	DatabaseFindingNoTrustedSources     = "no-trusted-sources"
+	DatabaseFindingSingleNodeProduction = "single-node-production"
+	DatabaseFindingAutoscaleNearFull    = "autoscale-disabled-near-capacity"
+	DatabaseFindingOutdatedVersion      = "outdated-version"
+	DatabaseFindingUnsupportedVersion   = "unsupported-version"
+	DatabaseFindingPendingUpdates       = "pending-updates"
+)
+
+const (
+	defaultInventoryEventLimit   = 10
+	defaultInventoryDiskCapacity = 80
+)
+
+// DatabaseInventoryOptions configures DatabaseInventory.
+type DatabaseInventoryOptions struct {
+	// ProductionTags are the tags that mark a cluster as production.
+	// Defaults to "production" and "prod".
+	ProductionTags []string
+	// DiskUsage holds the disk usage in percent of clusters, by cluster ID.
+	// The Monitoring API only has disk metrics for MySQL clusters, which are
+	// fetched when missing; other clusters without usage aren't checked for
+	// capacity.
+	DiskUsage map[string]float64
+	// CapacityPercent is the disk usage at which a cluster without storage
+	// autoscaling is flagged. Defaults to 80.
+	CapacityPercent float64
+	// EventLimit is the number of recent events reported per cluster.
+	// Defaults to 10.
+	EventLimit int
+}
+
+// DatabaseInventoryReport describes the database clusters of an account.
+// It holds no credentials and can be shared as JSON or Markdown.
+type DatabaseInventoryReport struct {
+	GeneratedAt time.Time                   `json:"generated_at"`
+	Clusters    []*DatabaseInventoryCluster `json:"clusters"`
+}
+
+// DatabaseInventoryCluster describes a database cluster and its risks.
+type DatabaseInventoryCluster struct {
+	ID                string                     `json:"id"`
+	Name              string                     `json:"name"`
+	Engine            string                     `json:"engine"`
+	Version           string                     `json:"version"`
+	LatestVersion     string                     `json:"latest_version,omitempty"`
+	Region            string                     `json:"region"`
+	Size              string                     `json:"size"`
+	NumNodes          int                        `json:"num_nodes"`
+	Status            string                     `json:"status"`
+	Tags              []string                   `json:"tags,omitempty"`
+	StorageSizeMib    uint64                     `json:"storage_size_mib,omitempty"`
+	StorageAutoscale  *DatabaseStorageAutoscale  `json:"storage_autoscale,omitempty"`
+	DiskUsagePercent  *float64                   `json:"disk_usage_percent,omitempty"`
+	MaintenanceWindow *DatabaseMaintenanceWindow `json:"maintenance_window,omitempty"`
+
+	Replicas      []DatabaseInventoryReplica `json:"replicas,omitempty"`
+	Pools         []DatabaseInventoryPool    `json:"pools,omitempty"`
+	Users         []DatabaseInventoryUser    `json:"users,omitempty"`
+	FirewallRules []DatabaseInventoryRule    `json:"firewall_rules"`
+	Events        []DatabaseEvent            `json:"events,omitempty"`
+
+	Findings []DatabaseInventoryFinding `json:"findings,omitempty"`
+	// Errors lists the details that couldn't be gathered.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DatabaseInventoryReplica is a read-only replica of a cluster.
+type DatabaseInventoryReplica struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	Size   string `json:"size"`
+	Status string `json:"status"`
+}
+
+// DatabaseInventoryPool is a connection pool of a cluster.
+type DatabaseInventoryPool struct {
+	Name     string `json:"name"`
+	User     string `json:"user"`
+	Database string `json:"db"`
+	Size     int    `json:"size"`
+	Mode     string `json:"mode"`
+}
+
+// DatabaseInventoryUser is a user of a cluster, without its credentials.
+type DatabaseInventoryUser struct {
+	Name string `json:"name"`
+	Role string `json:"role,omitempty"`
+}
+
+// DatabaseInventoryRule is a trusted source of a cluster.
+type DatabaseInventoryRule struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// DatabaseInventoryFinding is a risky state of a cluster.
+type DatabaseInventoryFinding struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// DatabaseInventory lists all database clusters and gathers their replicas,
+// pools, users, trusted sources, maintenance window, storage autoscaling and
+// recent events. Each cluster is checked for risky states: no trusted
+// sources, a single node in a production cluster, storage autoscaling
+// disabled near capacity, an outdated or unsupported version, and pending
+// updates.
+//
+// Failing to list the clusters or the engine options is an error. Failures
+// to gather the details of a cluster are recorded in its Errors instead, so
+// that one cluster doesn't prevent reporting on the others.
+func DatabaseInventory(ctx context.Context, client *Client, opts *DatabaseInventoryOptions) (*DatabaseInventoryReport, error) {
+	if opts == nil {
+		opts = &DatabaseInventoryOptions{}
+	}
+	dbs, err := collectPages(func(opt *ListOptions) ([]Database, *Response, error) {
+		return client.Databases.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	options, _, err := client.Databases.ListOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DatabaseInventoryReport{GeneratedAt: time.Now().UTC()}
+	for i := range dbs {
+		c := inventoryDatabase(ctx, client, &dbs[i], opts)
+		c.Findings = databaseFindings(&dbs[i], c, databaseEngineOptions(options, c.Engine), opts)
+		report.Clusters = append(report.Clusters, c)
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool { return report.Clusters[i].Name < report.Clusters[j].Name })
+	return report, nil
+}
+
+func inventoryDatabase(ctx context.Context, client *Client, db *Database, opts *DatabaseInventoryOptions) *DatabaseInventoryCluster {
+	c := &DatabaseInventoryCluster{
+		ID:                db.ID,
+		Name:              db.Name,
+		Engine:            db.EngineSlug,
+		Version:           db.VersionSlug,
+		Region:            db.RegionSlug,
+		Size:              db.SizeSlug,
+		NumNodes:          db.NumNodes,
+		Status:            db.Status,
+		Tags:              db.Tags,
+		StorageSizeMib:    db.StorageSizeMib,
+		StorageAutoscale:  db.StorageAutoscale,
+		MaintenanceWindow: db.MaintenanceWindow,
+		FirewallRules:     []DatabaseInventoryRule{},
+	}
+	addErr := func(what string, err error) {
+		c.Errors = append(c.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	switch db.EngineSlug {
+	case DatabaseEnginePostgres, DatabaseEngineMySQL, DatabaseEngineAdvancedPostgres, DatabaseEngineAdvancedMySQL:
+		replicas, err := collectPages(func(opt *ListOptions) ([]DatabaseReplica, *Response, error) {
+			return client.Databases.ListReplicas(ctx, db.ID, opt)
+		})
+		if err != nil {
+			addErr("replicas", err)
+		}
+		for _, r := range replicas {
+			c.Replicas = append(c.Replicas, DatabaseInventoryReplica{Name: r.Name, Region: r.Region, Size: r.Size, Status: r.Status})
+		}
+	}
+
+	switch db.EngineSlug {
+	case DatabaseEnginePostgres, DatabaseEngineAdvancedPostgres:
+		pools, err := collectPages(func(opt *ListOptions) ([]DatabasePool, *Response, error) {
+			return client.Databases.ListPools(ctx, db.ID, opt)
+		})
+		if err != nil {
+			addErr("pools", err)
+		}
+		for _, p := range pools {
+			c.Pools = append(c.Pools, DatabaseInventoryPool{Name: p.Name, User: p.User, Database: p.Database, Size: p.Size, Mode: p.Mode})
+		}
+	}
+
+	// Redis and Valkey clusters have a single default user.
+	if db.EngineSlug != DatabaseEngineRedis && db.EngineSlug != DatabaseEngineValkey {
+		users, err := collectPages(func(opt *ListOptions) ([]DatabaseUser, *Response, error) {
+			return client.Databases.ListUsers(ctx, db.ID, opt)
+		})
+		if err != nil {
+			addErr("users", err)
+		}
+		for _, u := range users {
+			c.Users = append(c.Users, DatabaseInventoryUser{Name: u.Name, Role: u.Role})
+		}
+	}
+
+	rules, _, err := client.Databases.GetFirewallRules(ctx, db.ID)
+	if err != nil {
+		addErr("firewall rules", err)
+		c.FirewallRules = nil
+	}
+	for _, r := range rules {
+		c.FirewallRules = append(c.FirewallRules, DatabaseInventoryRule{Type: r.Type, Value: r.Value})
+	}
+
+	limit := opts.EventLimit
+	if limit <= 0 {
+		limit = defaultInventoryEventLimit
+	}
+	events, _, err := client.Databases.ListDatabaseEvents(ctx, db.ID, &ListOptions{PerPage: limit})
+	if err != nil {
+		addErr("events", err)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreateTime > events[j].CreateTime })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	c.Events = events
+
+	if usage, ok := opts.DiskUsage[db.ID]; ok {
+		c.DiskUsagePercent = &usage
+	} else if db.EngineSlug == DatabaseEngineMySQL || db.EngineSlug == DatabaseEngineAdvancedMySQL {
+		usage, err := mysqlDiskUsage(ctx, client, db.ID)
+		if err != nil {
+			addErr("disk usage", err)
+		} else {
+			c.DiskUsagePercent = usage
+		}
+	}
+	return c
+}
+
+// mysqlDiskUsage returns the highest disk usage of a MySQL cluster over the
+// last hour, or nil when there are no samples.
+func mysqlDiskUsage(ctx context.Context, client *Client, databaseID string) (*float64, error) {
+	end := time.Now()
+	resp, _, err := client.Monitoring.GetDbaasMysqlDiskUsage(ctx, &DbaasMysqlDiskUsageRequest{
+		DbaasMysqlMetricsRequest: DbaasMysqlMetricsRequest{DBID: databaseID, Start: end.Add(-time.Hour), End: end},
+		Aggregate:                "max",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var usage *float64
+	for _, stream := range resp.Data.Result {
+		for _, s := range stream.Values {
+			if v := float64(s.Value); usage == nil || v > *usage {
+				usage = &v
+			}
+		}
+	}
+	return usage, nil
+}
+
+func databaseFindings(db *Database, c *DatabaseInventoryCluster, engine *DatabaseEngineOptions, opts *DatabaseInventoryOptions) []DatabaseInventoryFinding {
+	var findings []DatabaseInventoryFinding
+	add := func(severity, code, format string, args ...interface{}) {
+		findings = append(findings, DatabaseInventoryFinding{Severity: severity, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.FirewallRules != nil && len(c.FirewallRules) == 0 {
+		add(DatabaseFindingCritical, DatabaseFindingNoTrustedSources, "the cluster accepts connections from any source")
+	}
+
+	prodTags := opts.ProductionTags
+	if len(prodTags) == 0 {
+		prodTags = []string{"production", "prod"}
+	}
+	if db.NumNodes == 1 {
+		for _, tag := range db.Tags {
+			if containsFold(prodTags, tag) {
+				add(DatabaseFindingCritical, DatabaseFindingSingleNodeProduction, "the cluster is tagged %s but has no standby node", tag)
+				break
+			}
+		}
+	}
+
+	capacity := opts.CapacityPercent
+	if capacity <= 0 {
+		capacity = defaultInventoryDiskCapacity
+	}
+	autoscale := db.StorageAutoscale != nil && db.StorageAutoscale.Enabled
+	if !autoscale && c.DiskUsagePercent != nil && *c.DiskUsagePercent >= capacity {
+		add(DatabaseFindingWarning, DatabaseFindingAutoscaleNearFull, "disk usage is %.0f%% and storage autoscaling is disabled", *c.DiskUsagePercent)
+	}
+
+	if engine != nil && len(engine.Versions) > 0 {
+		latest := engine.Versions[0]
+		supported := false
+		for _, v := range engine.Versions {
+			if compareDatabaseVersions(v, latest) > 0 {
+				latest = v
+			}
+			supported = supported || v == db.VersionSlug
+		}
+		c.LatestVersion = latest
+		switch {
+		case !supported:
+			add(DatabaseFindingCritical, DatabaseFindingUnsupportedVersion, "version %s is no longer offered; the latest is %s", db.VersionSlug, latest)
+		case compareDatabaseVersions(db.VersionSlug, latest) < 0:
+			add(DatabaseFindingWarning, DatabaseFindingOutdatedVersion, "version %s is older than the latest, %s", db.VersionSlug, latest)
+		}
+	}
+
+	if mw := db.MaintenanceWindow; mw != nil && mw.Pending {
+		msg := "updates are pending"
+		if len(mw.Description) > 0 {
+			msg += ": " + strings.Join(mw.Description, "; ")
+		}
+		add(DatabaseFindingInfo, DatabaseFindingPendingUpdates, "%s", msg)
+	}
+	return findings
+}
+
+func databaseEngineOptions(options *DatabaseOptions, engine string) *DatabaseEngineOptions {
+	switch engine {
+	case DatabaseEnginePostgres:
+		return &options.PostgresSQLOptions
+	case DatabaseEngineAdvancedPostgres:
+		return &options.AdvancedPostgresSQLOptions
+	case DatabaseEngineMySQL:
+		return &options.MySQLOptions
+	case DatabaseEngineAdvancedMySQL:
+		return &options.AdvancedMySQLOptions
+	case DatabaseEngineRedis:
+		return &options.RedisOptions
+	case DatabaseEngineValkey:
+		return &options.ValkeyOptions
+	case DatabaseEngineMongoDB:
+		return &options.MongoDBOptions
+	case DatabaseEngineKafka:
+		return &options.KafkaOptions
+	case DatabaseEngineOpenSearch:
+		return &options.OpensearchOptions
+	}
+	return nil
+}
+
+// compareDatabaseVersions compares dotted version slugs such as "8" and
+// "7.2" numerically, falling back to a string comparison of parts that
+// aren't numbers.
+func compareDatabaseVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (xerr != nil || yerr != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Markdown renders the report as a Markdown document with a summary table
+// followed by the details of each cluster.
+func (r *DatabaseInventoryReport) Markdown() string {
+	var b strings.Builder
+	counts := map[string]int{}
+	for _, c := range r.Clusters {
+		for _, f := range c.Findings {
+			counts[f.Severity]++
+		}
+	}
+	fmt.Fprintf(&b, "# Database inventory\n\nGenerated %s: %d clusters, %d critical and %d warning findings.\n\n",
+		r.GeneratedAt.Format(time.RFC3339), len(r.Clusters), counts[DatabaseFindingCritical], counts[DatabaseFindingWarning])
+
+	b.WriteString("| Cluster | Engine | Version | Region | Size | Nodes | Status | Findings |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|\n")
+	for _, c := range r.Clusters {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %d | %s | %d |\n",
+			markdownCell(c.Name), c.Engine, c.Version, c.Region, c.Size, c.NumNodes, c.Status, len(c.Findings))
+	}
+
+	for _, c := range r.Clusters {
+		fmt.Fprintf(&b, "\n## %s\n\n", c.Name)
+		fmt.Fprintf(&b, "- ID: `%s`\n", c.ID)
+		version := c.Version
+		if c.LatestVersion != "" && c.LatestVersion != c.Version {
+			version += " (latest " + c.LatestVersion + ")"
+		}
+		fmt.Fprintf(&b, "- Engine: %s %s\n", c.Engine, version)
+		if len(c.Tags) > 0 {
+			fmt.Fprintf(&b, "- Tags: %s\n", strings.Join(c.Tags, ", "))
+		}
+		storage := "disabled"
+		if c.StorageAutoscale != nil && c.StorageAutoscale.Enabled {
+			storage = "enabled"
+		}
+		fmt.Fprintf(&b, "- Storage: %d MiB, autoscaling %s", c.StorageSizeMib, storage)
+		if c.DiskUsagePercent != nil {
+			fmt.Fprintf(&b, ", %.0f%% used", *c.DiskUsagePercent)
+		}
+		b.WriteString("\n")
+		if mw := c.MaintenanceWindow; mw != nil {
+			fmt.Fprintf(&b, "- Maintenance window: %s %s\n", mw.Day, mw.Hour)
+		}
+		fmt.Fprintf(&b, "- Replicas: %d, pools: %d, users: %d, trusted sources: %d\n",
+			len(c.Replicas), len(c.Pools), len(c.Users), len(c.FirewallRules))
+
+		if len(c.Findings) > 0 {
+			b.WriteString("\n### Findings\n\n")
+			for _, f := range c.Findings {
+				fmt.Fprintf(&b, "- **%s** `%s`: %s\n", f.Severity, f.Code, f.Message)
+			}
+		}
+		if len(c.Events) > 0 {
+			b.WriteString("\n### Recent events\n\n")
+			for _, e := range c.Events {
+				fmt.Fprintf(&b, "- %s %s\n", e.CreateTime, e.EventType)
+			}
+		}
+		if len(c.Errors) > 0 {
+			b.WriteString("\n### Errors\n\n")
+			for _, e := range c.Errors {
+				fmt.Fprintf(&b, "- %s\n", e)
+			}
+		}
+	}
+	return b.String()
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
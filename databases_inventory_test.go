@@ -0,0 +1,177 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareDatabaseVersions(t *testing.T) {
+	assert.Equal(t, 0, compareDatabaseVersions("16", "16"))
+	assert.Equal(t, -1, compareDatabaseVersions("9", "16"))
+	assert.Equal(t, 1, compareDatabaseVersions("7.2", "7"))
+	assert.Equal(t, -1, compareDatabaseVersions("8.0", "8.4"))
+}
+
+func TestDatabaseInventory(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"databases": [
+			{"id": "pg-id", "name": "main", "engine": "pg", "version": "15", "region": "nyc3", "size": "db-s-2vcpu-4gb",
+			 "num_nodes": 1, "status": "online", "tags": ["Production"], "storage_size_mib": 61440,
+			 "maintenance_window": {"day": "sunday", "hour": "03:00:00", "pending": true, "description": ["minor version upgrade"]},
+			 "connection": {"password": "secret"}},
+			{"id": "my-id", "name": "orders", "engine": "mysql", "version": "8", "region": "ams3", "size": "db-s-1vcpu-2gb",
+			 "num_nodes": 2, "status": "online", "storage_autoscale": {"enabled": false}},
+			{"id": "kv-id", "name": "cache", "engine": "redis", "version": "6", "region": "ams3", "size": "db-s-1vcpu-1gb",
+			 "num_nodes": 1, "status": "online"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/databases/options", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"options": {"pg": {"versions": ["14", "15", "16"]}, "mysql": {"versions": ["8"]}, "redis": {"versions": ["7"]}}}`)
+	})
+
+	mux.HandleFunc("/v2/databases/pg-id/replicas", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"replicas": [{"name": "main-replica", "region": "nyc3", "size": "db-s-2vcpu-4gb", "status": "online",
+			"connection": {"password": "secret"}}]}`)
+	})
+	mux.HandleFunc("/v2/databases/pg-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"pools": [{"name": "web", "user": "app", "db": "app", "size": 10, "mode": "transaction"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/pg-id/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"users": [{"name": "doadmin", "role": "primary", "password": "secret"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/pg-id/firewall", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rules": []}`)
+	})
+	mux.HandleFunc("/v2/databases/pg-id/events", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+		fmt.Fprint(w, `{"events": [
+			{"id": "1", "event_type": "cluster_create", "create_time": "2024-01-01T00:00:00Z"},
+			{"id": "2", "event_type": "cluster_maintenance", "create_time": "2024-02-01T00:00:00Z"}
+		]}`)
+	})
+
+	mux.HandleFunc("/v2/databases/my-id/replicas", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"id": "server_error", "message": "boom"}`, http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/v2/databases/my-id/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"users": []}`)
+	})
+	mux.HandleFunc("/v2/databases/my-id/firewall", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rules": [{"type": "tag", "value": "web"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/my-id/events", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"events": []}`)
+	})
+	mux.HandleFunc("/v2/monitoring/metrics/database/mysql/disk_usage", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "my-id", r.URL.Query().Get("db_id"))
+		assert.Equal(t, "max", r.URL.Query().Get("aggregate"))
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {}, "values": [[1700000000, "71.5"], [1700000060, "86.2"]]}
+		]}}`)
+	})
+
+	mux.HandleFunc("/v2/databases/kv-id/firewall", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rules": [{"type": "ip_addr", "value": "192.0.2.1"}]}`)
+	})
+	mux.HandleFunc("/v2/databases/kv-id/events", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"events": []}`)
+	})
+
+	report, err := DatabaseInventory(ctx, client, &DatabaseInventoryOptions{EventLimit: 2})
+	require.NoError(t, err)
+	require.Len(t, report.Clusters, 3)
+
+	findings := map[string][]string{}
+	for _, c := range report.Clusters {
+		for _, f := range c.Findings {
+			findings[c.Name] = append(findings[c.Name], f.Code)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"main": {
+			DatabaseFindingNoTrustedSources,
+			DatabaseFindingSingleNodeProduction,
+			DatabaseFindingOutdatedVersion,
+			DatabaseFindingPendingUpdates,
+		},
+		"orders": {DatabaseFindingAutoscaleNearFull},
+		"cache":  {DatabaseFindingUnsupportedVersion},
+	}, findings)
+
+	cache, main, orders := report.Clusters[0], report.Clusters[1], report.Clusters[2]
+	assert.Equal(t, "16", main.LatestVersion)
+	assert.Equal(t, []DatabaseInventoryReplica{{Name: "main-replica", Region: "nyc3", Size: "db-s-2vcpu-4gb", Status: "online"}}, main.Replicas)
+	assert.Equal(t, []DatabaseInventoryUser{{Name: "doadmin", Role: "primary"}}, main.Users)
+	assert.Equal(t, "2", main.Events[0].ID)
+	assert.Equal(t, 86.2, *orders.DiskUsagePercent)
+	require.Len(t, orders.Errors, 1)
+	assert.Contains(t, orders.Errors[0], "replicas")
+	assert.Empty(t, cache.Users)
+
+	b, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "secret")
+
+	md := report.Markdown()
+	assert.Contains(t, md, "3 clusters, 3 critical and 2 warning findings")
+	assert.Contains(t, md, "| main | pg | 15 | nyc3 | db-s-2vcpu-4gb | 1 | online | 4 |\n")
+	assert.Contains(t, md, "- Engine: pg 15 (latest 16)\n")
+	assert.Contains(t, md, "- **info** `pending-updates`: updates are pending: minor version upgrade\n")
+	assert.Contains(t, md, "- Storage: 0 MiB, autoscaling disabled, 86% used\n")
+}
+
+func TestDatabaseInventory_AdvancedEngines(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"databases": [
+			{"id": "pg-id", "name": "main", "engine": "advanced_pg", "version": "16", "num_nodes": 2, "status": "online"},
+			{"id": "my-id", "name": "orders", "engine": "advanced_mysql", "version": "8", "num_nodes": 2, "status": "online"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/databases/options", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"options": {}}`)
+	})
+	for _, id := range []string{"pg-id", "my-id"} {
+		mux.HandleFunc("/v2/databases/"+id+"/replicas", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"replicas": []}`)
+		})
+		mux.HandleFunc("/v2/databases/"+id+"/users", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"users": []}`)
+		})
+		mux.HandleFunc("/v2/databases/"+id+"/firewall", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"rules": [{"type": "tag", "value": "web"}]}`)
+		})
+		mux.HandleFunc("/v2/databases/"+id+"/events", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"events": []}`)
+		})
+	}
+	mux.HandleFunc("/v2/databases/pg-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"pools": [{"name": "web", "user": "app", "db": "app", "size": 10, "mode": "transaction"}]}`)
+	})
+	mux.HandleFunc("/v2/monitoring/metrics/database/mysql/disk_usage", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "my-id", r.URL.Query().Get("db_id"))
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {}, "values": [[1700000000, "42"]]}
+		]}}`)
+	})
+
+	report, err := DatabaseInventory(ctx, client, nil)
+	require.NoError(t, err)
+	require.Len(t, report.Clusters, 2)
+	main, orders := report.Clusters[0], report.Clusters[1]
+	assert.Empty(t, main.Errors)
+	assert.Equal(t, []DatabaseInventoryPool{{Name: "web", User: "app", Database: "app", Size: 10, Mode: "transaction"}}, main.Pools)
+	assert.Empty(t, orders.Errors)
+	require.NotNil(t, orders.DiskUsagePercent)
+	assert.Equal(t, 42.0, *orders.DiskUsagePercent)
+}
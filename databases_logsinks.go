@@ -0,0 +1,450 @@
+package godo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Logsink types.
+const (
+	DatabaseLogsinkTypeRsyslog       = "rsyslog"
+	DatabaseLogsinkTypeElasticsearch = "elasticsearch"
+	DatabaseLogsinkTypeOpensearch    = "opensearch"
+)
+
+// Rsyslog message formats.
+const (
+	DatabaseLogsinkFormatRFC5424 = "rfc5424"
+	DatabaseLogsinkFormatRFC3164 = "rfc3164"
+	DatabaseLogsinkFormatCustom  = "custom"
+)
+
+const (
+	defaultDatadogLogsinkServer = "intake.logs.datadoghq.com"
+	defaultDatadogLogsinkPort   = 10516
+)
+
+var (
+	// rsyslogPropertyRE matches the property name of a template reference
+	// such as %msg% or %timestamp:::date-rfc3339%.
+	rsyslogPropertyRE = regexp.MustCompile(`^[$!]?[A-Za-z][\w.!-]*$`)
+	datadogAPIKeyRE   = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// RsyslogLogsink builds a logsink that forwards logs to an rsyslog server.
+type RsyslogLogsink struct {
+	Name   string
+	Server string
+	Port   int
+	TLS    bool
+	// Format is one of the DatabaseLogsinkFormat* values. Logline is the
+	// rsyslog template used by the custom format, and SD the structured
+	// data added to rfc5424 messages.
+	Format  string
+	Logline string
+	SD      string
+	// CA verifies the server's certificate. Cert and Key, which must be set
+	// together, authenticate the cluster to the server. All are PEM encoded
+	// and require TLS.
+	CA   string
+	Cert string
+	Key  string
+}
+
+// Build validates the logsink and returns a request for CreateLogsink.
+func (s *RsyslogLogsink) Build() (*DatabaseCreateLogsinkRequest, error) {
+	req := &DatabaseCreateLogsinkRequest{
+		Name: s.Name,
+		Type: DatabaseLogsinkTypeRsyslog,
+		Config: &DatabaseLogsinkConfig{
+			Server:  s.Server,
+			Port:    s.Port,
+			TLS:     s.TLS,
+			Format:  s.Format,
+			Logline: s.Logline,
+			SD:      s.SD,
+			CA:      s.CA,
+			Cert:    s.Cert,
+			Key:     s.Key,
+		},
+	}
+	if err := ValidateDatabaseLogsink(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ElasticsearchLogsink builds a logsink that indexes logs in an
+// Elasticsearch cluster.
+type ElasticsearchLogsink struct {
+	Name string
+	// URL is the http or https URL of the cluster, including credentials.
+	URL         string
+	IndexPrefix string
+	// IndexDaysMax is the number of days of daily indices to keep, from 1
+	// to 10000. Zero uses the API's default.
+	IndexDaysMax int
+	// Timeout is the request timeout in seconds, from 10 to 120. Zero uses
+	// the API's default.
+	Timeout float32
+	// CA is the PEM encoded certificate that verifies an https URL.
+	CA string
+}
+
+// Build validates the logsink and returns a request for CreateLogsink.
+func (s *ElasticsearchLogsink) Build() (*DatabaseCreateLogsinkRequest, error) {
+	return buildSearchLogsink(DatabaseLogsinkTypeElasticsearch, s)
+}
+
+// OpensearchLogsink builds a logsink that indexes logs in an OpenSearch
+// cluster. Its settings are the same as ElasticsearchLogsink's.
+type OpensearchLogsink ElasticsearchLogsink
+
+// Build validates the logsink and returns a request for CreateLogsink.
+func (s *OpensearchLogsink) Build() (*DatabaseCreateLogsinkRequest, error) {
+	return buildSearchLogsink(DatabaseLogsinkTypeOpensearch, (*ElasticsearchLogsink)(s))
+}
+
+func buildSearchLogsink(sinkType string, s *ElasticsearchLogsink) (*DatabaseCreateLogsinkRequest, error) {
+	req := &DatabaseCreateLogsinkRequest{
+		Name: s.Name,
+		Type: sinkType,
+		Config: &DatabaseLogsinkConfig{
+			URL:          s.URL,
+			IndexPrefix:  s.IndexPrefix,
+			IndexDaysMax: s.IndexDaysMax,
+			Timeout:      s.Timeout,
+			CA:           s.CA,
+		},
+	}
+	if err := ValidateDatabaseLogsink(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// DatadogLogsink builds a logsink that sends logs to Datadog's TCP intake.
+// Datadog has no logsink type of its own, so it's an rsyslog logsink over
+// TLS with a custom format that prefixes each message with the API key.
+type DatadogLogsink struct {
+	Name   string
+	APIKey string
+	// Server and Port default to Datadog's US1 intake. Other sites have
+	// their own intake endpoints.
+	Server string
+	Port   int
+	// Service is reported as the app name of the messages. It defaults to
+	// the rsyslog app-name property.
+	Service string
+}
+
+// Build validates the logsink and returns a request for CreateLogsink.
+func (s *DatadogLogsink) Build() (*DatabaseCreateLogsinkRequest, error) {
+	if !datadogAPIKeyRE.MatchString(s.APIKey) {
+		return nil, NewArgError("APIKey", "must be 32 lowercase hexadecimal characters")
+	}
+	server, port := s.Server, s.Port
+	if server == "" {
+		server = defaultDatadogLogsinkServer
+	}
+	if port == 0 {
+		port = defaultDatadogLogsinkPort
+	}
+	service := "%app-name%"
+	if s.Service != "" {
+		if strings.ContainsAny(s.Service, "% ") {
+			return nil, NewArgError("Service", "cannot contain spaces or '%'")
+		}
+		service = s.Service
+	}
+	return (&RsyslogLogsink{
+		Name:    s.Name,
+		Server:  server,
+		Port:    port,
+		TLS:     true,
+		Format:  DatabaseLogsinkFormatCustom,
+		Logline: s.APIKey + " <%pri%>1 %timestamp:::date-rfc3339% %HOSTNAME% " + service + " - - - %msg%",
+	}).Build()
+}
+
+// ValidateDatabaseLogsink checks a logsink request locally: the sink type,
+// server and port of rsyslog sinks, the URL scheme and index settings of
+// Elasticsearch and OpenSearch sinks, custom format templates, and that the
+// certificates and key are valid PEM.
+func ValidateDatabaseLogsink(req *DatabaseCreateLogsinkRequest) error {
+	if req == nil {
+		return NewArgError("req", "cannot be nil")
+	}
+	if req.Name == "" {
+		return NewArgError("Name", "cannot be empty")
+	}
+	if req.Config == nil {
+		return NewArgError("Config", "cannot be nil")
+	}
+	var err error
+	switch req.Type {
+	case DatabaseLogsinkTypeRsyslog:
+		err = validateRsyslogLogsink(req.Config)
+	case DatabaseLogsinkTypeElasticsearch, DatabaseLogsinkTypeOpensearch:
+		err = validateSearchLogsink(req.Config)
+	default:
+		err = NewArgError("Type", fmt.Sprintf("unsupported logsink type %q", req.Type))
+	}
+	if err != nil {
+		return fmt.Errorf("godo: logsink %s: %w", req.Name, err)
+	}
+	return nil
+}
+
+func validateRsyslogLogsink(cfg *DatabaseLogsinkConfig) error {
+	if cfg.Server == "" {
+		return NewArgError("Server", "cannot be empty")
+	}
+	if strings.Contains(cfg.Server, "://") || strings.ContainsAny(cfg.Server, "/ ") {
+		return NewArgError("Server", "must be a host name or IP address")
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return NewArgError("Port", "must be between 1 and 65535")
+	}
+
+	switch cfg.Format {
+	case DatabaseLogsinkFormatRFC5424, DatabaseLogsinkFormatRFC3164:
+		if cfg.Logline != "" {
+			return NewArgError("Logline", "is only used by the custom format")
+		}
+	case DatabaseLogsinkFormatCustom:
+		if err := validateRsyslogTemplate(cfg.Logline); err != nil {
+			return err
+		}
+	default:
+		return NewArgError("Format", fmt.Sprintf("unsupported format %q", cfg.Format))
+	}
+	if cfg.SD != "" && cfg.Format != DatabaseLogsinkFormatRFC5424 {
+		return NewArgError("SD", "is only used by the rfc5424 format")
+	}
+
+	if !cfg.TLS && (cfg.CA != "" || cfg.Cert != "" || cfg.Key != "") {
+		return NewArgError("TLS", "must be enabled to use certificates")
+	}
+	if err := validatePEMCertificates("CA", cfg.CA); err != nil {
+		return err
+	}
+	if (cfg.Cert == "") != (cfg.Key == "") {
+		return NewArgError("Cert", "must be set together with Key")
+	}
+	if cfg.Cert != "" {
+		if _, err := tls.X509KeyPair([]byte(cfg.Cert), []byte(cfg.Key)); err != nil {
+			return NewArgError("Cert", err.Error())
+		}
+	}
+	return nil
+}
+
+// validateRsyslogTemplate checks that a template is not empty and that its
+// property references, the text between pairs of '%', name a property.
+func validateRsyslogTemplate(logline string) error {
+	if strings.TrimSpace(logline) == "" {
+		return NewArgError("Logline", "cannot be empty with the custom format")
+	}
+	parts := strings.Split(logline, "%")
+	if len(parts)%2 == 0 {
+		return NewArgError("Logline", "has an unterminated property reference")
+	}
+	for i := 1; i < len(parts); i += 2 {
+		name, _, _ := strings.Cut(parts[i], ":")
+		if !rsyslogPropertyRE.MatchString(name) {
+			return NewArgError("Logline", fmt.Sprintf("invalid property reference %%%s%%", parts[i]))
+		}
+	}
+	return nil
+}
+
+func validateSearchLogsink(cfg *DatabaseLogsinkConfig) error {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return NewArgError("URL", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return NewArgError("URL", "must use the http or https scheme")
+	}
+	if u.Host == "" {
+		return NewArgError("URL", "must include a host")
+	}
+	if p := u.Port(); p != "" {
+		if port, err := strconv.Atoi(p); err != nil || port < 1 || port > 65535 {
+			return NewArgError("URL", "port must be between 1 and 65535")
+		}
+	}
+
+	if cfg.IndexPrefix == "" {
+		return NewArgError("IndexPrefix", "cannot be empty")
+	}
+	if cfg.IndexPrefix != strings.ToLower(cfg.IndexPrefix) ||
+		strings.ContainsAny(cfg.IndexPrefix, `\/*?"<>| ,#:`) ||
+		strings.IndexAny(cfg.IndexPrefix, "-_+") == 0 {
+		return NewArgError("IndexPrefix", "must be a valid lowercase index name")
+	}
+	if cfg.IndexDaysMax != 0 && (cfg.IndexDaysMax < 1 || cfg.IndexDaysMax > 10000) {
+		return NewArgError("IndexDaysMax", "must be between 1 and 10000")
+	}
+	if cfg.Timeout != 0 && (cfg.Timeout < 10 || cfg.Timeout > 120) {
+		return NewArgError("Timeout", "must be between 10 and 120 seconds")
+	}
+
+	if cfg.CA != "" && u.Scheme != "https" {
+		return NewArgError("CA", "requires an https URL")
+	}
+	return validatePEMCertificates("CA", cfg.CA)
+}
+
+// validatePEMCertificates checks that a non-empty value holds only PEM
+// encoded certificates.
+func validatePEMCertificates(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	rest := []byte(value)
+	found := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return NewArgError(field, fmt.Sprintf("unexpected PEM block %q", block.Type))
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return NewArgError(field, err.Error())
+		}
+		found++
+	}
+	if found == 0 || strings.TrimSpace(string(rest)) != "" {
+		return NewArgError(field, "must contain only PEM encoded certificates")
+	}
+	return nil
+}
+
+// DatabaseLogsinkSyncResult lists the logsinks changed by
+// SyncDatabaseLogsinks, by name.
+type DatabaseLogsinkSyncResult struct {
+	Created   []string
+	Updated   []string
+	Deleted   []string
+	Unchanged []string
+}
+
+// SyncDatabaseLogsinks makes the logsinks of a database cluster match the
+// desired ones by name. Missing sinks are created, sinks whose config
+// differs from the desired one are updated and sinks that aren't desired,
+// or duplicate a desired name, are deleted. A sink whose type changes, or
+// whose TLS setting is turned off, is deleted and created again since the
+// update request can't express that change.
+//
+// All desired sinks are validated before anything is changed. The sync
+// stops at the first error; the result lists what was changed until then.
+// If a sink was deleted to be created again and the creation fails, the
+// sink is lost and listed in Deleted.
+func SyncDatabaseLogsinks(ctx context.Context, client *Client, databaseID string, desired []*DatabaseCreateLogsinkRequest) (*DatabaseLogsinkSyncResult, error) {
+	if databaseID == "" {
+		return nil, NewArgError("databaseID", "cannot be empty")
+	}
+	want := make(map[string]*DatabaseCreateLogsinkRequest, len(desired))
+	for _, req := range desired {
+		if err := ValidateDatabaseLogsink(req); err != nil {
+			return nil, err
+		}
+		if want[req.Name] != nil {
+			return nil, NewArgError("desired", fmt.Sprintf("duplicate logsink name %q", req.Name))
+		}
+		want[req.Name] = req
+	}
+
+	existing, err := collectPages(func(opt *ListOptions) ([]DatabaseLogsink, *Response, error) {
+		return client.Databases.ListLogsinks(ctx, databaseID, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DatabaseLogsinkSyncResult{}
+	current := make(map[string]DatabaseLogsink, len(existing))
+	var remove []DatabaseLogsink
+	for _, sink := range existing {
+		if _, seen := current[sink.Name]; seen || want[sink.Name] == nil {
+			remove = append(remove, sink)
+			continue
+		}
+		current[sink.Name] = sink
+	}
+
+	for _, req := range desired {
+		sink, ok := current[req.Name]
+		switch {
+		case !ok:
+		case sink.Type != req.Type || (sink.Config != nil && sink.Config.TLS && !req.Config.TLS):
+			if _, err := client.Databases.DeleteLogsink(ctx, databaseID, sink.ID); err != nil {
+				return result, fmt.Errorf("godo: deleting logsink %s: %w", sink.Name, err)
+			}
+		case logsinkConfigMatches(sink.Config, req.Config):
+			result.Unchanged = append(result.Unchanged, req.Name)
+			continue
+		default:
+			if _, err := client.Databases.UpdateLogsink(ctx, databaseID, sink.ID, &DatabaseUpdateLogsinkRequest{Config: req.Config}); err != nil {
+				return result, fmt.Errorf("godo: updating logsink %s: %w", req.Name, err)
+			}
+			result.Updated = append(result.Updated, req.Name)
+			continue
+		}
+		if _, _, err := client.Databases.CreateLogsink(ctx, databaseID, req); err != nil {
+			if ok {
+				result.Deleted = append(result.Deleted, req.Name)
+			}
+			return result, fmt.Errorf("godo: creating logsink %s: %w", req.Name, err)
+		}
+		if ok {
+			result.Updated = append(result.Updated, req.Name)
+		} else {
+			result.Created = append(result.Created, req.Name)
+		}
+	}
+
+	for _, sink := range remove {
+		if _, err := client.Databases.DeleteLogsink(ctx, databaseID, sink.ID); err != nil {
+			return result, fmt.Errorf("godo: deleting logsink %s: %w", sink.Name, err)
+		}
+		result.Deleted = append(result.Deleted, sink.Name)
+	}
+	return result, nil
+}
+
+// logsinkConfigMatches reports whether live has exactly the settings of
+// desired. IndexDaysMax and Timeout are only compared when desired sets
+// them, since the API fills in defaults, and a private key isn't compared
+// when the API doesn't return it.
+func logsinkConfigMatches(live, desired *DatabaseLogsinkConfig) bool {
+	if live == nil {
+		live = &DatabaseLogsinkConfig{}
+	}
+	if desired == nil {
+		desired = &DatabaseLogsinkConfig{}
+	}
+	want := *desired
+	if want.IndexDaysMax == 0 {
+		want.IndexDaysMax = live.IndexDaysMax
+	}
+	if want.Timeout == 0 {
+		want.Timeout = live.Timeout
+	}
+	if live.Key == "" {
+		want.Key = ""
+	}
+	return *live == want
+}
@@ -0,0 +1,241 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Statuses of a database online migration.
+const (
+	DatabaseOnlineMigrationRunning  = "running"
+	DatabaseOnlineMigrationSyncing  = "syncing"
+	DatabaseOnlineMigrationDone     = "done"
+	DatabaseOnlineMigrationCanceled = "canceled"
+	DatabaseOnlineMigrationError    = "error"
+)
+
+const (
+	defaultMigrationMinPollInterval = 5 * time.Second
+	defaultMigrationMaxPollInterval = time.Minute
+	defaultMigrationDialTimeout     = 5 * time.Second
+
+	// migrationPollFailures is the number of consecutive polling errors
+	// tolerated before RunDatabaseOnlineMigration gives up.
+	migrationPollFailures = 3
+)
+
+// DatabaseMigrationEvent is emitted by RunDatabaseOnlineMigration when the
+// status of the migration changes.
+type DatabaseMigrationEvent struct {
+	Status *DatabaseOnlineMigrationStatus
+	// PreviousStatus is empty for the first status observed.
+	PreviousStatus string
+	// Elapsed is the time since the migration was started.
+	Elapsed time.Duration
+}
+
+// DatabaseMigrationRunOptions configures RunDatabaseOnlineMigration.
+type DatabaseMigrationRunOptions struct {
+	// SkipSourceCheck disables the local reachability check of the source.
+	// The check connects from the local machine, which may not have the same
+	// network access as the cluster, so it should be skipped when the source
+	// is only reachable from the cluster.
+	SkipSourceCheck bool
+	// DialTimeout bounds the reachability check. Defaults to five seconds.
+	DialTimeout time.Duration
+
+	// MinPollInterval is the delay between status polls after a change. It
+	// doubles while the status stays the same, up to MaxPollInterval.
+	// They default to five seconds and one minute respectively.
+	MinPollInterval time.Duration
+	MaxPollInterval time.Duration
+
+	// OnEvent, if set, is called for each status change. An error returned
+	// by OnEvent stops the polling, but not the migration, and is returned.
+	OnEvent func(*DatabaseMigrationEvent) error
+}
+
+// CheckDatabaseMigrationSource checks that the source of an online
+// migration is complete and that its host accepts TCP connections from the
+// local machine.
+func CheckDatabaseMigrationSource(ctx context.Context, source *DatabaseOnlineMigrationConfig, timeout time.Duration) error {
+	if source == nil || source.Host == "" {
+		return NewArgError("source.Host", "cannot be empty")
+	}
+	if source.Port <= 0 || source.Port > 65535 {
+		return NewArgError("source.Port", "must be between 1 and 65535")
+	}
+	if timeout <= 0 {
+		timeout = defaultMigrationDialTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(source.Host, strconv.Itoa(source.Port)))
+	if err != nil {
+		return fmt.Errorf("godo: migration source is not reachable: %w", err)
+	}
+	return conn.Close()
+}
+
+// RunDatabaseOnlineMigration starts an online migration into a database
+// cluster and polls its status until the cluster is replicating from the
+// source (syncing) or the migration ends. The last status is returned. An
+// error is returned along with it if the migration failed or was canceled.
+//
+// A syncing migration keeps replicating until it is stopped, typically with
+// CutOverDatabaseMigration once the clients are ready to switch clusters.
+func RunDatabaseOnlineMigration(ctx context.Context, client *Client, databaseID string, req *DatabaseStartOnlineMigrationRequest, opts *DatabaseMigrationRunOptions) (*DatabaseOnlineMigrationStatus, error) {
+	if databaseID == "" {
+		return nil, NewArgError("databaseID", "cannot be empty")
+	}
+	if req == nil || req.Source == nil {
+		return nil, NewArgError("req.Source", "cannot be nil")
+	}
+	if opts == nil {
+		opts = &DatabaseMigrationRunOptions{}
+	}
+	if !opts.SkipSourceCheck {
+		if err := CheckDatabaseMigrationSource(ctx, req.Source, opts.DialTimeout); err != nil {
+			return nil, err
+		}
+	}
+	minInterval, maxInterval := opts.MinPollInterval, opts.MaxPollInterval
+	if minInterval <= 0 {
+		minInterval = defaultMigrationMinPollInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = defaultMigrationMaxPollInterval
+	}
+	maxInterval = max(maxInterval, minInterval)
+
+	started := time.Now()
+	status, _, err := client.Databases.StartOnlineMigration(ctx, databaseID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		previous  string
+		interval  = minInterval
+		failCount = 0
+	)
+	for {
+		if status.Status != previous {
+			if opts.OnEvent != nil {
+				if err := opts.OnEvent(&DatabaseMigrationEvent{
+					Status:         status,
+					PreviousStatus: previous,
+					Elapsed:        time.Since(started),
+				}); err != nil {
+					return status, err
+				}
+			}
+			previous = status.Status
+			interval = minInterval
+		} else {
+			interval = min(2*interval, maxInterval)
+		}
+
+		switch status.Status {
+		case DatabaseOnlineMigrationSyncing, DatabaseOnlineMigrationDone:
+			return status, nil
+		case DatabaseOnlineMigrationError, DatabaseOnlineMigrationCanceled:
+			return status, fmt.Errorf("godo: online migration %s ended with status %s", status.ID, status.Status)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return status, ctx.Err()
+		}
+
+		next, _, err := client.Databases.GetOnlineMigrationStatus(ctx, databaseID)
+		if err != nil {
+			if ctx.Err() != nil || failCount >= migrationPollFailures {
+				return status, err
+			}
+			failCount++
+			continue
+		}
+		failCount = 0
+		status = next
+	}
+}
+
+// DatabaseCutOverRequest configures CutOverDatabaseMigration.
+type DatabaseCutOverRequest struct {
+	// DatabaseID is the cluster being migrated into.
+	DatabaseID string
+	// AppID is the app that connects to the database. It is added to the
+	// trusted sources of DatabaseID before the migration is stopped.
+	AppID string
+	// SourceDatabaseID, if the migration source is a DigitalOcean cluster,
+	// has AppID removed from its trusted sources once the migration is
+	// stopped.
+	SourceDatabaseID string
+}
+
+// CutOverDatabaseMigration switches an app over from the source of an online
+// migration to the cluster being migrated into, once the migration has
+// finished its initial copy and is syncing. It adds the app to the cluster's
+// trusted sources, stops the migration and, if the source is a DigitalOcean
+// cluster, removes the app from the source's trusted sources.
+//
+// If stopping the migration fails, the app is removed from the cluster's
+// trusted sources again so that nothing has changed. The source's trusted
+// sources are changed last; if that fails the migration is already stopped,
+// so the error is returned without rolling back.
+func CutOverDatabaseMigration(ctx context.Context, client *Client, req *DatabaseCutOverRequest) error {
+	if req == nil || req.DatabaseID == "" {
+		return NewArgError("req.DatabaseID", "cannot be empty")
+	}
+	if req.AppID == "" {
+		return NewArgError("req.AppID", "cannot be empty")
+	}
+
+	status, _, err := client.Databases.GetOnlineMigrationStatus(ctx, req.DatabaseID)
+	if err != nil {
+		return err
+	}
+	// While the migration is running the initial copy isn't complete, and
+	// stopping it would leave the cluster with part of the data.
+	if status.Status != DatabaseOnlineMigrationSyncing {
+		return fmt.Errorf("godo: online migration %s has status %s and can't be cut over until it is %s", status.ID, status.Status, DatabaseOnlineMigrationSyncing)
+	}
+
+	appRule := &DatabaseFirewallRule{Type: DatabaseFirewallRuleApp, Value: req.AppID}
+	target := NewDatabaseFirewallManager(client, req.DatabaseID)
+
+	// The rule is only removed on rollback if it wasn't already trusted.
+	live, _, err := client.Databases.GetFirewallRules(ctx, req.DatabaseID)
+	if err != nil {
+		return err
+	}
+	alreadyTrusted := databaseFirewallRulesApplied(live, []*DatabaseFirewallRule{appRule}, nil)
+	if !alreadyTrusted {
+		if _, err := target.AddRules(ctx, appRule); err != nil {
+			return err
+		}
+	}
+
+	if _, err := client.Databases.StopOnlineMigration(ctx, req.DatabaseID, status.ID); err != nil {
+		if !alreadyTrusted {
+			if _, rbErr := target.RemoveRules(ctx, appRule); rbErr != nil {
+				return errors.Join(err, fmt.Errorf("godo: rolling back trusted sources: %w", rbErr))
+			}
+		}
+		return err
+	}
+
+	if req.SourceDatabaseID != "" {
+		source := NewDatabaseFirewallManager(client, req.SourceDatabaseID)
+		if _, err := source.RemoveRules(ctx, appRule); err != nil {
+			return fmt.Errorf("godo: migration stopped but removing app from source trusted sources failed: %w", err)
+		}
+	}
+	return nil
+}
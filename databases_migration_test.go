@@ -0,0 +1,167 @@
+package godo
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMigrationSource(t *testing.T) *DatabaseOnlineMigrationConfig {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return &DatabaseOnlineMigrationConfig{Host: host, Port: p, DatabaseName: "app"}
+}
+
+func TestCheckDatabaseMigrationSource(t *testing.T) {
+	source := testMigrationSource(t)
+	assert.NoError(t, CheckDatabaseMigrationSource(ctx, source, time.Second))
+
+	assert.Error(t, CheckDatabaseMigrationSource(ctx, &DatabaseOnlineMigrationConfig{Host: "127.0.0.1"}, time.Second))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := l.Addr().(*net.TCPAddr)
+	l.Close()
+	err = CheckDatabaseMigrationSource(ctx, &DatabaseOnlineMigrationConfig{Host: "127.0.0.1", Port: closed.Port}, time.Second)
+	assert.ErrorContains(t, err, "not reachable")
+}
+
+func TestRunDatabaseOnlineMigration(t *testing.T) {
+	setup()
+	defer teardown()
+
+	statuses := []string{"running", "running", "running", "syncing"}
+	var mu sync.Mutex
+	mux.HandleFunc("/v2/databases/db-id/online-migration", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			fmt.Fprint(w, `{"id": "mig-id", "status": "running"}`)
+			return
+		}
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		fmt.Fprintf(w, `{"id": "mig-id", "status": %q}`, status)
+	})
+
+	var events []string
+	status, err := RunDatabaseOnlineMigration(ctx, client, "db-id", &DatabaseStartOnlineMigrationRequest{
+		Source: testMigrationSource(t),
+	}, &DatabaseMigrationRunOptions{
+		MinPollInterval: time.Millisecond,
+		MaxPollInterval: 4 * time.Millisecond,
+		OnEvent: func(e *DatabaseMigrationEvent) error {
+			events = append(events, e.PreviousStatus+">"+e.Status.Status)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "syncing", status.Status)
+	assert.Equal(t, []string{">running", "running>syncing"}, events)
+}
+
+func TestRunDatabaseOnlineMigration_Error(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/online-migration", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			fmt.Fprint(w, `{"id": "mig-id", "status": "running"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "mig-id", "status": "error"}`)
+	})
+
+	status, err := RunDatabaseOnlineMigration(ctx, client, "db-id", &DatabaseStartOnlineMigrationRequest{
+		Source: &DatabaseOnlineMigrationConfig{Host: "db.example.com", Port: 5432},
+	}, &DatabaseMigrationRunOptions{SkipSourceCheck: true, MinPollInterval: time.Millisecond})
+	require.Error(t, err)
+	assert.Equal(t, "error", status.Status)
+}
+
+func TestCutOverDatabaseMigration(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/online-migration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "mig-id", "status": "syncing"}`)
+	})
+	stopped := false
+	mux.HandleFunc("/v2/databases/db-id/online-migration/mig-id", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		stopped = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	target := serveTestDatabaseFirewall(t)
+
+	require.NoError(t, CutOverDatabaseMigration(ctx, client, &DatabaseCutOverRequest{
+		DatabaseID: "db-id",
+		AppID:      "app-id",
+	}))
+	assert.True(t, stopped)
+	assert.Equal(t, []string{"app:app-id"}, firewallRuleValues(target.rules))
+}
+
+func TestCutOverDatabaseMigration_NotSyncing(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/online-migration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "mig-id", "status": "running"}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/online-migration/mig-id", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("migration must not be stopped")
+	})
+
+	err := CutOverDatabaseMigration(ctx, client, &DatabaseCutOverRequest{
+		DatabaseID: "db-id",
+		AppID:      "app-id",
+	})
+	assert.EqualError(t, err, "godo: online migration mig-id has status running and can't be cut over until it is syncing")
+}
+
+func TestCutOverDatabaseMigration_RollsBack(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/online-migration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "mig-id", "status": "syncing"}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/online-migration/mig-id", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"id": "server_error", "message": "boom"}`)
+	})
+	target := serveTestDatabaseFirewall(t, DatabaseFirewallRule{Type: "ip_addr", Value: "10.0.0.1"})
+
+	err := CutOverDatabaseMigration(ctx, client, &DatabaseCutOverRequest{
+		DatabaseID: "db-id",
+		AppID:      "app-id",
+	})
+	require.Error(t, err)
+	assert.Equal(t, []string{"ip_addr:10.0.0.1"}, firewallRuleValues(target.rules))
+	assert.Equal(t, 2, target.writes)
+}
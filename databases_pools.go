@@ -0,0 +1,346 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Connection pool modes.
+const (
+	DatabasePoolModeSession     = "session"
+	DatabasePoolModeTransaction = "transaction"
+	DatabasePoolModeStatement   = "statement"
+)
+
+const (
+	// databaseConnectionsPerGiB is the number of backend connections a
+	// PostgreSQL cluster allows per GiB of memory, of which
+	// databaseReservedConnections are reserved for maintenance.
+	databaseConnectionsPerGiB   = 25
+	databaseReservedConnections = 3
+
+	defaultPoolHeadroom = 1.25
+)
+
+var databaseSizeMemoryRE = regexp.MustCompile(`-(\d+)gb(?:-|$)`)
+
+// DatabasePoolUsage is the observed usage of a connection pool, for example
+// from PgBouncer's SHOW POOLS. The Monitoring API only exposes MySQL cluster
+// metrics, so usage of PostgreSQL pools has to be collected by the caller.
+type DatabasePoolUsage struct {
+	// PeakServerConnections is the highest number of server connections
+	// the pool used.
+	PeakServerConnections int
+	// PeakWaitingClients is the highest number of clients waiting for a
+	// server connection. Waiting clients mean the pool is too small.
+	PeakWaitingClients int
+	// SessionFeatures reports that clients rely on session state, such as
+	// prepared statements, advisory locks or SET, which requires session mode.
+	SessionFeatures bool
+}
+
+// DatabasePoolTarget is a pool that PlanDatabasePools should create if it
+// doesn't exist.
+type DatabasePoolTarget struct {
+	Name     string
+	User     string
+	Database string
+}
+
+// DatabasePoolAdvisorOptions configures PlanDatabasePools.
+type DatabasePoolAdvisorOptions struct {
+	// Usage holds the observed usage of the existing pools, by pool name.
+	// Pools without usage keep their current size as the demand.
+	Usage map[string]*DatabasePoolUsage
+	// Ensure lists pools to create when missing. They get an equal share of
+	// the connections left after the sized pools.
+	Ensure []*DatabasePoolTarget
+	// ReservedConnections is the number of connections kept out of the pools
+	// for direct connections, such as migrations and admin tools. Defaults to
+	// a tenth of the cluster's connections.
+	ReservedConnections int
+	// Headroom multiplies the observed demand of a pool. Defaults to 1.25.
+	Headroom float64
+}
+
+// DatabasePoolAction is the change a DatabasePoolRecommendation makes.
+type DatabasePoolAction string
+
+// Actions of a DatabasePoolRecommendation.
+const (
+	DatabasePoolKeep   DatabasePoolAction = "keep"
+	DatabasePoolCreate DatabasePoolAction = "create"
+	DatabasePoolUpdate DatabasePoolAction = "update"
+)
+
+// DatabasePoolRecommendation is the recommended size and mode of a pool.
+type DatabasePoolRecommendation struct {
+	Action   DatabasePoolAction
+	Name     string
+	User     string
+	Database string
+
+	CurrentSize int
+	CurrentMode string
+	Size        int
+	Mode        string
+	Reason      string
+}
+
+// DatabasePoolPlan is the result of PlanDatabasePools.
+type DatabasePoolPlan struct {
+	DatabaseID string
+	// MaxConnections is the number of backend connections the cluster
+	// allows and Budget the part of it given to the pools.
+	MaxConnections  int
+	Budget          int
+	Recommendations []*DatabasePoolRecommendation
+	Warnings        []string
+}
+
+// PlanDatabasePools recommends sizes and modes for the connection pools of a
+// PostgreSQL cluster. The cluster's connection limit is derived from the
+// memory of its size slug; the pools share it, less the reserved
+// connections, in proportion to their demand with some headroom. Pools
+// with usage whose clients use session features are recommended session
+// mode, others transaction mode; pools without usage keep their mode.
+//
+// Nothing is changed on the cluster; the plan can be applied with
+// ApplyDatabasePoolPlan.
+func PlanDatabasePools(ctx context.Context, client *Client, databaseID string, opts *DatabasePoolAdvisorOptions) (*DatabasePoolPlan, error) {
+	if databaseID == "" {
+		return nil, NewArgError("databaseID", "cannot be empty")
+	}
+	if opts == nil {
+		opts = &DatabasePoolAdvisorOptions{}
+	}
+	headroom := opts.Headroom
+	if headroom <= 0 {
+		headroom = defaultPoolHeadroom
+	}
+
+	db, _, err := client.Databases.Get(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	if db.EngineSlug != DatabaseEnginePostgres && db.EngineSlug != DatabaseEngineAdvancedPostgres {
+		return nil, fmt.Errorf("godo: connection pools are only supported by PostgreSQL clusters, not %q", db.EngineSlug)
+	}
+
+	plan := &DatabasePoolPlan{DatabaseID: databaseID}
+	memory, ok := databaseSizeMemoryGiB(db.SizeSlug)
+	if !ok {
+		return nil, fmt.Errorf("godo: can't determine the memory of database size %q", db.SizeSlug)
+	}
+	plan.MaxConnections = memory*databaseConnectionsPerGiB - databaseReservedConnections
+
+	options, _, err := client.Databases.ListOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !databaseLayoutHasSize(databaseEngineOptions(options, db.EngineSlug).Layouts, db.NumNodes, db.SizeSlug) {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("size %s with %d nodes is no longer offered; consider resizing", db.SizeSlug, db.NumNodes))
+	}
+
+	reserved := opts.ReservedConnections
+	if reserved <= 0 {
+		reserved = plan.MaxConnections / 10
+	}
+	plan.Budget = plan.MaxConnections - reserved
+	if plan.Budget < 1 {
+		return nil, fmt.Errorf("godo: reserving %d of %d connections leaves none for pools", reserved, plan.MaxConnections)
+	}
+
+	pools, err := collectPages(func(opt *ListOptions) ([]DatabasePool, *Response, error) {
+		return client.Databases.ListPools(ctx, databaseID, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(pools))
+	demands := make([]float64, 0, len(pools)+len(opts.Ensure))
+	for _, p := range pools {
+		existing[p.Name] = true
+		rec := &DatabasePoolRecommendation{
+			Name:        p.Name,
+			User:        p.User,
+			Database:    p.Database,
+			CurrentSize: p.Size,
+			CurrentMode: p.Mode,
+			Mode:        p.Mode,
+		}
+		demand := float64(p.Size)
+		if u := opts.Usage[p.Name]; u != nil {
+			demand = float64(u.PeakServerConnections+u.PeakWaitingClients) * headroom
+			rec.Mode = DatabasePoolModeTransaction
+			if u.SessionFeatures {
+				rec.Mode = DatabasePoolModeSession
+			}
+			switch {
+			case u.PeakWaitingClients > 0:
+				rec.Reason = fmt.Sprintf("%d clients waited for a connection", u.PeakWaitingClients)
+			default:
+				rec.Reason = fmt.Sprintf("peak usage of %d connections", u.PeakServerConnections)
+			}
+		}
+		plan.Recommendations = append(plan.Recommendations, rec)
+		demands = append(demands, math.Max(demand, 1))
+	}
+
+	// Missing pools share what the sized pools leave, or, when the pools
+	// already use the whole budget, get as much as an average pool.
+	var missing []*DatabasePoolTarget
+	for _, t := range opts.Ensure {
+		if t != nil && !existing[t.Name] {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		var total float64
+		for _, d := range demands {
+			total += d
+		}
+		share := (float64(plan.Budget) - total) / float64(len(missing))
+		if len(demands) > 0 {
+			share = math.Max(share, total/float64(len(demands)))
+		}
+		for _, t := range missing {
+			plan.Recommendations = append(plan.Recommendations, &DatabasePoolRecommendation{
+				Action:   DatabasePoolCreate,
+				Name:     t.Name,
+				User:     t.User,
+				Database: t.Database,
+				Mode:     DatabasePoolModeTransaction,
+				Reason:   "pool does not exist",
+			})
+			demands = append(demands, math.Max(share, 1))
+		}
+	}
+
+	sizes := allocatePoolSizes(demands, plan.Budget)
+	for i, rec := range plan.Recommendations {
+		rec.Size = sizes[i]
+		if rec.Action == DatabasePoolCreate {
+			continue
+		}
+		if rec.Size == rec.CurrentSize && rec.Mode == rec.CurrentMode {
+			rec.Action = DatabasePoolKeep
+			continue
+		}
+		rec.Action = DatabasePoolUpdate
+		if rec.Reason == "" {
+			rec.Reason = "pools exceed the connection budget"
+			if rec.Mode != rec.CurrentMode {
+				rec.Reason = "transaction mode shares connections between clients"
+			}
+		}
+	}
+	if sumInts(sizes) < len(sizes) {
+		plan.Warnings = append(plan.Warnings, "there are more pools than connections; consider a larger size")
+	}
+	return plan, nil
+}
+
+// ApplyDatabasePoolPlan creates and updates the pools of a plan. It stops at
+// the first error.
+func ApplyDatabasePoolPlan(ctx context.Context, client *Client, plan *DatabasePoolPlan) error {
+	if plan == nil {
+		return NewArgError("plan", "cannot be nil")
+	}
+	for _, rec := range plan.Recommendations {
+		var err error
+		switch rec.Action {
+		case DatabasePoolCreate:
+			_, _, err = client.Databases.CreatePool(ctx, plan.DatabaseID, &DatabaseCreatePoolRequest{
+				Name:     rec.Name,
+				User:     rec.User,
+				Database: rec.Database,
+				Size:     rec.Size,
+				Mode:     rec.Mode,
+			})
+		case DatabasePoolUpdate:
+			_, err = client.Databases.UpdatePool(ctx, plan.DatabaseID, rec.Name, &DatabaseUpdatePoolRequest{
+				User:     rec.User,
+				Database: rec.Database,
+				Size:     rec.Size,
+				Mode:     rec.Mode,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("godo: %s pool %s: %w", rec.Action, rec.Name, err)
+		}
+	}
+	return nil
+}
+
+// allocatePoolSizes rounds the demands up to whole connections and, if they
+// exceed the budget, scales them down proportionally. Every pool gets at
+// least one connection. Connections lost to rounding down are handed out to
+// the pools with the largest remainders.
+func allocatePoolSizes(demands []float64, budget int) []int {
+	sizes := make([]int, len(demands))
+	var total float64
+	for i, d := range demands {
+		sizes[i] = int(math.Ceil(d))
+		total += float64(sizes[i])
+	}
+	if int(total) <= budget {
+		return sizes
+	}
+
+	scale := float64(budget) / total
+	type remainder struct {
+		i    int
+		frac float64
+	}
+	rems := make([]remainder, len(sizes))
+	for i := range sizes {
+		exact := float64(sizes[i]) * scale
+		sizes[i] = max(int(exact), 1)
+		rems[i] = remainder{i, exact - math.Floor(exact)}
+	}
+	sort.SliceStable(rems, func(a, b int) bool { return rems[a].frac > rems[b].frac })
+	for left, k := budget-sumInts(sizes), 0; left > 0 && k < len(rems); k++ {
+		sizes[rems[k].i]++
+		left--
+	}
+	return sizes
+}
+
+func sumInts(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// databaseSizeMemoryGiB returns the memory of a database size slug such as
+// db-s-2vcpu-4gb.
+func databaseSizeMemoryGiB(slug string) (int, bool) {
+	m := databaseSizeMemoryRE.FindStringSubmatch(slug)
+	if m == nil {
+		return 0, false
+	}
+	gib, err := strconv.Atoi(m[1])
+	return gib, err == nil && gib > 0
+}
+
+func databaseLayoutHasSize(layouts []DatabaseLayout, nodes int, size string) bool {
+	for _, l := range layouts {
+		if l.NodeNum != nodes {
+			continue
+		}
+		for _, s := range l.Sizes {
+			if s == size {
+				return true
+			}
+		}
+	}
+	return false
+}
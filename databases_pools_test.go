@@ -0,0 +1,140 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocatePoolSizes(t *testing.T) {
+	assert.Equal(t, []int{10, 5}, allocatePoolSizes([]float64{9.2, 5}, 20))
+	assert.Equal(t, []int{15, 5}, allocatePoolSizes([]float64{30, 10}, 20))
+	assert.Equal(t, []int{1, 1, 1}, allocatePoolSizes([]float64{1, 1, 1}, 2))
+}
+
+func TestDatabaseSizeMemoryGiB(t *testing.T) {
+	gib, ok := databaseSizeMemoryGiB("db-s-2vcpu-4gb")
+	assert.True(t, ok)
+	assert.Equal(t, 4, gib)
+	gib, ok = databaseSizeMemoryGiB("gd-8vcpu-32gb")
+	assert.True(t, ok)
+	assert.Equal(t, 32, gib)
+	_, ok = databaseSizeMemoryGiB("db-s-custom")
+	assert.False(t, ok)
+}
+
+func serveTestPoolCluster(engine string) {
+	mux.HandleFunc("/v2/databases/db-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"database": {"id": "db-id", "engine": %q, "size": "db-s-2vcpu-4gb", "num_nodes": 1}}`, engine)
+	})
+	mux.HandleFunc("/v2/databases/options", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"options": {
+			"pg": {"layouts": [{"num_nodes": 1, "sizes": ["db-s-1vcpu-2gb"]}]},
+			"advanced_pg": {"layouts": [{"num_nodes": 1, "sizes": ["db-s-2vcpu-4gb"]}]}
+		}}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			return
+		}
+		fmt.Fprint(w, `{"pools": [
+			{"name": "web", "user": "app", "db": "app", "size": 60, "mode": "session"},
+			{"name": "jobs", "user": "app", "db": "app", "size": 10, "mode": "transaction"},
+			{"name": "admin", "user": "admin", "db": "app", "size": 5, "mode": "session"}
+		]}`)
+	})
+}
+
+func TestPlanDatabasePools(t *testing.T) {
+	setup()
+	defer teardown()
+	serveTestPoolCluster("pg")
+
+	plan, err := PlanDatabasePools(ctx, client, "db-id", &DatabasePoolAdvisorOptions{
+		Usage: map[string]*DatabasePoolUsage{
+			"web":  {PeakServerConnections: 16},
+			"jobs": {PeakServerConnections: 10, PeakWaitingClients: 6},
+		},
+		Ensure: []*DatabasePoolTarget{
+			{Name: "jobs", User: "app", Database: "app"},
+			{Name: "reports", User: "reporting", Database: "app"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 97, plan.MaxConnections)
+	assert.Equal(t, 88, plan.Budget)
+	assert.Len(t, plan.Warnings, 1)
+
+	type rec struct {
+		Action DatabasePoolAction
+		Name   string
+		Size   int
+		Mode   string
+	}
+	var got []rec
+	for _, r := range plan.Recommendations {
+		got = append(got, rec{r.Action, r.Name, r.Size, r.Mode})
+	}
+	assert.Equal(t, []rec{
+		{DatabasePoolUpdate, "web", 20, "transaction"},
+		{DatabasePoolUpdate, "jobs", 20, "transaction"},
+		{DatabasePoolKeep, "admin", 5, "session"},
+		{DatabasePoolCreate, "reports", 43, "transaction"},
+	}, got)
+	assert.Equal(t, "6 clients waited for a connection", plan.Recommendations[1].Reason)
+
+	// Serve the writes made by the plan on a fresh mux.
+	var (
+		created []DatabaseCreatePoolRequest
+		updated []string
+	)
+	teardown()
+	setup()
+	mux.HandleFunc("/v2/databases/db-id/pools", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		var req DatabaseCreatePoolRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		created = append(created, req)
+		fmt.Fprintf(w, `{"pool": {"name": %q}}`, req.Name)
+	})
+	mux.HandleFunc("/v2/databases/db-id/pools/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPut)
+		var req DatabaseUpdatePoolRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		updated = append(updated, fmt.Sprintf("%s=%d/%s", r.URL.Path, req.Size, req.Mode))
+	})
+
+	require.NoError(t, ApplyDatabasePoolPlan(ctx, client, plan))
+	assert.Equal(t, []string{
+		"/v2/databases/db-id/pools/web=20/transaction",
+		"/v2/databases/db-id/pools/jobs=20/transaction",
+	}, updated)
+	assert.Equal(t, []DatabaseCreatePoolRequest{
+		{Name: "reports", User: "reporting", Database: "app", Size: 43, Mode: "transaction"},
+	}, created)
+}
+
+func TestPlanDatabasePools_AdvancedPostgres(t *testing.T) {
+	setup()
+	defer teardown()
+	serveTestPoolCluster("advanced_pg")
+
+	plan, err := PlanDatabasePools(ctx, client, "db-id", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 97, plan.MaxConnections)
+	assert.Empty(t, plan.Warnings)
+}
+
+func TestPlanDatabasePools_NotPostgres(t *testing.T) {
+	setup()
+	defer teardown()
+	serveTestPoolCluster("mysql")
+
+	_, err := PlanDatabasePools(ctx, client, "db-id", nil)
+	assert.ErrorContains(t, err, "only supported by PostgreSQL")
+}
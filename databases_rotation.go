@@ -0,0 +1,352 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DatabaseCredentialRotationStepName identifies a step of a credential rotation.
+type DatabaseCredentialRotationStepName string
+
+const (
+	// DatabaseRotationStepCreateUser creates the new database user.
+	DatabaseRotationStepCreateUser DatabaseCredentialRotationStepName = "create_user"
+	// DatabaseRotationStepResetUserAuth resets the credentials of an existing user.
+	DatabaseRotationStepResetUserAuth DatabaseCredentialRotationStepName = "reset_user_auth"
+	// DatabaseRotationStepBuildValue builds the value written to the
+	// consumers with the request's Value function.
+	DatabaseRotationStepBuildValue DatabaseCredentialRotationStepName = "build_value"
+	// DatabaseRotationStepUpdateSecret writes the new credential to a secret.
+	DatabaseRotationStepUpdateSecret DatabaseCredentialRotationStepName = "update_secret"
+	// DatabaseRotationStepUpdateApp writes the new credential to an app env var.
+	DatabaseRotationStepUpdateApp DatabaseCredentialRotationStepName = "update_app"
+	// DatabaseRotationStepVerifyUser checks the new credential with GetUser.
+	DatabaseRotationStepVerifyUser DatabaseCredentialRotationStepName = "verify_user"
+	// DatabaseRotationStepGracePeriod waits before the old user is deleted.
+	DatabaseRotationStepGracePeriod DatabaseCredentialRotationStepName = "grace_period"
+	// DatabaseRotationStepDeleteOldUser deletes the user that was rotated away from.
+	DatabaseRotationStepDeleteOldUser DatabaseCredentialRotationStepName = "delete_old_user"
+)
+
+// DatabaseCredentialRotationRequest configures RotateDatabaseCredentials.
+type DatabaseCredentialRotationRequest struct {
+	DatabaseID string
+	// OldUser is the name of the user whose credentials are rotated.
+	OldUser string
+	// NewUser is the name of the user to create. When empty, the credentials
+	// of OldUser are reset in place with ResetUserAuth and no user is deleted.
+	NewUser string
+
+	// MySQLSettings and Settings are used when creating NewUser or resetting
+	// OldUser.
+	MySQLSettings *DatabaseMySQLUserSettings
+	Settings      *DatabaseUserSettings
+
+	// Secret, if set, is updated with the new credential.
+	Secret *DatabaseCredentialSecretTarget
+	// AppEnv, if set, is updated with the new credential. This triggers a
+	// new deployment of the app.
+	AppEnv *DatabaseCredentialAppEnvTarget
+	// Value returns the value written to Secret and AppEnv for the rotated
+	// user, such as a connection string built with DatabasePostgresURL.
+	// Defaults to the user's password.
+	Value func(user *DatabaseUser) (string, error)
+
+	// GracePeriod is how long to wait after the consumers are updated before
+	// OldUser is deleted, giving them time to pick up the new credential.
+	GracePeriod time.Duration
+}
+
+// DatabaseCredentialSecretTarget is a secret key updated by a rotation.
+type DatabaseCredentialSecretTarget struct {
+	Name   string
+	Region string
+	Key    string
+}
+
+// DatabaseCredentialAppEnvTarget is an App Platform env var updated by a
+// rotation. When Component is empty, the app-level env var is updated.
+type DatabaseCredentialAppEnvTarget struct {
+	AppID     string
+	Component string
+	Key       string
+}
+
+// DatabaseCredentialRotationStep is the audit record of a rotation step.
+type DatabaseCredentialRotationStep struct {
+	Name      DatabaseCredentialRotationStepName
+	StartedAt time.Time
+	EndedAt   time.Time
+	// Detail describes what the step did. It never contains credentials.
+	Detail string
+	Err    error
+}
+
+// DatabaseCredentialRotationReport is the audit record of a rotation.
+type DatabaseCredentialRotationReport struct {
+	DatabaseID string
+	OldUser    string
+	NewUser    string
+	Steps      []*DatabaseCredentialRotationStep
+}
+
+// Failed returns the step that failed, or nil if all steps succeeded.
+func (r *DatabaseCredentialRotationReport) Failed() *DatabaseCredentialRotationStep {
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return step
+		}
+	}
+	return nil
+}
+
+// RotateDatabaseCredentials rotates the credentials of a database user and
+// propagates them to the configured consumers. It creates NewUser (or resets
+// OldUser when NewUser is empty), updates Secret and AppEnv, checks with
+// GetUser that the cluster reports the new credential and finally, after
+// GracePeriod, deletes OldUser.
+//
+// The rotation stops at the first failing step, whose error is returned
+// along with the report. OldUser is only deleted once every other step has
+// succeeded.
+func RotateDatabaseCredentials(ctx context.Context, client *Client, req *DatabaseCredentialRotationRequest) (*DatabaseCredentialRotationReport, error) {
+	if req == nil || req.DatabaseID == "" {
+		return nil, NewArgError("req.DatabaseID", "cannot be empty")
+	}
+	if req.OldUser == "" {
+		return nil, NewArgError("req.OldUser", "cannot be empty")
+	}
+	if req.NewUser == req.OldUser {
+		return nil, NewArgError("req.NewUser", "must differ from req.OldUser")
+	}
+	if t := req.Secret; t != nil && (t.Name == "" || t.Region == "" || t.Key == "") {
+		return nil, NewArgError("req.Secret", "must have a name, region and key")
+	}
+	if t := req.AppEnv; t != nil && (t.AppID == "" || t.Key == "") {
+		return nil, NewArgError("req.AppEnv", "must have an app ID and key")
+	}
+
+	report := &DatabaseCredentialRotationReport{
+		DatabaseID: req.DatabaseID,
+		OldUser:    req.OldUser,
+		NewUser:    req.NewUser,
+	}
+	if report.NewUser == "" {
+		report.NewUser = req.OldUser
+	}
+	step := func(name DatabaseCredentialRotationStepName, fn func() (string, error)) error {
+		s := &DatabaseCredentialRotationStep{Name: name, StartedAt: time.Now()}
+		s.Detail, s.Err = fn()
+		s.EndedAt = time.Now()
+		report.Steps = append(report.Steps, s)
+		return s.Err
+	}
+
+	var user *DatabaseUser
+	if req.NewUser != "" {
+		err := step(DatabaseRotationStepCreateUser, func() (string, error) {
+			var err error
+			user, _, err = client.Databases.CreateUser(ctx, req.DatabaseID, &DatabaseCreateUserRequest{
+				Name:          req.NewUser,
+				MySQLSettings: req.MySQLSettings,
+				Settings:      req.Settings,
+			})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("created user %s", user.Name), nil
+		})
+		if err != nil {
+			return report, err
+		}
+	} else {
+		err := step(DatabaseRotationStepResetUserAuth, func() (string, error) {
+			var err error
+			user, _, err = client.Databases.ResetUserAuth(ctx, req.DatabaseID, req.OldUser, &DatabaseResetUserAuthRequest{
+				MySQLSettings: req.MySQLSettings,
+				Settings:      req.Settings,
+			})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("reset credentials of user %s", req.OldUser), nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if req.Secret != nil || req.AppEnv != nil {
+		value := user.Password
+		if req.Value != nil {
+			err := step(DatabaseRotationStepBuildValue, func() (string, error) {
+				var err error
+				if value, err = req.Value(user); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("built the value for user %s", user.Name), nil
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+
+		if t := req.Secret; t != nil {
+			err := step(DatabaseRotationStepUpdateSecret, func() (string, error) {
+				return updateRotatedSecret(ctx, client, t, value)
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+		if t := req.AppEnv; t != nil {
+			err := step(DatabaseRotationStepUpdateApp, func() (string, error) {
+				return updateRotatedAppEnv(ctx, client, t, value)
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	err := step(DatabaseRotationStepVerifyUser, func() (string, error) {
+		got, _, err := client.Databases.GetUser(ctx, req.DatabaseID, user.Name)
+		if err != nil {
+			return "", err
+		}
+		if got.Password != user.Password || got.AccessKey != user.AccessKey {
+			return "", fmt.Errorf("godo: user %s does not report the rotated credentials", user.Name)
+		}
+		return fmt.Sprintf("user %s reports the rotated credentials", user.Name), nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if req.NewUser == "" {
+		return report, nil
+	}
+
+	if req.GracePeriod > 0 {
+		err := step(DatabaseRotationStepGracePeriod, func() (string, error) {
+			select {
+			case <-time.After(req.GracePeriod):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			return fmt.Sprintf("waited %s", req.GracePeriod), nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	err = step(DatabaseRotationStepDeleteOldUser, func() (string, error) {
+		if _, err := client.Databases.DeleteUser(ctx, req.DatabaseID, req.OldUser); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("deleted user %s", req.OldUser), nil
+	})
+	return report, err
+}
+
+// updateRotatedSecret sets a key of an existing secret, keeping its other
+// values. The update is made against the version that was read so that a
+// concurrent change is not overwritten.
+func updateRotatedSecret(ctx context.Context, client *Client, t *DatabaseCredentialSecretTarget, value string) (string, error) {
+	secret, _, err := client.Secrets.Get(ctx, t.Name, t.Region)
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string]string, len(secret.Values)+1)
+	for k, v := range secret.Values {
+		values[k] = v
+	}
+	values[t.Key] = value
+
+	result, _, err := client.Secrets.Update(ctx, t.Name, &SecretUpdateRequest{
+		Region:  t.Region,
+		Version: secret.Version,
+		Values:  values,
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("set key %s of secret %s to version %d", t.Key, t.Name, result.Version), nil
+}
+
+// updateRotatedAppEnv sets an env var of an app, as a secret, and updates
+// the app with the modified spec.
+func updateRotatedAppEnv(ctx context.Context, client *Client, t *DatabaseCredentialAppEnvTarget, value string) (string, error) {
+	app, _, err := client.Apps.Get(ctx, t.AppID)
+	if err != nil {
+		return "", err
+	}
+	if app.Spec == nil {
+		return "", errors.New("godo: app has no spec")
+	}
+
+	envs, err := appSpecEnvs(app.Spec, t.Component)
+	if err != nil {
+		return "", err
+	}
+	var env *AppVariableDefinition
+	for _, e := range *envs {
+		if e.Key == t.Key {
+			env = e
+			break
+		}
+	}
+	if env == nil {
+		env = &AppVariableDefinition{Key: t.Key}
+		*envs = append(*envs, env)
+	}
+	env.Value = value
+	env.Type = AppVariableType_Secret
+
+	updated, _, err := client.Apps.Update(ctx, t.AppID, &AppUpdateRequest{Spec: app.Spec})
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("set env var %s of app %s", t.Key, t.AppID)
+	if t.Component != "" {
+		detail = fmt.Sprintf("set env var %s of component %s of app %s", t.Key, t.Component, t.AppID)
+	}
+	if id := appDeploymentID(updated); id != "" {
+		detail += fmt.Sprintf(", deployment %s", id)
+	}
+	return detail, nil
+}
+
+// appSpecEnvs returns the env vars of the named component of spec, or of
+// the app itself when component is empty.
+func appSpecEnvs(spec *AppSpec, component string) (*[]*AppVariableDefinition, error) {
+	if component == "" {
+		return &spec.Envs, nil
+	}
+	var envs *[]*AppVariableDefinition
+	_ = spec.ForEachAppComponentSpec(func(c AppComponentSpec) error {
+		if c.GetName() != component {
+			return nil
+		}
+		switch c := c.(type) {
+		case *AppServiceSpec:
+			envs = &c.Envs
+		case *AppWorkerSpec:
+			envs = &c.Envs
+		case *AppJobSpec:
+			envs = &c.Envs
+		case *AppStaticSiteSpec:
+			envs = &c.Envs
+		case *AppFunctionsSpec:
+			envs = &c.Envs
+		}
+		return nil
+	})
+	if envs == nil {
+		return nil, fmt.Errorf("godo: app has no component %s with env vars", component)
+	}
+	return envs, nil
+}
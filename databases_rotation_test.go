@@ -0,0 +1,204 @@
+package godo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rotationStepNames(r *DatabaseCredentialRotationReport) []DatabaseCredentialRotationStepName {
+	var names []DatabaseCredentialRotationStepName
+	for _, s := range r.Steps {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestRotateDatabaseCredentials_NewUser(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var deleted []string
+	mux.HandleFunc("/v2/databases/db-id/users", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		var req DatabaseCreateUserRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "app-v2", req.Name)
+		fmt.Fprint(w, `{"user": {"name": "app-v2", "password": "new-pass"}}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/users/app-v2", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"user": {"name": "app-v2", "password": "new-pass"}}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/users/app-v1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, "app-v1")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var secretUpdate SecretUpdateRequest
+	mux.HandleFunc("/v2/security/secrets/db-creds", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			assert.Equal(t, "nyc3", r.URL.Query().Get("region"))
+			fmt.Fprint(w, `{"secret": "db-creds", "version": 3, "values": {"user": "app-v1", "password": "old-pass"}}`)
+		case http.MethodPut:
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&secretUpdate))
+			fmt.Fprint(w, `{"name": "db-creds", "region": "nyc3", "version": 4}`)
+		}
+	})
+
+	var appUpdate AppUpdateRequest
+	mux.HandleFunc("/v2/apps/app-id", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"app": {"id": "app-id", "spec": {"name": "app", "services": [
+				{"name": "web", "envs": [{"key": "DATABASE_URL", "value": "EV[old]", "type": "SECRET"}]}
+			]}}}`)
+		case http.MethodPut:
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&appUpdate))
+			fmt.Fprint(w, `{"app": {"id": "app-id", "pending_deployment": {"id": "dep-id"}}}`)
+		}
+	})
+
+	report, err := RotateDatabaseCredentials(ctx, client, &DatabaseCredentialRotationRequest{
+		DatabaseID: "db-id",
+		OldUser:    "app-v1",
+		NewUser:    "app-v2",
+		Secret:     &DatabaseCredentialSecretTarget{Name: "db-creds", Region: "nyc3", Key: "password"},
+		AppEnv:     &DatabaseCredentialAppEnvTarget{AppID: "app-id", Component: "web", Key: "DATABASE_URL"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, report.Failed())
+	assert.Equal(t, "app-v2", report.NewUser)
+	assert.Equal(t, []DatabaseCredentialRotationStepName{
+		DatabaseRotationStepCreateUser,
+		DatabaseRotationStepUpdateSecret,
+		DatabaseRotationStepUpdateApp,
+		DatabaseRotationStepVerifyUser,
+		DatabaseRotationStepDeleteOldUser,
+	}, rotationStepNames(report))
+	assert.Contains(t, report.Steps[2].Detail, "deployment dep-id")
+
+	assert.Equal(t, SecretUpdateRequest{
+		Region:  "nyc3",
+		Version: 3,
+		Values:  map[string]string{"user": "app-v1", "password": "new-pass"},
+	}, secretUpdate)
+	assert.Equal(t, []*AppVariableDefinition{
+		{Key: "DATABASE_URL", Value: "new-pass", Type: AppVariableType_Secret},
+	}, appUpdate.Spec.Services[0].Envs)
+	assert.Equal(t, []string{"app-v1"}, deleted)
+}
+
+func TestRotateDatabaseCredentials_ResetUser(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/users/app/reset_auth", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		fmt.Fprint(w, `{"user": {"name": "app", "password": "new-pass"}}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/users/app", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"user": {"name": "app", "password": "new-pass"}}`)
+	})
+
+	var appUpdate AppUpdateRequest
+	mux.HandleFunc("/v2/apps/app-id", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"app": {"id": "app-id", "spec": {"name": "app"}}}`)
+		case http.MethodPut:
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&appUpdate))
+			fmt.Fprint(w, `{"app": {"id": "app-id"}}`)
+		}
+	})
+
+	report, err := RotateDatabaseCredentials(ctx, client, &DatabaseCredentialRotationRequest{
+		DatabaseID: "db-id",
+		OldUser:    "app",
+		AppEnv:     &DatabaseCredentialAppEnvTarget{AppID: "app-id", Key: "DATABASE_URL"},
+		Value: func(user *DatabaseUser) (string, error) {
+			return "postgres://" + user.Name + ":" + user.Password + "@db", nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []DatabaseCredentialRotationStepName{
+		DatabaseRotationStepResetUserAuth,
+		DatabaseRotationStepBuildValue,
+		DatabaseRotationStepUpdateApp,
+		DatabaseRotationStepVerifyUser,
+	}, rotationStepNames(report))
+	assert.Equal(t, []*AppVariableDefinition{
+		{Key: "DATABASE_URL", Value: "postgres://app:new-pass@db", Type: AppVariableType_Secret},
+	}, appUpdate.Spec.Envs)
+}
+
+func TestRotateDatabaseCredentials_VerifyFailureKeepsOldUser(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"user": {"name": "app-v2", "password": "new-pass"}}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/users/app-v2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"user": {"name": "app-v2", "password": "other"}}`)
+	})
+	mux.HandleFunc("/v2/databases/db-id/users/app-v1", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("old user must not be deleted")
+	})
+
+	report, err := RotateDatabaseCredentials(ctx, client, &DatabaseCredentialRotationRequest{
+		DatabaseID: "db-id",
+		OldUser:    "app-v1",
+		NewUser:    "app-v2",
+	})
+	require.Error(t, err)
+	failed := report.Failed()
+	require.NotNil(t, failed)
+	assert.Equal(t, DatabaseRotationStepVerifyUser, failed.Name)
+	assert.Equal(t, err, failed.Err)
+}
+
+func TestRotateDatabaseCredentials_ValueFailure(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/databases/db-id/users/app/reset_auth", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"user": {"name": "app", "password": "new-pass"}}`)
+	})
+	mux.HandleFunc("/v2/apps/app-id", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("app must not be updated")
+	})
+
+	report, err := RotateDatabaseCredentials(ctx, client, &DatabaseCredentialRotationRequest{
+		DatabaseID: "db-id",
+		OldUser:    "app",
+		AppEnv:     &DatabaseCredentialAppEnvTarget{AppID: "app-id", Key: "DATABASE_URL"},
+		Value: func(user *DatabaseUser) (string, error) {
+			return "", errors.New("no pool")
+		},
+	})
+	assert.EqualError(t, err, "no pool")
+	failed := report.Failed()
+	require.NotNil(t, failed)
+	assert.Equal(t, DatabaseRotationStepBuildValue, failed.Name)
+}
+
+func TestRotateDatabaseCredentials_InvalidRequest(t *testing.T) {
+	_, err := RotateDatabaseCredentials(ctx, client, &DatabaseCredentialRotationRequest{DatabaseID: "db-id"})
+	assert.Error(t, err)
+
+	_, err = RotateDatabaseCredentials(ctx, client, &DatabaseCredentialRotationRequest{
+		DatabaseID: "db-id",
+		OldUser:    "app",
+		Secret:     &DatabaseCredentialSecretTarget{Name: "db-creds"},
+	})
+	assert.Error(t, err)
+}
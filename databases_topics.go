@@ -0,0 +1,394 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// KafkaTopicSpec is the desired state of a Kafka topic.
+type KafkaTopicSpec struct {
+	Name string
+	// PartitionCount and ReplicationFactor are left unchanged when zero.
+	PartitionCount    uint32
+	ReplicationFactor uint32
+	// Config holds the desired topic settings. Only the fields that are set
+	// are compared with, and applied to, the live topic.
+	Config *TopicConfig
+}
+
+// KafkaTopicActionType is the kind of a KafkaTopicAction.
+type KafkaTopicActionType string
+
+const (
+	// KafkaTopicCreate creates a topic that does not exist.
+	KafkaTopicCreate KafkaTopicActionType = "create"
+	// KafkaTopicUpdate updates the partitions, replication or config of a topic.
+	KafkaTopicUpdate KafkaTopicActionType = "update"
+	// KafkaTopicDelete deletes a topic that is not in the desired state.
+	KafkaTopicDelete KafkaTopicActionType = "delete"
+)
+
+// KafkaTopicChange is a single setting changed by a KafkaTopicAction.
+type KafkaTopicChange struct {
+	// Field is the JSON name of the setting, e.g. "partition_count" or
+	// "retention_ms".
+	Field string
+	// Old is the live value, empty when unknown.
+	Old string
+	New string
+}
+
+// KafkaTopicConsumerGroup is the offset committed by a consumer group on a
+// partition of a topic planned for deletion.
+type KafkaTopicConsumerGroup struct {
+	Group     string
+	Partition uint32
+	Offset    uint64
+	// EarliestOffset is the earliest offset still retained by the partition.
+	EarliestOffset uint64
+	// Lag is the number of messages the group is behind on the partition.
+	// The API doesn't report the end offset of a partition, so the lag is
+	// measured against the furthest offset committed on it by any group, or
+	// EarliestOffset if that is further. It is a lower bound of the lag.
+	Lag uint64
+}
+
+// KafkaTopicAction is a step of a KafkaTopicPlan.
+type KafkaTopicAction struct {
+	Type    KafkaTopicActionType
+	Name    string
+	Changes []*KafkaTopicChange
+	// ConsumerGroups lists, for deletions, the consumer groups with offsets
+	// committed on the topic, which are likely still reading it.
+	ConsumerGroups []*KafkaTopicConsumerGroup
+	// ConsumerLag is the sum of the Lag of ConsumerGroups.
+	ConsumerLag uint64
+
+	create *DatabaseCreateTopicRequest
+	update *DatabaseUpdateTopicRequest
+}
+
+// KafkaTopicRefusal is a change needed to reach the desired state that
+// PlanKafkaTopics refuses to make.
+type KafkaTopicRefusal struct {
+	Name   string
+	Reason string
+}
+
+// KafkaTopicPlan is the set of actions that reconcile the topics of a Kafka
+// cluster with a desired state.
+type KafkaTopicPlan struct {
+	DatabaseID string
+	Actions    []*KafkaTopicAction
+	// Refused lists the unsafe changes left out of Actions. A plan with
+	// refusals can't be applied.
+	Refused []*KafkaTopicRefusal
+}
+
+// PlanKafkaTopicsOptions configures PlanKafkaTopics.
+type PlanKafkaTopicsOptions struct {
+	// Prune deletes the live topics that are not in the desired state.
+	// Topics whose name starts with "__" are internal and never deleted.
+	Prune bool
+	// AllowDeleteConsumed allows deleting topics that consumer groups have
+	// committed offsets on. Such deletions are refused otherwise.
+	AllowDeleteConsumed bool
+}
+
+// HasChanges reports whether the plan contains any actions.
+func (p *KafkaTopicPlan) HasChanges() bool {
+	return p != nil && len(p.Actions) > 0
+}
+
+// String renders the plan in a human-readable form, one action per line
+// followed by its changes. Refusals are listed last.
+func (p *KafkaTopicPlan) String() string {
+	var b strings.Builder
+	if !p.HasChanges() && (p == nil || len(p.Refused) == 0) {
+		return "no changes\n"
+	}
+	for _, a := range p.Actions {
+		switch a.Type {
+		case KafkaTopicCreate:
+			fmt.Fprintf(&b, "+ topic %s\n", a.Name)
+		case KafkaTopicDelete:
+			fmt.Fprintf(&b, "- topic %s\n", a.Name)
+		default:
+			fmt.Fprintf(&b, "~ topic %s\n", a.Name)
+		}
+		for _, c := range a.Changes {
+			if c.Old == "" {
+				fmt.Fprintf(&b, "  %s: %s\n", c.Field, c.New)
+			} else {
+				fmt.Fprintf(&b, "  %s: %s -> %s\n", c.Field, c.Old, c.New)
+			}
+		}
+		for _, g := range a.ConsumerGroups {
+			fmt.Fprintf(&b, "  consumer group %s: partition %d at offset %d (earliest %d, lag %d)\n", g.Group, g.Partition, g.Offset, g.EarliestOffset, g.Lag)
+		}
+		if len(a.ConsumerGroups) > 0 {
+			fmt.Fprintf(&b, "  consumer lag: %d\n", a.ConsumerLag)
+		}
+	}
+	for _, r := range p.Refused {
+		fmt.Fprintf(&b, "! topic %s: %s\n", r.Name, r.Reason)
+	}
+	return b.String()
+}
+
+// PlanKafkaTopics compares the topics of a Kafka cluster with the desired
+// topics and returns the actions needed to reconcile them. Nothing is
+// changed on the cluster.
+//
+// Decreasing the partition count of a topic and setting a replication factor
+// below the topic's min_insync_replicas are refused, as is deleting a topic
+// that consumer groups are reading unless AllowDeleteConsumed is set.
+func PlanKafkaTopics(ctx context.Context, client *Client, databaseID string, desired []*KafkaTopicSpec, opts *PlanKafkaTopicsOptions) (*KafkaTopicPlan, error) {
+	if databaseID == "" {
+		return nil, NewArgError("databaseID", "cannot be empty")
+	}
+	if opts == nil {
+		opts = &PlanKafkaTopicsOptions{}
+	}
+	wanted := make(map[string]*KafkaTopicSpec, len(desired))
+	for _, spec := range desired {
+		if spec == nil || spec.Name == "" {
+			return nil, NewArgError("desired", "topics must have a name")
+		}
+		if _, ok := wanted[spec.Name]; ok {
+			return nil, NewArgError("desired", fmt.Sprintf("topic %s is listed more than once", spec.Name))
+		}
+		wanted[spec.Name] = spec
+	}
+
+	live, err := listAllTopics(ctx, client, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(live))
+
+	plan := &KafkaTopicPlan{DatabaseID: databaseID}
+	for _, summary := range live {
+		existing[summary.Name] = true
+		spec, ok := wanted[summary.Name]
+		if !ok && (!opts.Prune || strings.HasPrefix(summary.Name, "__")) {
+			continue
+		}
+
+		// Topic listings don't always include the partitions and config,
+		// so the topic is fetched in full before it is compared.
+		topic, _, err := client.Databases.GetTopic(ctx, databaseID, summary.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			action := &KafkaTopicAction{
+				Type:           KafkaTopicDelete,
+				Name:           topic.Name,
+				ConsumerGroups: topicConsumerGroups(topic),
+			}
+			for _, g := range action.ConsumerGroups {
+				action.ConsumerLag += g.Lag
+			}
+			if len(action.ConsumerGroups) > 0 && !opts.AllowDeleteConsumed {
+				plan.Refused = append(plan.Refused, &KafkaTopicRefusal{
+					Name: topic.Name,
+					Reason: fmt.Sprintf("topic has %d consumer group offsets with a lag of %d and AllowDeleteConsumed is not set",
+						len(action.ConsumerGroups), action.ConsumerLag),
+				})
+				continue
+			}
+			plan.Actions = append(plan.Actions, action)
+			continue
+		}
+
+		action, refusal := planTopicUpdate(topic, spec)
+		if refusal != nil {
+			plan.Refused = append(plan.Refused, refusal)
+			continue
+		}
+		if action != nil {
+			plan.Actions = append(plan.Actions, action)
+		}
+	}
+
+	for _, spec := range desired {
+		if existing[spec.Name] {
+			continue
+		}
+		req := &DatabaseCreateTopicRequest{Name: spec.Name, Config: spec.Config}
+		action := &KafkaTopicAction{Type: KafkaTopicCreate, Name: spec.Name, create: req}
+		if spec.PartitionCount > 0 {
+			req.PartitionCount = PtrTo(spec.PartitionCount)
+			action.Changes = append(action.Changes, &KafkaTopicChange{Field: "partition_count", New: fmt.Sprint(spec.PartitionCount)})
+		}
+		if spec.ReplicationFactor > 0 {
+			req.ReplicationFactor = PtrTo(spec.ReplicationFactor)
+			action.Changes = append(action.Changes, &KafkaTopicChange{Field: "replication_factor", New: fmt.Sprint(spec.ReplicationFactor)})
+		}
+		action.Changes = append(action.Changes, diffTopicConfig(nil, spec.Config)...)
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	sort.SliceStable(plan.Actions, func(i, j int) bool {
+		return plan.Actions[i].Name < plan.Actions[j].Name
+	})
+	return plan, nil
+}
+
+// ApplyKafkaTopicPlan carries out the actions of a plan in order. A plan
+// with refusals is rejected before any action is taken. The actions that
+// completed before an error are returned with it.
+func ApplyKafkaTopicPlan(ctx context.Context, client *Client, plan *KafkaTopicPlan) ([]*KafkaTopicAction, error) {
+	if plan == nil {
+		return nil, NewArgError("plan", "cannot be nil")
+	}
+	if len(plan.Refused) > 0 {
+		return nil, fmt.Errorf("godo: plan has %d refused topic changes", len(plan.Refused))
+	}
+
+	var done []*KafkaTopicAction
+	for _, a := range plan.Actions {
+		var err error
+		switch a.Type {
+		case KafkaTopicCreate:
+			if a.create == nil {
+				return done, errors.New("godo: topic plan was not created by PlanKafkaTopics")
+			}
+			_, _, err = client.Databases.CreateTopic(ctx, plan.DatabaseID, a.create)
+		case KafkaTopicUpdate:
+			if a.update == nil {
+				return done, errors.New("godo: topic plan was not created by PlanKafkaTopics")
+			}
+			_, err = client.Databases.UpdateTopic(ctx, plan.DatabaseID, a.Name, a.update)
+		case KafkaTopicDelete:
+			_, err = client.Databases.DeleteTopic(ctx, plan.DatabaseID, a.Name)
+		}
+		if err != nil {
+			return done, fmt.Errorf("godo: %s topic %s: %w", a.Type, a.Name, err)
+		}
+		done = append(done, a)
+	}
+	return done, nil
+}
+
+func listAllTopics(ctx context.Context, client *Client, databaseID string) ([]DatabaseTopic, error) {
+	return collectPages(func(opt *ListOptions) ([]DatabaseTopic, *Response, error) {
+		return client.Databases.ListTopics(ctx, databaseID, opt)
+	})
+}
+
+// planTopicUpdate returns the action that updates a live topic to its spec,
+// nil if it is up to date, or a refusal if the update is unsafe.
+func planTopicUpdate(topic *DatabaseTopic, spec *KafkaTopicSpec) (*KafkaTopicAction, *KafkaTopicRefusal) {
+	req := &DatabaseUpdateTopicRequest{}
+	action := &KafkaTopicAction{Type: KafkaTopicUpdate, Name: topic.Name, update: req}
+
+	partitions := uint32(len(topic.Partitions))
+	if spec.PartitionCount > 0 && spec.PartitionCount != partitions {
+		if spec.PartitionCount < partitions {
+			return nil, &KafkaTopicRefusal{
+				Name:   topic.Name,
+				Reason: fmt.Sprintf("partition count can't be decreased from %d to %d", partitions, spec.PartitionCount),
+			}
+		}
+		req.PartitionCount = PtrTo(spec.PartitionCount)
+		action.Changes = append(action.Changes, &KafkaTopicChange{
+			Field: "partition_count",
+			Old:   fmt.Sprint(partitions),
+			New:   fmt.Sprint(spec.PartitionCount),
+		})
+	}
+
+	if spec.ReplicationFactor > 0 && (topic.ReplicationFactor == nil || *topic.ReplicationFactor != spec.ReplicationFactor) {
+		req.ReplicationFactor = PtrTo(spec.ReplicationFactor)
+		c := &KafkaTopicChange{Field: "replication_factor", New: fmt.Sprint(spec.ReplicationFactor)}
+		if topic.ReplicationFactor != nil {
+			c.Old = fmt.Sprint(*topic.ReplicationFactor)
+		}
+		action.Changes = append(action.Changes, c)
+	}
+
+	if spec.ReplicationFactor > 0 {
+		var minISR *uint32
+		if spec.Config != nil && spec.Config.MinInsyncReplicas != nil {
+			minISR = spec.Config.MinInsyncReplicas
+		} else if topic.Config != nil {
+			minISR = topic.Config.MinInsyncReplicas
+		}
+		if minISR != nil && spec.ReplicationFactor < *minISR {
+			return nil, &KafkaTopicRefusal{
+				Name:   topic.Name,
+				Reason: fmt.Sprintf("replication factor %d is below min_insync_replicas %d", spec.ReplicationFactor, *minISR),
+			}
+		}
+	}
+
+	if changes := diffTopicConfig(topic.Config, spec.Config); len(changes) > 0 {
+		req.Config = spec.Config
+		action.Changes = append(action.Changes, changes...)
+	}
+
+	if len(action.Changes) == 0 {
+		return nil, nil
+	}
+	return action, nil
+}
+
+// diffTopicConfig returns the settings of desired that differ from live.
+// Settings that desired leaves unset are ignored.
+func diffTopicConfig(live, desired *TopicConfig) []*KafkaTopicChange {
+	if desired == nil {
+		return nil
+	}
+	if live == nil {
+		live = &TopicConfig{}
+	}
+	lv, dv := reflect.ValueOf(live).Elem(), reflect.ValueOf(desired).Elem()
+
+	var changes []*KafkaTopicChange
+	for i := 0; i < dv.NumField(); i++ {
+		d := dv.Field(i)
+		if d.IsZero() {
+			continue
+		}
+		l := lv.Field(i)
+		if reflect.DeepEqual(l.Interface(), d.Interface()) {
+			continue
+		}
+		c := &KafkaTopicChange{
+			Field: jsonFieldName(dv.Type().Field(i)),
+			New:   fmt.Sprint(reflect.Indirect(d).Interface()),
+		}
+		if !l.IsZero() {
+			c.Old = fmt.Sprint(reflect.Indirect(l).Interface())
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func topicConsumerGroups(topic *DatabaseTopic) []*KafkaTopicConsumerGroup {
+	var groups []*KafkaTopicConsumerGroup
+	for _, p := range topic.Partitions {
+		end := p.EarliestOffset
+		for _, g := range p.ConsumerGroups {
+			end = max(end, g.Offset)
+		}
+		for _, g := range p.ConsumerGroups {
+			groups = append(groups, &KafkaTopicConsumerGroup{
+				Group:          g.Name,
+				Partition:      p.Id,
+				Offset:         g.Offset,
+				EarliestOffset: p.EarliestOffset,
+				Lag:            end - g.Offset,
+			})
+		}
+	}
+	return groups
+}
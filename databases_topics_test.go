@@ -0,0 +1,138 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveTestKafkaTopics() {
+	mux.HandleFunc("/v2/databases/db-id/topics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			return
+		}
+		fmt.Fprint(w, `{"topics": [
+			{"name": "orders"}, {"name": "events"}, {"name": "stale"}, {"name": "read"}, {"name": "__consumer_offsets"}
+		]}`)
+	})
+	topics := map[string]string{
+		"orders": `{"name": "orders", "replication_factor": 3, "partitions": [{"id": 0}, {"id": 1}, {"id": 2}],
+			"config": {"retention_ms": 604800000, "min_insync_replicas": 2, "cleanup_policy": "delete"}}`,
+		"events": `{"name": "events", "replication_factor": 3, "partitions": [{"id": 0}, {"id": 1}, {"id": 2}, {"id": 3}],
+			"config": {"min_insync_replicas": 2}}`,
+		"stale": `{"name": "stale", "replication_factor": 3, "partitions": [{"id": 0}]}`,
+		"read": `{"name": "read", "replication_factor": 3, "partitions": [
+			{"id": 0, "earliest_offset": 10, "consumer_groups": [{"name": "billing", "offset": 42}, {"name": "audit", "offset": 30}]},
+			{"id": 1, "earliest_offset": 50, "consumer_groups": [{"name": "billing", "offset": 40}]}
+		]}`,
+	}
+	for name, body := range topics {
+		body := body
+		mux.HandleFunc("/v2/databases/db-id/topics/"+name, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				fmt.Fprintf(w, `{"topic": %s}`, body)
+			}
+		})
+	}
+}
+
+func TestPlanKafkaTopics(t *testing.T) {
+	setup()
+	defer teardown()
+	serveTestKafkaTopics()
+
+	plan, err := PlanKafkaTopics(ctx, client, "db-id", []*KafkaTopicSpec{
+		{Name: "orders", PartitionCount: 6, Config: &TopicConfig{RetentionMS: PtrTo(int64(86400000)), CleanupPolicy: "delete"}},
+		{Name: "events", PartitionCount: 2},
+		{Name: "payments", PartitionCount: 3, ReplicationFactor: 3},
+	}, &PlanKafkaTopicsOptions{Prune: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, "~ topic orders\n"+
+		"  partition_count: 3 -> 6\n"+
+		"  retention_ms: 604800000 -> 86400000\n"+
+		"+ topic payments\n"+
+		"  partition_count: 3\n"+
+		"  replication_factor: 3\n"+
+		"- topic stale\n"+
+		"! topic events: partition count can't be decreased from 4 to 2\n"+
+		"! topic read: topic has 3 consumer group offsets with a lag of 22 and AllowDeleteConsumed is not set\n", plan.String())
+
+	_, err = ApplyKafkaTopicPlan(ctx, client, plan)
+	assert.Error(t, err)
+}
+
+func TestPlanKafkaTopics_ReplicationBelowMinInsync(t *testing.T) {
+	setup()
+	defer teardown()
+	serveTestKafkaTopics()
+
+	plan, err := PlanKafkaTopics(ctx, client, "db-id", []*KafkaTopicSpec{
+		{Name: "orders", ReplicationFactor: 1},
+	}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Actions)
+	assert.Equal(t, []*KafkaTopicRefusal{
+		{Name: "orders", Reason: "replication factor 1 is below min_insync_replicas 2"},
+	}, plan.Refused)
+}
+
+func TestApplyKafkaTopicPlan(t *testing.T) {
+	setup()
+	defer teardown()
+	serveTestKafkaTopics()
+
+	var (
+		created []*DatabaseCreateTopicRequest
+		updated []*DatabaseUpdateTopicRequest
+		deleted []string
+	)
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req DatabaseCreateTopicRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			created = append(created, &req)
+			fmt.Fprintf(w, `{"topic": {"name": %q}}`, req.Name)
+		case http.MethodPut:
+			var req DatabaseUpdateTopicRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			updated = append(updated, &req)
+			fmt.Fprint(w, `{"topic": {"name": "orders"}}`)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		}
+	}
+
+	plan, err := PlanKafkaTopics(ctx, client, "db-id", []*KafkaTopicSpec{
+		{Name: "orders", PartitionCount: 6},
+		{Name: "events"},
+		{Name: "payments", PartitionCount: 3},
+	}, &PlanKafkaTopicsOptions{Prune: true, AllowDeleteConsumed: true})
+	require.NoError(t, err)
+	require.Empty(t, plan.Refused)
+	assert.Contains(t, plan.String(), "- topic read\n"+
+		"  consumer group billing: partition 0 at offset 42 (earliest 10, lag 0)\n"+
+		"  consumer group audit: partition 0 at offset 30 (earliest 10, lag 12)\n"+
+		"  consumer group billing: partition 1 at offset 40 (earliest 50, lag 10)\n"+
+		"  consumer lag: 22\n")
+
+	// Serve the writes made by the plan on a fresh mux.
+	teardown()
+	setup()
+	mux.HandleFunc("/v2/databases/db-id/topics", handle)
+	for _, name := range []string{"orders", "stale", "read"} {
+		mux.HandleFunc("/v2/databases/db-id/topics/"+name, handle)
+	}
+
+	done, err := ApplyKafkaTopicPlan(ctx, client, plan)
+	require.NoError(t, err)
+	assert.Len(t, done, 4)
+	assert.Equal(t, []*DatabaseCreateTopicRequest{{Name: "payments", PartitionCount: PtrTo(uint32(3))}}, created)
+	assert.Equal(t, []*DatabaseUpdateTopicRequest{{PartitionCount: PtrTo(uint32(6))}}, updated)
+	assert.Equal(t, []string{"/v2/databases/db-id/topics/read", "/v2/databases/db-id/topics/stale"}, deleted)
+}
@@ -25,6 +25,8 @@ type DomainsService interface {
 	DeleteRecord(context.Context, string, int) (*Response, error)
 	EditRecord(context.Context, string, int, *DomainRecordEditRequest) (*DomainRecord, *Response, error)
 	CreateRecord(context.Context, string, *DomainRecordEditRequest) (*DomainRecord, *Response, error)
+
+	SyncRecords(ctx context.Context, domain string, desired []DomainRecord, opts *SyncDomainRecordsOptions) (*DomainRecordPlan, error)
 }
 
 // DomainsServiceOp handles communication with the domain related methods of the
@@ -0,0 +1,270 @@
+package godo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	acmeChallengeLabel = "_acme-challenge"
+
+	defaultACMERecordTTL          = 30
+	defaultACMEPropagationTimeout = 2 * time.Minute
+	defaultACMEPollInterval       = 5 * time.Second
+)
+
+// DNSResolver looks up TXT records by querying a given nameserver directly.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, nameserver, name string) ([]string, error)
+}
+
+// nameserverResolver is the default DNSResolver. It queries the nameserver
+// on port 53.
+type nameserverResolver struct{}
+
+func (nameserverResolver) LookupTXT(ctx context.Context, nameserver, name string) ([]string, error) {
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(nameserver, "53"))
+		},
+	}
+	return r.LookupTXT(ctx, name)
+}
+
+// ACMEDNS01Value returns the TXT record value of a DNS-01 challenge for a
+// key authorization, as defined by RFC 8555 section 8.4.
+func ACMEDNS01Value(keyAuth string) string {
+	sum := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ACMEDNSSolver solves ACME DNS-01 challenges for domains hosted on
+// DigitalOcean DNS. Present creates the _acme-challenge TXT record of an
+// identifier, WaitForPropagation waits until the domain's nameservers serve
+// it and CleanUp deletes it.
+//
+// A wildcard identifier shares its record name with the base domain, and an
+// order may hold both; each key authorization gets its own TXT record, so
+// the records of one challenge can be cleaned up while the other is
+// pending. A solver is safe for concurrent use.
+type ACMEDNSSolver struct {
+	client *Client
+
+	// Resolver queries the nameservers for WaitForPropagation. Defaults to
+	// querying them over the network on port 53.
+	Resolver DNSResolver
+	// TTL of the challenge records. Defaults to 30 seconds.
+	TTL int
+	// PropagationTimeout bounds WaitForPropagation. Defaults to 2 minutes.
+	PropagationTimeout time.Duration
+	// PollInterval is the time between lookups in WaitForPropagation.
+	// Defaults to 5 seconds.
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	zones   []string
+	records map[acmeRecordKey]*acmeRecord
+}
+
+type acmeRecordKey struct {
+	fqdn  string
+	value string
+}
+
+type acmeRecord struct {
+	zone string
+	id   int
+	refs int
+}
+
+// NewACMEDNSSolver returns a solver that manages challenge records with the
+// Domains service of client.
+func NewACMEDNSSolver(client *Client) *ACMEDNSSolver {
+	return &ACMEDNSSolver{client: client, records: make(map[acmeRecordKey]*acmeRecord)}
+}
+
+// Present creates the TXT record of the DNS-01 challenge for an identifier,
+// such as "example.com" or "*.example.com". Presenting the same key
+// authorization twice creates a single record, which is deleted by the
+// matching number of CleanUp calls.
+func (s *ACMEDNSSolver) Present(ctx context.Context, identifier, keyAuth string) error {
+	zone, name, fqdn, err := s.challengeName(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	key := acmeRecordKey{fqdn: fqdn, value: ACMEDNS01Value(keyAuth)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec := s.records[key]; rec != nil {
+		rec.refs++
+		return nil
+	}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = defaultACMERecordTTL
+	}
+	rec, _, err := s.client.Domains.CreateRecord(ctx, zone, &DomainRecordEditRequest{
+		Type: "TXT",
+		Name: name,
+		Data: key.value,
+		TTL:  ttl,
+	})
+	if err != nil {
+		return fmt.Errorf("godo: creating challenge record for %s: %w", identifier, err)
+	}
+	s.records[key] = &acmeRecord{zone: zone, id: rec.ID, refs: 1}
+	return nil
+}
+
+// WaitForPropagation waits until every nameserver of the domain hosting an
+// identifier serves the challenge value of a key authorization. The
+// nameservers are taken from the NS records at the apex of the domain.
+func (s *ACMEDNSSolver) WaitForPropagation(ctx context.Context, identifier, keyAuth string) error {
+	zone, _, fqdn, err := s.challengeName(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	value := ACMEDNS01Value(keyAuth)
+
+	nsRecords, err := collectPages(func(opt *ListOptions) ([]DomainRecord, *Response, error) {
+		return s.client.Domains.RecordsByType(ctx, zone, "NS", opt)
+	})
+	if err != nil {
+		return err
+	}
+	var nameservers []string
+	for _, ns := range nsRecords {
+		if ns.Name == "@" || ns.Name == "" {
+			nameservers = append(nameservers, strings.TrimSuffix(ns.Data, "."))
+		}
+	}
+	if len(nameservers) == 0 {
+		return fmt.Errorf("godo: domain %s has no NS records", zone)
+	}
+
+	resolver := s.Resolver
+	if resolver == nil {
+		resolver = nameserverResolver{}
+	}
+	timeout, interval := s.PropagationTimeout, s.PollInterval
+	if timeout <= 0 {
+		timeout = defaultACMEPropagationTimeout
+	}
+	if interval <= 0 {
+		interval = defaultACMEPollInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pending := nameservers
+	for {
+		var still []string
+		for _, ns := range pending {
+			values, err := resolver.LookupTXT(ctx, ns, fqdn+".")
+			if err != nil || !slices.Contains(values, value) {
+				still = append(still, ns)
+			}
+		}
+		if pending = still; len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("godo: challenge record %s not served by %s: %w", fqdn, strings.Join(pending, ", "), ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// CleanUp deletes the challenge record of a key authorization. Records
+// created by another solver, or before a restart, are found by name and
+// value.
+func (s *ACMEDNSSolver) CleanUp(ctx context.Context, identifier, keyAuth string) error {
+	zone, name, fqdn, err := s.challengeName(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	key := acmeRecordKey{fqdn: fqdn, value: ACMEDNS01Value(keyAuth)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int
+	if rec := s.records[key]; rec != nil {
+		if rec.refs--; rec.refs > 0 {
+			return nil
+		}
+		delete(s.records, key)
+		ids = []int{rec.id}
+	} else {
+		records, err := collectPages(func(opt *ListOptions) ([]DomainRecord, *Response, error) {
+			return s.client.Domains.RecordsByTypeAndName(ctx, zone, "TXT", fqdn, opt)
+		})
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if (rec.Name == name || rec.Name == fqdn) && rec.Data == key.value {
+				ids = append(ids, rec.ID)
+			}
+		}
+	}
+	for _, id := range ids {
+		if _, err := s.client.Domains.DeleteRecord(ctx, zone, id); err != nil {
+			return fmt.Errorf("godo: deleting challenge record for %s: %w", identifier, err)
+		}
+	}
+	return nil
+}
+
+// challengeName returns the domain hosting an identifier and the name of
+// its challenge record, relative to that domain and fully qualified.
+func (s *ACMEDNSSolver) challengeName(ctx context.Context, identifier string) (zone, name, fqdn string, err error) {
+	host := canonicalZoneName(strings.TrimPrefix(identifier, "*."))
+	if host == "" {
+		return "", "", "", NewArgError("identifier", "cannot be empty")
+	}
+	zones, err := s.domainNames(ctx)
+	if err != nil {
+		return "", "", "", err
+	}
+	for _, z := range zones {
+		if (host == z || strings.HasSuffix(host, "."+z)) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	if zone == "" {
+		return "", "", "", fmt.Errorf("godo: no domain hosts %s", identifier)
+	}
+	fqdn = acmeChallengeLabel + "." + host
+	name, _ = relativeZoneName(fqdn, zone)
+	return zone, name, fqdn, nil
+}
+
+func (s *ACMEDNSSolver) domainNames(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.zones != nil {
+		return s.zones, nil
+	}
+	domains, err := collectPages(func(opt *ListOptions) ([]Domain, *Response, error) {
+		return s.client.Domains.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.zones = make([]string, 0, len(domains))
+	for _, d := range domains {
+		s.zones = append(s.zones, canonicalZoneName(d.Name))
+	}
+	return s.zones, nil
+}
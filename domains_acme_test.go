@@ -0,0 +1,143 @@
+package godo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDNSResolver struct {
+	mu      sync.Mutex
+	lookups map[string]int
+	// servedAfter is the number of lookups after which a nameserver serves
+	// the records.
+	servedAfter map[string]int
+	values      []string
+}
+
+func (r *testDNSResolver) LookupTXT(ctx context.Context, nameserver, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups[nameserver+" "+name]++
+	if r.lookups[nameserver+" "+name] <= r.servedAfter[nameserver] {
+		return nil, fmt.Errorf("no such host")
+	}
+	return r.values, nil
+}
+
+func TestACMEDNS01Value(t *testing.T) {
+	assert.Equal(t, "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I", ACMEDNS01Value("token.thumbprint"))
+}
+
+func TestACMEDNSSolver(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domains": [{"name": "example.com"}, {"name": "dev.example.com"}]}`)
+	})
+	var (
+		created []DomainRecordEditRequest
+		deleted []string
+	)
+	mux.HandleFunc("/v2/domains/dev.example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			assert.Equal(t, "NS", r.URL.Query().Get("type"))
+			fmt.Fprint(w, `{"domain_records": [
+				{"id": 1, "type": "NS", "name": "@", "data": "ns1.digitalocean.com"},
+				{"id": 2, "type": "NS", "name": "@", "data": "ns2.digitalocean.com"}
+			]}`)
+			return
+		}
+		var req DomainRecordEditRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		created = append(created, req)
+		fmt.Fprintf(w, `{"domain_record": {"id": %d}}`, 10+len(created))
+	})
+	mux.HandleFunc("/v2/domains/dev.example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, r.URL.Path)
+	})
+
+	solver := NewACMEDNSSolver(client)
+	resolver := &testDNSResolver{
+		lookups:     map[string]int{},
+		servedAfter: map[string]int{"ns2.digitalocean.com": 2},
+		values:      []string{ACMEDNS01Value("base"), ACMEDNS01Value("wildcard")},
+	}
+	solver.Resolver = resolver
+	solver.PollInterval = time.Millisecond
+
+	require.NoError(t, solver.Present(ctx, "dev.example.com", "base"))
+	require.NoError(t, solver.Present(ctx, "*.dev.example.com", "wildcard"))
+	require.NoError(t, solver.Present(ctx, "*.dev.example.com", "wildcard"))
+	assert.Equal(t, []DomainRecordEditRequest{
+		{Type: "TXT", Name: "_acme-challenge", Data: ACMEDNS01Value("base"), TTL: 30},
+		{Type: "TXT", Name: "_acme-challenge", Data: ACMEDNS01Value("wildcard"), TTL: 30},
+	}, created)
+
+	require.NoError(t, solver.WaitForPropagation(ctx, "*.dev.example.com", "wildcard"))
+	assert.Equal(t, 3, resolver.lookups["ns2.digitalocean.com _acme-challenge.dev.example.com."])
+	assert.Equal(t, 1, resolver.lookups["ns1.digitalocean.com _acme-challenge.dev.example.com."])
+
+	require.NoError(t, solver.CleanUp(ctx, "dev.example.com", "base"))
+	require.NoError(t, solver.CleanUp(ctx, "*.dev.example.com", "wildcard"))
+	assert.Equal(t, []string{"/v2/domains/dev.example.com/records/11"}, deleted)
+	require.NoError(t, solver.CleanUp(ctx, "*.dev.example.com", "wildcard"))
+	assert.Equal(t, []string{"/v2/domains/dev.example.com/records/11", "/v2/domains/dev.example.com/records/12"}, deleted)
+}
+
+func TestACMEDNSSolver_PropagationTimeout(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domains": [{"name": "example.com"}]}`)
+	})
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domain_records": [{"id": 1, "type": "NS", "name": "@", "data": "ns1.digitalocean.com"}]}`)
+	})
+
+	solver := NewACMEDNSSolver(client)
+	solver.Resolver = &testDNSResolver{lookups: map[string]int{}, values: []string{"stale"}}
+	solver.PollInterval = time.Millisecond
+	solver.PropagationTimeout = 20 * time.Millisecond
+
+	err := solver.WaitForPropagation(ctx, "www.example.com", "key")
+	assert.ErrorContains(t, err, "_acme-challenge.www.example.com not served by ns1.digitalocean.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestACMEDNSSolver_CleanUpUnknown(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domains": [{"name": "example.com"}]}`)
+	})
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "TXT", r.URL.Query().Get("type"))
+		assert.Equal(t, "_acme-challenge.www.example.com", r.URL.Query().Get("name"))
+		fmt.Fprintf(w, `{"domain_records": [
+			{"id": 7, "type": "TXT", "name": "_acme-challenge.www", "data": %q},
+			{"id": 8, "type": "TXT", "name": "_acme-challenge.www", "data": "other"}
+		]}`, ACMEDNS01Value("key"))
+	})
+	var deleted []string
+	mux.HandleFunc("/v2/domains/example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.URL.Path)
+	})
+
+	require.NoError(t, NewACMEDNSSolver(client).CleanUp(ctx, "www.example.com", "key"))
+	assert.Equal(t, []string{"/v2/domains/example.com/records/7"}, deleted)
+
+	_, _, _, err := NewACMEDNSSolver(client).challengeName(ctx, "example.org")
+	assert.ErrorContains(t, err, "no domain hosts example.org")
+}
@@ -0,0 +1,446 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDomainRecordOwnerPrefix = "_godo-owner"
+	defaultDomainSyncConcurrency   = 4
+	domainRecordOwnerMarker        = "godo-owner="
+)
+
+// DomainRecordActionType is the kind of a DomainRecordAction.
+type DomainRecordActionType string
+
+const (
+	// DomainRecordCreate creates a record that does not exist.
+	DomainRecordCreate DomainRecordActionType = "create"
+	// DomainRecordUpdate changes the data, TTL or other fields of a record.
+	DomainRecordUpdate DomainRecordActionType = "update"
+	// DomainRecordDelete deletes a record that is not in the desired state.
+	DomainRecordDelete DomainRecordActionType = "delete"
+)
+
+// DomainRecordIdentity returns the key that identifies a record when desired
+// and live records are matched. Matching records are updated in place;
+// records whose key changes are deleted and created instead.
+//
+// The records passed to it are normalized: names are lower case and
+// relative to the domain, with "@" for the apex, and host names in the data
+// are fully qualified, lower case and without a trailing dot.
+type DomainRecordIdentity func(rec *DomainRecord) string
+
+// DomainRecordIdentityByValue identifies a record by its type, name and
+// data, and the tag of CAA records. It suits types that hold several values
+// per name, such as A, AAAA, MX, TXT and NS records.
+func DomainRecordIdentityByValue(rec *DomainRecord) string {
+	if rec.Type == "CAA" {
+		return fmt.Sprintf("%s %s %s %q", rec.Type, rec.Name, rec.Tag, rec.Data)
+	}
+	return fmt.Sprintf("%s %s %q", rec.Type, rec.Name, rec.Data)
+}
+
+// DomainRecordIdentityByName identifies a record by its type and name. It
+// suits types that hold a single value per name, such as CNAME records.
+func DomainRecordIdentityByName(rec *DomainRecord) string {
+	return rec.Type + " " + rec.Name
+}
+
+// SyncDomainRecordsOptions configures SyncDomainRecords and
+// PlanDomainRecords.
+type SyncDomainRecordsOptions struct {
+	// DryRun plans the changes without applying them.
+	DryRun bool
+	// Identities overrides the identity of records by type. CNAME records
+	// are identified by name and other types by value by default.
+	Identities map[string]DomainRecordIdentity
+	// Owner enables ownership tracking. A TXT marker record is kept for
+	// every name managed by the owner, and records at names without the
+	// owner's marker are never changed or deleted. Without an owner every
+	// record of the domain is managed.
+	Owner string
+	// OwnerPrefix is prepended to a name to form the name of its marker
+	// record. Defaults to "_godo-owner".
+	OwnerPrefix string
+	// Concurrency is the number of requests made at once when applying the
+	// plan. Defaults to 4.
+	Concurrency int
+}
+
+// DomainRecordAction is a step of a DomainRecordPlan.
+type DomainRecordAction struct {
+	Type DomainRecordActionType
+	// Record is the desired record, or the live record for deletions.
+	Record DomainRecord
+	// Current is the live record an update replaces.
+	Current *DomainRecord
+}
+
+// DomainRecordConflict is a desired record that would change a record the
+// owner doesn't manage. It is left out of the plan's actions.
+type DomainRecordConflict struct {
+	Record DomainRecord
+	Reason string
+}
+
+// DomainRecordPlan is the set of actions that reconcile the records of a
+// domain with a desired state.
+type DomainRecordPlan struct {
+	Domain  string
+	Actions []*DomainRecordAction
+	// Conflicts lists the desired records that were skipped because they
+	// would touch unmanaged records.
+	Conflicts []*DomainRecordConflict
+
+	concurrency int
+}
+
+// HasChanges reports whether the plan contains any actions.
+func (p *DomainRecordPlan) HasChanges() bool {
+	return p != nil && len(p.Actions) > 0
+}
+
+// String renders the plan in a human-readable form, one action per line.
+// Conflicts are listed last.
+func (p *DomainRecordPlan) String() string {
+	if !p.HasChanges() && (p == nil || len(p.Conflicts) == 0) {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	for _, a := range p.Actions {
+		switch a.Type {
+		case DomainRecordCreate:
+			fmt.Fprintf(&b, "+ %s\n", formatDomainRecord(&a.Record))
+		case DomainRecordDelete:
+			fmt.Fprintf(&b, "- %s\n", formatDomainRecord(&a.Record))
+		default:
+			fmt.Fprintf(&b, "~ %s\n  was %s\n", formatDomainRecord(&a.Record), formatDomainRecord(a.Current))
+		}
+	}
+	for _, c := range p.Conflicts {
+		fmt.Fprintf(&b, "! %s: %s\n", formatDomainRecord(&c.Record), c.Reason)
+	}
+	return b.String()
+}
+
+func formatDomainRecord(rec *DomainRecord) string {
+	data := rec.Data
+	switch rec.Type {
+	case "MX":
+		data = fmt.Sprintf("%d %s", rec.Priority, data)
+	case "SRV":
+		data = fmt.Sprintf("%d %d %d %s", rec.Priority, rec.Weight, rec.Port, data)
+	case "CAA":
+		data = fmt.Sprintf("%d %s %q", rec.Flags, rec.Tag, data)
+	case "TXT":
+		data = fmt.Sprintf("%q", data)
+	}
+	s := fmt.Sprintf("%s %s %s", rec.Type, rec.Name, data)
+	if rec.TTL > 0 {
+		s += fmt.Sprintf(" (ttl %d)", rec.TTL)
+	}
+	return s
+}
+
+// SyncRecords makes the records of a domain match the desired records, see
+// SyncDomainRecords.
+func (s *DomainsServiceOp) SyncRecords(ctx context.Context, domain string, desired []DomainRecord, opts *SyncDomainRecordsOptions) (*DomainRecordPlan, error) {
+	return SyncDomainRecords(ctx, s.client, domain, desired, opts)
+}
+
+// SyncDomainRecords makes the records of a domain match the desired records.
+// It plans the changes with PlanDomainRecords and, unless DryRun is set,
+// applies them with ApplyDomainRecordPlan. The plan is returned in both
+// cases.
+func SyncDomainRecords(ctx context.Context, client *Client, domain string, desired []DomainRecord, opts *SyncDomainRecordsOptions) (*DomainRecordPlan, error) {
+	plan, err := PlanDomainRecords(ctx, client, domain, desired, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.DryRun {
+		return plan, nil
+	}
+	return plan, ApplyDomainRecordPlan(ctx, client, plan)
+}
+
+// PlanDomainRecords compares the desired records with the live records of a
+// domain, listed across all pages, and plans the creates, updates and
+// deletes that reconcile them. Records are matched by their identity, see
+// SyncDomainRecordsOptions.Identities; a desired record without a TTL keeps
+// the live record's TTL. The SOA and apex NS records are managed by
+// DigitalOcean and never changed.
+//
+// With an owner, the plan also creates the marker records of the names it
+// takes over and deletes those of the names it no longer manages.
+func PlanDomainRecords(ctx context.Context, client *Client, domain string, desired []DomainRecord, opts *SyncDomainRecordsOptions) (*DomainRecordPlan, error) {
+	if domain == "" {
+		return nil, NewArgError("domain", "cannot be empty")
+	}
+	if opts == nil {
+		opts = &SyncDomainRecordsOptions{}
+	}
+	prefix := strings.ToLower(opts.OwnerPrefix)
+	if prefix == "" {
+		prefix = defaultDomainRecordOwnerPrefix
+	}
+	zone := canonicalZoneName(domain)
+	identity := func(rec *DomainRecord) string {
+		n := normalizeDomainRecord(rec, zone)
+		if id := opts.Identities[n.Type]; id != nil {
+			return id(&n)
+		}
+		if n.Type == "CNAME" {
+			return DomainRecordIdentityByName(&n)
+		}
+		return DomainRecordIdentityByValue(&n)
+	}
+
+	live, err := collectPages(func(opt *ListOptions) ([]DomainRecord, *Response, error) {
+		return client.Domains.Records(ctx, domain, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort the live records into the owner's markers, the markers of other
+	// owners, which are left alone, and the records that can be synced.
+	var (
+		markers   = make(map[string]DomainRecord)
+		liveNames = make(map[string]bool)
+		byKey     = make(map[string][]DomainRecord)
+		synced    []DomainRecord
+	)
+	for _, rec := range live {
+		name := normalizeDomainRecord(&rec, zone).Name
+		if rec.Type == "TXT" && strings.HasPrefix(rec.Data, domainRecordOwnerMarker) {
+			if owned, ok := markedDomainRecordName(name, prefix); ok && opts.Owner != "" && rec.Data == domainRecordOwnerMarker+opts.Owner {
+				markers[owned] = rec
+			}
+			continue
+		}
+		if !zoneManagedRecord(&rec) {
+			continue
+		}
+		liveNames[name] = true
+		k := identity(&rec)
+		byKey[k] = append(byKey[k], rec)
+		synced = append(synced, rec)
+	}
+	owned := func(name string) bool {
+		if opts.Owner == "" {
+			return true
+		}
+		_, ok := markers[name]
+		return ok
+	}
+
+	plan := &DomainRecordPlan{Domain: domain, concurrency: opts.Concurrency}
+	var (
+		updates, creates []*DomainRecordAction
+		// wanted holds every desired name, whose markers are kept, and
+		// changedNames the names with changes, which get a marker if they
+		// don't have one yet.
+		changedNames []string
+		wanted       = make(map[string]bool)
+		changed      = make(map[string]bool)
+		seen         = make(map[string]bool)
+	)
+	for _, rec := range desired {
+		if rec.Type == "" {
+			return nil, NewArgError("desired", "records must have a type")
+		}
+		if rec.Name == "" {
+			rec.Name = "@"
+		}
+		name := normalizeDomainRecord(&rec, zone).Name
+		if !zoneManagedRecord(&rec) {
+			plan.Conflicts = append(plan.Conflicts, &DomainRecordConflict{Record: rec, Reason: "record is managed by DigitalOcean"})
+			continue
+		}
+		k := identity(&rec)
+		if seen[k] {
+			return nil, NewArgError("desired", fmt.Sprintf("duplicate record %s", formatDomainRecord(&rec)))
+		}
+		seen[k] = true
+		wanted[name] = true
+
+		if matches := byKey[k]; len(matches) > 0 {
+			cur := matches[0]
+			byKey[k] = matches[1:]
+			if rec.TTL == 0 {
+				rec.TTL = cur.TTL
+			}
+			if zoneRecordKey(&rec, zone) == zoneRecordKey(&cur, zone) && rec.TTL == cur.TTL && rec.Flags == cur.Flags {
+				continue
+			}
+			if !owned(name) {
+				plan.Conflicts = append(plan.Conflicts, &DomainRecordConflict{Record: rec, Reason: fmt.Sprintf("record is not managed by %s", opts.Owner)})
+				continue
+			}
+			rec.ID = cur.ID
+			updates = append(updates, &DomainRecordAction{Type: DomainRecordUpdate, Record: rec, Current: &cur})
+		} else {
+			if !owned(name) && liveNames[name] {
+				plan.Conflicts = append(plan.Conflicts, &DomainRecordConflict{Record: rec, Reason: fmt.Sprintf("name has records not managed by %s", opts.Owner)})
+				continue
+			}
+			creates = append(creates, &DomainRecordAction{Type: DomainRecordCreate, Record: rec})
+		}
+		if !changed[name] {
+			changed[name] = true
+			changedNames = append(changedNames, name)
+		}
+	}
+
+	// Deletions come first so that, for example, a CNAME is gone before
+	// records replacing it at the same name are created.
+	for _, rec := range synced {
+		name := normalizeDomainRecord(&rec, zone).Name
+		if !owned(name) || !containsZoneRecord(byKey[identity(&rec)], rec.ID) {
+			continue
+		}
+		plan.Actions = append(plan.Actions, &DomainRecordAction{Type: DomainRecordDelete, Record: rec})
+	}
+	if opts.Owner != "" {
+		for _, rec := range live {
+			name := normalizeDomainRecord(&rec, zone).Name
+			if owned, ok := markedDomainRecordName(name, prefix); ok && markers[owned].ID == rec.ID && !wanted[owned] {
+				plan.Actions = append(plan.Actions, &DomainRecordAction{Type: DomainRecordDelete, Record: rec})
+			}
+		}
+		for _, name := range changedNames {
+			if _, ok := markers[name]; !ok {
+				creates = append(creates, &DomainRecordAction{Type: DomainRecordCreate, Record: DomainRecord{
+					Type: "TXT",
+					Name: domainRecordMarkerName(name, prefix),
+					Data: domainRecordOwnerMarker + opts.Owner,
+				}})
+			}
+		}
+	}
+	plan.Actions = append(plan.Actions, updates...)
+	plan.Actions = append(plan.Actions, creates...)
+	return plan, nil
+}
+
+// ApplyDomainRecordPlan makes the changes of a plan. Deletions are made
+// first, then updates and creates; within each step up to the plan's
+// concurrency requests are made at once. All actions of a step are
+// attempted, and the errors of the step are joined and returned before the
+// next step starts. Once ctx is done, no more actions are started.
+func ApplyDomainRecordPlan(ctx context.Context, client *Client, plan *DomainRecordPlan) error {
+	if plan == nil {
+		return NewArgError("plan", "cannot be nil")
+	}
+	concurrency := plan.concurrency
+	if concurrency <= 0 {
+		concurrency = defaultDomainSyncConcurrency
+	}
+	for _, step := range []DomainRecordActionType{DomainRecordDelete, DomainRecordUpdate, DomainRecordCreate} {
+		var actions []*DomainRecordAction
+		for _, a := range plan.Actions {
+			if a.Type == step {
+				actions = append(actions, a)
+			}
+		}
+		if err := applyDomainRecordActions(ctx, client, plan.Domain, actions, concurrency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyDomainRecordActions(ctx context.Context, client *Client, domain string, actions []*DomainRecordAction, concurrency int) error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []error
+		ctxErr error
+		sem    = make(chan struct{}, concurrency)
+	)
+queue:
+	for _, a := range actions {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			break queue
+		}
+		wg.Add(1)
+		go func(a *DomainRecordAction) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var err error
+			switch a.Type {
+			case DomainRecordCreate:
+				var rec *DomainRecord
+				rec, _, err = client.Domains.CreateRecord(ctx, domain, domainRecordEditRequest(&a.Record))
+				if err == nil && rec != nil {
+					a.Record.ID = rec.ID
+				}
+			case DomainRecordUpdate:
+				_, _, err = client.Domains.EditRecord(ctx, domain, a.Record.ID, domainRecordEditRequest(&a.Record))
+			case DomainRecordDelete:
+				_, err = client.Domains.DeleteRecord(ctx, domain, a.Record.ID)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("godo: %s %s: %w", a.Type, formatDomainRecord(&a.Record), err))
+				mu.Unlock()
+			}
+		}(a)
+	}
+	wg.Wait()
+	return errors.Join(append(errs, ctxErr)...)
+}
+
+// normalizeDomainRecord returns a copy of a record in the form passed to a
+// DomainRecordIdentity.
+func normalizeDomainRecord(rec *DomainRecord, zone string) DomainRecord {
+	n := *rec
+	n.Type = strings.ToUpper(n.Type)
+	n.Name = strings.ToLower(n.Name)
+	if n.Name == "" || n.Name == zone+"." {
+		n.Name = "@"
+	}
+	switch n.Type {
+	case "A", "AAAA":
+		if ip := net.ParseIP(n.Data); ip != nil {
+			n.Data = ip.String()
+		}
+	case "CNAME", "NS", "MX", "SRV":
+		n.Data = strings.ToLower(strings.TrimSuffix(formatZoneTarget(n.Data, zone), "."))
+		if n.Data == "@" {
+			n.Data = zone
+		}
+	case "CAA":
+		n.Tag = strings.ToLower(n.Tag)
+	}
+	return n
+}
+
+func domainRecordMarkerName(name, prefix string) string {
+	if name == "@" {
+		return prefix
+	}
+	return prefix + "." + name
+}
+
+// markedDomainRecordName returns the name a marker record stands for.
+func markedDomainRecordName(markerName, prefix string) (string, bool) {
+	if markerName == prefix {
+		return "@", true
+	}
+	if name := strings.TrimPrefix(markerName, prefix+"."); name != markerName {
+		return name, true
+	}
+	return "", false
+}
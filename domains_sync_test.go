@@ -0,0 +1,191 @@
+package godo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTestDomainRecords serves the records of example.com and records the
+// writes made to them.
+func serveTestDomainRecords(t *testing.T, records string) *[]string {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"domain_records": [%s]}`, records)
+			return
+		}
+		var req DomainRecordEditRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("create %s %s %s", req.Type, req.Name, req.Data))
+		mu.Unlock()
+		fmt.Fprint(w, `{"domain_record": {"id": 100}}`)
+	})
+	mux.HandleFunc("/v2/domains/example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v2/domains/example.com/records/")
+		call := r.Method + " " + id
+		if r.Method == http.MethodPut {
+			var req DomainRecordEditRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			call += fmt.Sprintf(" %s ttl=%d", req.Data, req.TTL)
+		}
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+		fmt.Fprint(w, `{"domain_record": {}}`)
+	})
+	return &calls
+}
+
+func TestSyncDomainRecords(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := serveTestDomainRecords(t, `
+		{"id": 1, "type": "SOA", "name": "@", "data": "1800", "ttl": 1800},
+		{"id": 2, "type": "NS", "name": "@", "data": "ns1.digitalocean.com", "ttl": 1800},
+		{"id": 3, "type": "A", "name": "@", "data": "192.0.2.1", "ttl": 1800},
+		{"id": 4, "type": "A", "name": "@", "data": "192.0.2.2", "ttl": 1800},
+		{"id": 5, "type": "CNAME", "name": "www", "data": "@", "ttl": 3600},
+		{"id": 6, "type": "MX", "name": "@", "data": "mx.example.net", "priority": 10, "ttl": 3600}`)
+
+	desired := []DomainRecord{
+		{Type: "A", Name: "@", Data: "192.0.2.1"},
+		{Type: "A", Name: "@", Data: "192.0.2.3"},
+		{Type: "CNAME", Name: "www", Data: "lb.example.net.", TTL: 300},
+		{Type: "MX", Name: "@", Data: "mx.example.net.", Priority: 20},
+	}
+
+	plan, err := SyncDomainRecords(ctx, client, "example.com", desired, &SyncDomainRecordsOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, *calls)
+	assert.Equal(t, `- A @ 192.0.2.2 (ttl 1800)
+~ CNAME www lb.example.net. (ttl 300)
+  was CNAME www @ (ttl 3600)
+~ MX @ 20 mx.example.net. (ttl 3600)
+  was MX @ 10 mx.example.net (ttl 3600)
++ A @ 192.0.2.3
+`, plan.String())
+
+	_, err = SyncDomainRecords(ctx, client, "example.com", desired, &SyncDomainRecordsOptions{Concurrency: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "DELETE 4", (*calls)[0])
+	updates := (*calls)[1:3]
+	sort.Strings(updates)
+	assert.Equal(t, []string{"PUT 5 lb.example.net. ttl=300", "PUT 6 mx.example.net. ttl=3600"}, updates)
+	assert.Equal(t, "create A @ 192.0.2.3", (*calls)[3])
+}
+
+func TestApplyDomainRecordPlan_Cancelled(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var deletes int
+	mux.HandleFunc("/v2/domains/example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		deletes++
+		// The next action waits for this one, and sees ctx done first.
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	plan := &DomainRecordPlan{Domain: "example.com", concurrency: 1}
+	for id := 1; id <= 3; id++ {
+		plan.Actions = append(plan.Actions, &DomainRecordAction{Type: DomainRecordDelete, Record: DomainRecord{ID: id, Type: "A", Name: "@", Data: fmt.Sprintf("192.0.2.%d", id)}})
+	}
+	err := ApplyDomainRecordPlan(ctx, client, plan)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, deletes)
+	assert.NotContains(t, err.Error(), "192.0.2.2")
+	assert.NotContains(t, err.Error(), "192.0.2.3")
+}
+
+func TestSyncDomainRecords_Identities(t *testing.T) {
+	setup()
+	defer teardown()
+
+	serveTestDomainRecords(t, `{"id": 3, "type": "A", "name": "api", "data": "192.0.2.1", "ttl": 1800}`)
+
+	desired := []DomainRecord{{Type: "A", Name: "api", Data: "192.0.2.9"}}
+	plan, err := PlanDomainRecords(ctx, client, "example.com", desired, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "- A api 192.0.2.1 (ttl 1800)\n+ A api 192.0.2.9\n", plan.String())
+
+	plan, err = PlanDomainRecords(ctx, client, "example.com", desired, &SyncDomainRecordsOptions{
+		Identities: map[string]DomainRecordIdentity{"A": DomainRecordIdentityByName},
+	})
+	require.NoError(t, err)
+	require.Len(t, plan.Actions, 1)
+	assert.Equal(t, DomainRecordUpdate, plan.Actions[0].Type)
+	assert.Equal(t, 1800, plan.Actions[0].Record.TTL)
+}
+
+func TestSyncDomainRecords_Owner(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := serveTestDomainRecords(t, `
+		{"id": 1, "type": "A", "name": "app", "data": "192.0.2.1", "ttl": 1800},
+		{"id": 2, "type": "TXT", "name": "_godo-owner.app", "data": "godo-owner=team-a", "ttl": 1800},
+		{"id": 3, "type": "A", "name": "old", "data": "192.0.2.5", "ttl": 1800},
+		{"id": 4, "type": "TXT", "name": "_godo-owner.old", "data": "godo-owner=team-a", "ttl": 1800},
+		{"id": 5, "type": "A", "name": "legacy", "data": "192.0.2.7", "ttl": 1800},
+		{"id": 6, "type": "A", "name": "other", "data": "192.0.2.8", "ttl": 1800},
+		{"id": 7, "type": "TXT", "name": "_godo-owner.other", "data": "godo-owner=team-b", "ttl": 1800}`)
+
+	plan, err := client.Domains.SyncRecords(ctx, "example.com", []DomainRecord{
+		{Type: "A", Name: "app", Data: "192.0.2.2"},
+		{Type: "A", Name: "legacy", Data: "192.0.2.70"},
+		{Type: "A", Name: "new", Data: "192.0.2.9"},
+	}, &SyncDomainRecordsOptions{Owner: "team-a", Concurrency: 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"DELETE 1",
+		"DELETE 3",
+		"DELETE 4",
+		"create A app 192.0.2.2",
+		"create A new 192.0.2.9",
+		"create TXT _godo-owner.new godo-owner=team-a",
+	}, *calls)
+	require.Len(t, plan.Conflicts, 1)
+	assert.Equal(t, "legacy", plan.Conflicts[0].Record.Name)
+	assert.Equal(t, "name has records not managed by team-a", plan.Conflicts[0].Reason)
+}
+
+func TestSyncDomainRecords_OwnerInSync(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := serveTestDomainRecords(t, `
+		{"id": 1, "type": "A", "name": "app", "data": "192.0.2.1", "ttl": 1800},
+		{"id": 2, "type": "TXT", "name": "_godo-owner.app", "data": "godo-owner=team-a", "ttl": 1800},
+		{"id": 3, "type": "CNAME", "name": "www", "data": "app.example.com.", "ttl": 1800},
+		{"id": 4, "type": "TXT", "name": "_godo-owner.www", "data": "godo-owner=team-a", "ttl": 1800}`)
+
+	desired := []DomainRecord{
+		{Type: "A", Name: "app", Data: "192.0.2.1"},
+		{Type: "CNAME", Name: "www", Data: "app.example.com."},
+	}
+	for i := 0; i < 2; i++ {
+		plan, err := SyncDomainRecords(ctx, client, "example.com", desired, &SyncDomainRecordsOptions{Owner: "team-a"})
+		require.NoError(t, err)
+		assert.False(t, plan.HasChanges(), plan.String())
+	}
+	assert.Empty(t, *calls)
+}
@@ -0,0 +1,670 @@
+package godo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxTXTStringLength is the longest character-string a TXT record can hold;
+// longer values are split into several strings.
+const maxTXTStringLength = 255
+
+// ParseZoneFile parses an RFC 1035 zone file for domain into records in the
+// form used by the Domains API: names are relative to the domain, with "@"
+// for the apex, and host names in the data are fully qualified with a
+// trailing dot. TXT strings are joined into a single value.
+//
+// The $ORIGIN and $TTL directives, relative and omitted owner names,
+// parentheses and comments are supported. A, AAAA, CNAME, MX, TXT, NS, SRV,
+// CAA and SOA records can be parsed; other types and $INCLUDE are errors.
+func ParseZoneFile(r io.Reader, domain string) ([]DomainRecord, error) {
+	domain = canonicalZoneName(domain)
+	if domain == "" {
+		return nil, NewArgError("domain", "cannot be empty")
+	}
+	lines, err := lexZoneFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		records    []DomainRecord
+		origin     = domain
+		defaultTTL = -1
+		lastTTL    = 0
+		lastOwner  string
+	)
+	for _, l := range lines {
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("godo: zone file line %d: %s", l.num, fmt.Sprintf(format, args...))
+		}
+		toks := l.tokens
+
+		if !toks[0].quoted && strings.HasPrefix(toks[0].text, "$") {
+			directive := strings.ToUpper(toks[0].text)
+			if len(toks) != 2 {
+				return nil, fail("%s takes one argument", directive)
+			}
+			switch directive {
+			case "$ORIGIN":
+				origin = absoluteZoneName(toks[1].text, origin)
+			case "$TTL":
+				ttl, ok := parseZoneTTL(toks[1].text)
+				if !ok {
+					return nil, fail("invalid TTL %q", toks[1].text)
+				}
+				defaultTTL = ttl
+			default:
+				return nil, fail("unsupported directive %s", directive)
+			}
+			continue
+		}
+
+		owner := lastOwner
+		if !l.blankOwner {
+			owner = absoluteZoneName(toks[0].text, origin)
+			toks = toks[1:]
+		}
+		if owner == "" {
+			return nil, fail("record has no owner name")
+		}
+		lastOwner = owner
+
+		ttl := -1
+		for len(toks) > 0 && !toks[0].quoted {
+			if class := strings.ToUpper(toks[0].text); class == "IN" {
+				toks = toks[1:]
+				continue
+			} else if class == "CH" || class == "HS" || class == "CS" {
+				return nil, fail("unsupported class %s", class)
+			}
+			if v, ok := parseZoneTTL(toks[0].text); ok && ttl < 0 {
+				ttl = v
+				toks = toks[1:]
+				continue
+			}
+			break
+		}
+		if len(toks) == 0 {
+			return nil, fail("record has no type")
+		}
+		switch {
+		case ttl >= 0:
+			lastTTL = ttl
+		case defaultTTL >= 0:
+			ttl = defaultTTL
+		default:
+			ttl = lastTTL
+		}
+
+		name, ok := relativeZoneName(owner, domain)
+		if !ok {
+			return nil, fail("%s is outside of %s", owner, domain)
+		}
+		rec, err := parseZoneRecord(strings.ToUpper(toks[0].text), toks[1:], origin)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		rec.Name = name
+		rec.TTL = ttl
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func parseZoneRecord(typ string, rdata []zoneToken, origin string) (DomainRecord, error) {
+	rec := DomainRecord{Type: typ}
+	want := func(n int) error {
+		if len(rdata) != n {
+			return fmt.Errorf("%s record needs %d fields, got %d", typ, n, len(rdata))
+		}
+		return nil
+	}
+	var err error
+	switch typ {
+	case "A", "AAAA":
+		if err = want(1); err != nil {
+			break
+		}
+		ip := net.ParseIP(rdata[0].text)
+		if ip == nil || (ip.To4() != nil) != (typ == "A") {
+			return rec, fmt.Errorf("invalid %s address %q", typ, rdata[0].text)
+		}
+		rec.Data = ip.String()
+	case "CNAME", "NS":
+		if err = want(1); err != nil {
+			break
+		}
+		rec.Data = zoneTarget(rdata[0].text, origin)
+	case "MX":
+		if err = want(2); err != nil {
+			break
+		}
+		if rec.Priority, err = parseZoneUint(rdata[0].text, 16); err != nil {
+			break
+		}
+		rec.Data = zoneTarget(rdata[1].text, origin)
+	case "SRV":
+		if err = want(4); err != nil {
+			break
+		}
+		if rec.Priority, err = parseZoneUint(rdata[0].text, 16); err != nil {
+			break
+		}
+		if rec.Weight, err = parseZoneUint(rdata[1].text, 16); err != nil {
+			break
+		}
+		if rec.Port, err = parseZoneUint(rdata[2].text, 16); err != nil {
+			break
+		}
+		rec.Data = zoneTarget(rdata[3].text, origin)
+	case "TXT":
+		if len(rdata) == 0 {
+			return rec, fmt.Errorf("TXT record needs at least one string")
+		}
+		var b strings.Builder
+		for _, t := range rdata {
+			b.WriteString(t.text)
+		}
+		rec.Data = b.String()
+	case "CAA":
+		if err = want(3); err != nil {
+			break
+		}
+		if rec.Flags, err = parseZoneUint(rdata[0].text, 8); err != nil {
+			break
+		}
+		rec.Tag = strings.ToLower(rdata[1].text)
+		rec.Data = rdata[2].text
+	case "SOA":
+		if err = want(7); err != nil {
+			break
+		}
+		fields := []string{zoneTarget(rdata[0].text, origin), zoneTarget(rdata[1].text, origin)}
+		for _, t := range rdata[2:] {
+			v, ok := parseZoneTTL(t.text)
+			if !ok {
+				return rec, fmt.Errorf("invalid SOA value %q", t.text)
+			}
+			fields = append(fields, strconv.Itoa(v))
+		}
+		rec.Data = strings.Join(fields, " ")
+	default:
+		return rec, fmt.Errorf("unsupported record type %s", typ)
+	}
+	return rec, err
+}
+
+// WriteZoneFile writes records of domain as an RFC 1035 zone file. Names
+// are written relative to the domain. Host names in the data that end with
+// a dot, or that contain a dot and aren't "@", are treated as fully
+// qualified, which matches the records returned by the Domains API.
+//
+// SOA records are only written when their data holds all seven fields; the
+// SOA record of the Domains API only carries the TTL of the zone.
+func WriteZoneFile(w io.Writer, domain string, records []DomainRecord) error {
+	domain = canonicalZoneName(domain)
+	if domain == "" {
+		return NewArgError("domain", "cannot be empty")
+	}
+	sorted := make([]DomainRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Type == "SOA" && sorted[j].Type != "SOA"
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(tw, "$ORIGIN %s.\n", domain)
+	for _, rec := range sorted {
+		rdata, ok, err := formatZoneData(&rec, domain)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		name := rec.Name
+		if name == "" {
+			name = "@"
+		}
+		ttl := ""
+		if rec.TTL > 0 {
+			ttl = strconv.Itoa(rec.TTL)
+		}
+		fmt.Fprintf(tw, "%s\t%s\tIN\t%s\t%s\n", name, ttl, rec.Type, rdata)
+	}
+	return tw.Flush()
+}
+
+func formatZoneData(rec *DomainRecord, domain string) (string, bool, error) {
+	switch rec.Type {
+	case "A", "AAAA":
+		return rec.Data, true, nil
+	case "CNAME", "NS":
+		return formatZoneTarget(rec.Data, domain), true, nil
+	case "MX":
+		return fmt.Sprintf("%d %s", rec.Priority, formatZoneTarget(rec.Data, domain)), true, nil
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", rec.Priority, rec.Weight, rec.Port, formatZoneTarget(rec.Data, domain)), true, nil
+	case "TXT":
+		var parts []string
+		data := rec.Data
+		for len(data) > maxTXTStringLength {
+			parts = append(parts, quoteZoneString(data[:maxTXTStringLength]))
+			data = data[maxTXTStringLength:]
+		}
+		parts = append(parts, quoteZoneString(data))
+		return strings.Join(parts, " "), true, nil
+	case "CAA":
+		return fmt.Sprintf("%d %s %s", rec.Flags, rec.Tag, quoteZoneString(rec.Data)), true, nil
+	case "SOA":
+		fields := strings.Fields(rec.Data)
+		if len(fields) != 7 {
+			return "", false, nil
+		}
+		fields[0] = formatZoneTarget(fields[0], domain)
+		fields[1] = formatZoneTarget(fields[1], domain)
+		return strings.Join(fields, " "), true, nil
+	}
+	return "", false, fmt.Errorf("godo: can't write %s record %s to a zone file", rec.Type, rec.Name)
+}
+
+func formatZoneTarget(data, domain string) string {
+	switch {
+	case data == "@", data == ".", strings.HasSuffix(data, "."):
+		return data
+	case data == domain:
+		return "@"
+	case strings.Contains(data, "."):
+		return data + "."
+	}
+	return data
+}
+
+func quoteZoneString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ExportZoneFile writes all records of a domain as a zone file.
+func ExportZoneFile(ctx context.Context, client *Client, domain string, w io.Writer) error {
+	records, err := collectPages(func(opt *ListOptions) ([]DomainRecord, *Response, error) {
+		return client.Domains.Records(ctx, domain, opt)
+	})
+	if err != nil {
+		return err
+	}
+	return WriteZoneFile(w, domain, records)
+}
+
+// ImportZoneFileOptions configures ImportZoneFile.
+type ImportZoneFileOptions struct {
+	// Prune deletes records of the domain that aren't in the zone file.
+	Prune bool
+	// DryRun computes the changes without making them.
+	DryRun bool
+}
+
+// ZoneFileImportResult lists the records changed by ImportZoneFile.
+type ZoneFileImportResult struct {
+	Created []DomainRecord
+	Updated []DomainRecord
+	Deleted []DomainRecord
+}
+
+// ImportZoneFile parses a zone file and makes the records of a domain match
+// it using the record methods of the Domains service. Records are matched
+// by type, name and data; matching records whose TTL differs are updated,
+// the others are created, and with Prune the domain's remaining records are
+// deleted. SOA records and NS records at the apex are managed by
+// DigitalOcean and left alone.
+func ImportZoneFile(ctx context.Context, client *Client, domain string, r io.Reader, opts *ImportZoneFileOptions) (*ZoneFileImportResult, error) {
+	if opts == nil {
+		opts = &ImportZoneFileOptions{}
+	}
+	desired, err := ParseZoneFile(r, domain)
+	if err != nil {
+		return nil, err
+	}
+	live, err := collectPages(func(opt *ListOptions) ([]DomainRecord, *Response, error) {
+		return client.Domains.Records(ctx, domain, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	zone := canonicalZoneName(domain)
+
+	existing := make(map[string][]DomainRecord)
+	for _, rec := range live {
+		if !zoneManagedRecord(&rec) {
+			continue
+		}
+		k := zoneRecordKey(&rec, zone)
+		existing[k] = append(existing[k], rec)
+	}
+
+	result := &ZoneFileImportResult{}
+	seen := make(map[string]bool)
+	for _, rec := range desired {
+		if !zoneManagedRecord(&rec) {
+			continue
+		}
+		k := zoneRecordKey(&rec, zone)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		matches := existing[k]
+		if len(matches) == 0 {
+			if !opts.DryRun {
+				created, _, err := client.Domains.CreateRecord(ctx, domain, domainRecordEditRequest(&rec))
+				if err != nil {
+					return result, fmt.Errorf("godo: creating %s record %s: %w", rec.Type, rec.Name, err)
+				}
+				rec = *created
+			}
+			result.Created = append(result.Created, rec)
+			continue
+		}
+		cur := matches[0]
+		existing[k] = matches[1:]
+		if rec.TTL == 0 || rec.TTL == cur.TTL {
+			continue
+		}
+		rec.ID = cur.ID
+		if !opts.DryRun {
+			if _, _, err := client.Domains.EditRecord(ctx, domain, cur.ID, domainRecordEditRequest(&rec)); err != nil {
+				return result, fmt.Errorf("godo: updating %s record %s: %w", rec.Type, rec.Name, err)
+			}
+		}
+		result.Updated = append(result.Updated, rec)
+	}
+
+	if opts.Prune {
+		for _, rec := range live {
+			k := zoneRecordKey(&rec, zone)
+			if !zoneManagedRecord(&rec) || !containsZoneRecord(existing[k], rec.ID) {
+				continue
+			}
+			if !opts.DryRun {
+				if _, err := client.Domains.DeleteRecord(ctx, domain, rec.ID); err != nil {
+					return result, fmt.Errorf("godo: deleting %s record %s: %w", rec.Type, rec.Name, err)
+				}
+			}
+			result.Deleted = append(result.Deleted, rec)
+		}
+	}
+	return result, nil
+}
+
+func containsZoneRecord(records []DomainRecord, id int) bool {
+	for _, r := range records {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneManagedRecord reports whether a record can be changed through the
+// record methods; the SOA and apex NS records are managed by DigitalOcean.
+func zoneManagedRecord(rec *DomainRecord) bool {
+	return rec.Type != "SOA" && !(rec.Type == "NS" && (rec.Name == "@" || rec.Name == ""))
+}
+
+func domainRecordEditRequest(rec *DomainRecord) *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{
+		Type:     rec.Type,
+		Name:     rec.Name,
+		Data:     rec.Data,
+		Priority: rec.Priority,
+		Port:     rec.Port,
+		TTL:      rec.TTL,
+		Weight:   rec.Weight,
+		Flags:    rec.Flags,
+		Tag:      rec.Tag,
+	}
+}
+
+// zoneRecordKey identifies a record by type, name and data, normalizing the
+// forms the API and zone files use for the same names and addresses.
+func zoneRecordKey(rec *DomainRecord, domain string) string {
+	name := strings.ToLower(rec.Name)
+	if name == "" {
+		name = "@"
+	}
+	data := rec.Data
+	switch rec.Type {
+	case "A", "AAAA":
+		if ip := net.ParseIP(data); ip != nil {
+			data = ip.String()
+		}
+	case "CNAME", "NS", "MX", "SRV":
+		data = strings.ToLower(strings.TrimSuffix(formatZoneTarget(data, domain), "."))
+		if data == "@" {
+			data = domain
+		}
+	case "CAA":
+		return fmt.Sprintf("%s %s %d %s %q", rec.Type, name, rec.Flags, strings.ToLower(rec.Tag), data)
+	}
+	return fmt.Sprintf("%s %s %d %d %d %q", rec.Type, name, rec.Priority, rec.Weight, rec.Port, data)
+}
+
+func canonicalZoneName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// absoluteZoneName resolves a name of a zone file against the origin. The
+// result has no trailing dot.
+func absoluteZoneName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return canonicalZoneName(name)
+	case origin == "":
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "." + origin
+}
+
+// relativeZoneName returns the name of a record as the Domains API uses it.
+func relativeZoneName(name, domain string) (string, bool) {
+	if name == domain {
+		return "@", true
+	}
+	if rel := strings.TrimSuffix(name, "."+domain); rel != name {
+		return rel, true
+	}
+	return "", false
+}
+
+// zoneTarget returns a host name of record data fully qualified, with a
+// trailing dot.
+func zoneTarget(name, origin string) string {
+	if name == "." {
+		return name
+	}
+	return absoluteZoneName(name, origin) + "."
+}
+
+func parseZoneUint(s string, bits int) (int, error) {
+	v, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return int(v), nil
+}
+
+// parseZoneTTL parses a TTL in seconds or with BIND's units, e.g. 1h30m.
+func parseZoneTTL(s string) (int, bool) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	if v, err := strconv.ParseUint(s, 10, 31); err == nil {
+		return int(v), true
+	}
+	total, n := 0, -1
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			n = max(n, 0)*10 + int(c-'0')
+			continue
+		}
+		unit := zoneTTLUnit(c)
+		if unit == 0 || n < 0 {
+			return 0, false
+		}
+		total += n * unit
+		n = -1
+	}
+	if n >= 0 {
+		return 0, false
+	}
+	return total, true
+}
+
+func zoneTTLUnit(c rune) int {
+	switch c {
+	case 's':
+		return 1
+	case 'm':
+		return 60
+	case 'h':
+		return 3600
+	case 'd':
+		return 86400
+	case 'w':
+		return 604800
+	}
+	return 0
+}
+
+type zoneToken struct {
+	text   string
+	quoted bool
+}
+
+type zoneLine struct {
+	num        int
+	blankOwner bool
+	tokens     []zoneToken
+}
+
+// lexZoneFile splits a zone file into logical lines of tokens, joining the
+// lines within parentheses and dropping comments.
+func lexZoneFile(r io.Reader) ([]zoneLine, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		lines []zoneLine
+		cur   = zoneLine{num: 1}
+		line  = 1
+		depth = 0
+	)
+	if len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+		cur.blankOwner = true
+	}
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '\n':
+			line++
+			if depth == 0 {
+				if len(cur.tokens) > 0 {
+					lines = append(lines, cur)
+				}
+				cur = zoneLine{num: line}
+				if i+1 < len(data) && (data[i+1] == ' ' || data[i+1] == '\t') {
+					cur.blankOwner = true
+				}
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ';':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("godo: zone file line %d: unbalanced parenthesis", line)
+			}
+			depth--
+			i++
+		case c == '"':
+			var b bytes.Buffer
+			i++
+			for ; i < len(data) && data[i] != '"'; i++ {
+				switch {
+				case data[i] == '\n':
+					return nil, fmt.Errorf("godo: zone file line %d: unterminated string", line)
+				case data[i] == '\\' && i+3 < len(data) && isDigits(data[i+1:i+4]):
+					v, _ := strconv.Atoi(string(data[i+1 : i+4]))
+					if v > 255 {
+						return nil, fmt.Errorf("godo: zone file line %d: invalid escape \\%s", line, data[i+1:i+4])
+					}
+					b.WriteByte(byte(v))
+					i += 3
+				case data[i] == '\\' && i+1 < len(data):
+					i++
+					b.WriteByte(data[i])
+				default:
+					b.WriteByte(data[i])
+				}
+			}
+			if i >= len(data) {
+				return nil, fmt.Errorf("godo: zone file line %d: unterminated string", line)
+			}
+			i++
+			cur.tokens = append(cur.tokens, zoneToken{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(data) && !bytes.ContainsRune([]byte(" \t\r\n;()\""), rune(data[i])) {
+				i++
+			}
+			cur.tokens = append(cur.tokens, zoneToken{text: string(data[start:i])})
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("godo: zone file line %d: unbalanced parenthesis", line)
+	}
+	if len(cur.tokens) > 0 {
+		lines = append(lines, cur)
+	}
+	return lines, nil
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
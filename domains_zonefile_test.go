@@ -0,0 +1,161 @@
+package godo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testZoneFile = `$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1.digitalocean.com. hostmaster.example.com. (
+		2024010101 ; serial
+		10800      ; refresh
+		3600 1w 30m )
+	IN	NS	ns1.digitalocean.com.
+@	300	IN	A	192.0.2.1
+	IN	AAAA	2001:db8::0001
+www	CNAME	@
+mail	IN	MX	10 mx1
+@	IN	TXT	"v=spf1 include:_spf.example.net" " -all"
+_sip._tcp	IN	SRV	10 60 5060 sip.example.net.
+@	IN	CAA	0 issue "letsencrypt.org"
+$ORIGIN dev.example.com.
+api	60	IN	A	192.0.2.2
+`
+
+func TestParseZoneFile(t *testing.T) {
+	records, err := ParseZoneFile(strings.NewReader(testZoneFile), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []DomainRecord{
+		{Type: "SOA", Name: "@", TTL: 3600, Data: "ns1.digitalocean.com. hostmaster.example.com. 2024010101 10800 3600 604800 1800"},
+		{Type: "NS", Name: "@", TTL: 3600, Data: "ns1.digitalocean.com."},
+		{Type: "A", Name: "@", TTL: 300, Data: "192.0.2.1"},
+		{Type: "AAAA", Name: "@", TTL: 3600, Data: "2001:db8::1"},
+		{Type: "CNAME", Name: "www", TTL: 3600, Data: "example.com."},
+		{Type: "MX", Name: "mail", TTL: 3600, Priority: 10, Data: "mx1.example.com."},
+		{Type: "TXT", Name: "@", TTL: 3600, Data: "v=spf1 include:_spf.example.net -all"},
+		{Type: "SRV", Name: "_sip._tcp", TTL: 3600, Priority: 10, Weight: 60, Port: 5060, Data: "sip.example.net."},
+		{Type: "CAA", Name: "@", TTL: 3600, Flags: 0, Tag: "issue", Data: "letsencrypt.org"},
+		{Type: "A", Name: "api.dev", TTL: 60, Data: "192.0.2.2"},
+	}, records)
+}
+
+func TestParseZoneFile_Errors(t *testing.T) {
+	tests := []struct {
+		zone string
+		want string
+	}{
+		{"www IN HINFO a b\n", "line 1: unsupported record type HINFO"},
+		{"www IN A 2001:db8::1\n", `invalid A address`},
+		{"\n\nwww.example.org. IN A 192.0.2.1\n", "line 3: www.example.org is outside of example.com"},
+		{"@ IN MX ( 10\n", "unbalanced parenthesis"},
+		{"@ IN TXT \"open\n", "unterminated string"},
+		{"$INCLUDE other.zone\n", "unsupported directive $INCLUDE"},
+		{" IN A 192.0.2.1\n", "no owner name"},
+	}
+	for _, tt := range tests {
+		_, err := ParseZoneFile(strings.NewReader(tt.zone), "example.com")
+		assert.ErrorContains(t, err, tt.want, tt.zone)
+	}
+}
+
+func TestParseZoneTTL(t *testing.T) {
+	for s, want := range map[string]int{"300": 300, "1h": 3600, "1h30m": 5400, "1W": 604800} {
+		got, ok := parseZoneTTL(s)
+		assert.True(t, ok, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "h", "1x", "10m5", "IN"} {
+		_, ok := parseZoneTTL(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestWriteZoneFile(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	var buf bytes.Buffer
+	require.NoError(t, WriteZoneFile(&buf, "example.com", []DomainRecord{
+		{Type: "A", Name: "@", TTL: 300, Data: "192.0.2.1"},
+		{Type: "SOA", Name: "@", TTL: 1800, Data: "1800"},
+		{Type: "NS", Name: "@", TTL: 1800, Data: "ns1.digitalocean.com"},
+		{Type: "CNAME", Name: "www", TTL: 3600, Data: "@"},
+		{Type: "MX", Name: "@", TTL: 3600, Priority: 10, Data: "mail.example.com"},
+		{Type: "TXT", Name: "@", TTL: 3600, Data: `say "hi"`},
+		{Type: "TXT", Name: "dkim", TTL: 3600, Data: long},
+		{Type: "CAA", Name: "@", TTL: 3600, Flags: 128, Tag: "iodef", Data: "mailto:ops@example.com"},
+	}))
+	assert.Equal(t, "$ORIGIN example.com.\n"+
+		"@\t300\tIN\tA\t192.0.2.1\n"+
+		"@\t1800\tIN\tNS\tns1.digitalocean.com.\n"+
+		"www\t3600\tIN\tCNAME\t@\n"+
+		"@\t3600\tIN\tMX\t10 mail.example.com.\n"+
+		"@\t3600\tIN\tTXT\t\"say \\\"hi\\\"\"\n"+
+		"dkim\t3600\tIN\tTXT\t\""+long[:255]+"\" \""+long[255:]+"\"\n"+
+		"@\t3600\tIN\tCAA\t128 iodef \"mailto:ops@example.com\"\n", buf.String())
+
+	records, err := ParseZoneFile(&buf, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, long, records[5].Data)
+	assert.Equal(t, `say "hi"`, records[4].Data)
+}
+
+func TestImportZoneFile(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"domain_records": [
+				{"id": 1, "type": "SOA", "name": "@", "data": "1800", "ttl": 1800},
+				{"id": 2, "type": "NS", "name": "@", "data": "ns1.digitalocean.com", "ttl": 1800},
+				{"id": 3, "type": "A", "name": "@", "data": "192.0.2.1", "ttl": 1800},
+				{"id": 4, "type": "CNAME", "name": "www", "data": "@", "ttl": 3600},
+				{"id": 5, "type": "A", "name": "old", "data": "192.0.2.9", "ttl": 3600}
+			]}`)
+			return
+		}
+		testMethod(t, r, http.MethodPost)
+		var req DomainRecordEditRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		calls = append(calls, fmt.Sprintf("create %s %s %s", req.Type, req.Name, req.Data))
+		fmt.Fprintf(w, `{"domain_record": {"id": 10, "type": %q, "name": %q, "data": %q}}`, req.Type, req.Name, req.Data)
+	})
+	mux.HandleFunc("/v2/domains/example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		var req DomainRecordEditRequest
+		if r.Method == http.MethodPut {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		}
+		calls = append(calls, fmt.Sprintf("%s %s ttl=%d", r.Method, strings.TrimPrefix(r.URL.Path, "/v2/domains/example.com/records/"), req.TTL))
+		fmt.Fprint(w, `{"domain_record": {}}`)
+	})
+
+	zone := `$TTL 3600
+@	300	IN	A	192.0.2.1
+www	IN	CNAME	example.com.
+mail	IN	MX	10 mx.example.net.
+`
+	result, err := ImportZoneFile(ctx, client, "example.com", strings.NewReader(zone), &ImportZoneFileOptions{Prune: true, DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, calls)
+	assert.Len(t, result.Created, 1)
+	assert.Len(t, result.Updated, 1)
+	assert.Len(t, result.Deleted, 1)
+
+	result, err = ImportZoneFile(ctx, client, "example.com", strings.NewReader(zone), &ImportZoneFileOptions{Prune: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"PUT 3 ttl=300",
+		"create MX mail mx.example.net.",
+		"DELETE 5 ttl=0",
+	}, calls)
+	assert.Equal(t, 10, result.Created[0].ID)
+	assert.Equal(t, "old", result.Deleted[0].Name)
+}
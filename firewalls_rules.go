@@ -0,0 +1,619 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Firewall rule protocols.
+const (
+	FirewallProtocolTCP  = "tcp"
+	FirewallProtocolUDP  = "udp"
+	FirewallProtocolICMP = "icmp"
+)
+
+// Kinds of a FirewallRuleFinding.
+const (
+	FirewallFindingShadowed = "shadowed"
+	FirewallFindingOverlap  = "overlap"
+	FirewallFindingExposed  = "exposed"
+)
+
+const firewallAllPorts = "all"
+
+// DefaultSensitivePorts are the ports AnalyzeFirewallRules reports when
+// they are open to every address: remote access, databases, caches and
+// container runtimes.
+var DefaultSensitivePorts = []int{22, 23, 2375, 2376, 3306, 3389, 5432, 5900, 6379, 9200, 11211, 27017}
+
+// firewallPortRange is an inclusive range of ports. ICMP rules have the
+// zero range.
+type firewallPortRange struct {
+	lo, hi int
+}
+
+func parseFirewallPortRange(protocol, ports string) (firewallPortRange, error) {
+	if protocol == FirewallProtocolICMP {
+		return firewallPortRange{}, nil
+	}
+	switch ports {
+	case "", "0", firewallAllPorts:
+		return firewallPortRange{1, 65535}, nil
+	}
+	loStr, hiStr, isRange := strings.Cut(ports, "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(loStr))
+	if err != nil {
+		return firewallPortRange{}, fmt.Errorf("invalid port range %q", ports)
+	}
+	hi := lo
+	if isRange {
+		if hi, err = strconv.Atoi(strings.TrimSpace(hiStr)); err != nil {
+			return firewallPortRange{}, fmt.Errorf("invalid port range %q", ports)
+		}
+	}
+	if lo < 1 || hi > 65535 || lo > hi {
+		return firewallPortRange{}, fmt.Errorf("invalid port range %q", ports)
+	}
+	return firewallPortRange{lo, hi}, nil
+}
+
+func (r firewallPortRange) String() string {
+	switch {
+	case r.lo == 0:
+		return ""
+	case r.lo == 1 && r.hi == 65535:
+		return firewallAllPorts
+	case r.lo == r.hi:
+		return strconv.Itoa(r.lo)
+	}
+	return fmt.Sprintf("%d-%d", r.lo, r.hi)
+}
+
+func (r firewallPortRange) contains(o firewallPortRange) bool {
+	return r.lo <= o.lo && o.hi <= r.hi
+}
+
+func (r firewallPortRange) overlaps(o firewallPortRange) bool {
+	return r.lo <= o.hi && o.lo <= r.hi
+}
+
+// firewallRule is the protocol-independent form of an inbound or outbound
+// rule. Destinations have the same fields as Sources and are converted.
+type firewallRule struct {
+	protocol  string
+	ports     firewallPortRange
+	endpoints Sources
+}
+
+func (r firewallRule) key() string {
+	return r.protocol + "/" + r.ports.String()
+}
+
+func newInboundFirewallRule(in InboundRule) (firewallRule, error) {
+	var s Sources
+	if in.Sources != nil {
+		s = *in.Sources
+	}
+	return newFirewallRule(in.Protocol, in.PortRange, s)
+}
+
+func newOutboundFirewallRule(out OutboundRule) (firewallRule, error) {
+	var s Sources
+	if out.Destinations != nil {
+		s = Sources(*out.Destinations)
+	}
+	return newFirewallRule(out.Protocol, out.PortRange, s)
+}
+
+func newFirewallRule(protocol, ports string, endpoints Sources) (firewallRule, error) {
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	switch protocol {
+	case FirewallProtocolTCP, FirewallProtocolUDP, FirewallProtocolICMP:
+	default:
+		return firewallRule{}, fmt.Errorf("invalid protocol %q", protocol)
+	}
+	pr, err := parseFirewallPortRange(protocol, strings.TrimSpace(ports))
+	if err != nil {
+		return firewallRule{}, err
+	}
+	e, err := normalizeFirewallEndpoints(endpoints)
+	if err != nil {
+		return firewallRule{}, err
+	}
+	return firewallRule{protocol: protocol, ports: pr, endpoints: e}, nil
+}
+
+func (r firewallRule) inbound() InboundRule {
+	s := r.endpoints
+	return InboundRule{Protocol: r.protocol, PortRange: r.ports.String(), Sources: &s}
+}
+
+func (r firewallRule) outbound() OutboundRule {
+	d := Destinations(r.endpoints)
+	return OutboundRule{Protocol: r.protocol, PortRange: r.ports.String(), Destinations: &d}
+}
+
+// normalizeFirewallEndpoints sorts and deduplicates the sources or
+// destinations of a rule. Addresses are written as prefixes, so that
+// "192.0.2.1" and "192.0.2.1/32" compare equal.
+func normalizeFirewallEndpoints(s Sources) (Sources, error) {
+	var n Sources
+	for _, a := range s.Addresses {
+		p, err := parseFirewallPrefix(strings.TrimSpace(a))
+		if err != nil {
+			return Sources{}, fmt.Errorf("invalid address %q", a)
+		}
+		n.Addresses = append(n.Addresses, p.Masked().String())
+	}
+	n.Addresses = sortedUniqueStrings(n.Addresses)
+	n.Tags = sortedUniqueStrings(append([]string(nil), s.Tags...))
+	n.LoadBalancerUIDs = sortedUniqueStrings(append([]string(nil), s.LoadBalancerUIDs...))
+	n.KubernetesIDs = sortedUniqueStrings(append([]string(nil), s.KubernetesIDs...))
+	ids := append([]int(nil), s.DropletIDs...)
+	sort.Ints(ids)
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			n.DropletIDs = append(n.DropletIDs, id)
+		}
+	}
+	return n, nil
+}
+
+func sortedUniqueStrings(values []string) []string {
+	sort.Strings(values)
+	var out []string
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// firewallEndpointAtoms splits the sources or destinations of a rule into
+// single-entry keys.
+func firewallEndpointAtoms(s Sources) []string {
+	var atoms []string
+	for _, a := range s.Addresses {
+		atoms = append(atoms, "address:"+a)
+	}
+	for _, t := range s.Tags {
+		atoms = append(atoms, "tag:"+t)
+	}
+	for _, id := range s.DropletIDs {
+		atoms = append(atoms, "droplet:"+strconv.Itoa(id))
+	}
+	for _, id := range s.LoadBalancerUIDs {
+		atoms = append(atoms, "load_balancer:"+id)
+	}
+	for _, id := range s.KubernetesIDs {
+		atoms = append(atoms, "kubernetes:"+id)
+	}
+	return atoms
+}
+
+// firewallEndpointsFromAtoms is the inverse of firewallEndpointAtoms.
+func firewallEndpointsFromAtoms(atoms []string) Sources {
+	var s Sources
+	for _, a := range atoms {
+		kind, v, _ := strings.Cut(a, ":")
+		switch kind {
+		case "address":
+			s.Addresses = append(s.Addresses, v)
+		case "tag":
+			s.Tags = append(s.Tags, v)
+		case "droplet":
+			id, _ := strconv.Atoi(v)
+			s.DropletIDs = append(s.DropletIDs, id)
+		case "load_balancer":
+			s.LoadBalancerUIDs = append(s.LoadBalancerUIDs, v)
+		case "kubernetes":
+			s.KubernetesIDs = append(s.KubernetesIDs, v)
+		}
+	}
+	n, _ := normalizeFirewallEndpoints(s)
+	return n
+}
+
+// NormalizeFirewallRules returns the canonical form of a rule set: protocols
+// in lower case, port ranges as a single port, a range or "all", sources
+// and destinations sorted and deduplicated, and the rules for the same
+// protocol and ports merged into one, sorted by protocol and port.
+func NormalizeFirewallRules(rules *FirewallRulesRequest) (*FirewallRulesRequest, error) {
+	if rules == nil {
+		return &FirewallRulesRequest{}, nil
+	}
+	inbound, err := normalizeFirewallRuleList(rules.InboundRules, newInboundFirewallRule)
+	if err != nil {
+		return nil, err
+	}
+	outbound, err := normalizeFirewallRuleList(rules.OutboundRules, newOutboundFirewallRule)
+	if err != nil {
+		return nil, err
+	}
+	n := &FirewallRulesRequest{}
+	for _, r := range inbound {
+		n.InboundRules = append(n.InboundRules, r.inbound())
+	}
+	for _, r := range outbound {
+		n.OutboundRules = append(n.OutboundRules, r.outbound())
+	}
+	return n, nil
+}
+
+func normalizeFirewallRuleList[T any](rules []T, convert func(T) (firewallRule, error)) ([]firewallRule, error) {
+	atoms := make(map[string]map[string]bool)
+	proto := make(map[string]firewallRule)
+	for i, r := range rules {
+		fr, err := convert(r)
+		if err != nil {
+			return nil, fmt.Errorf("godo: firewall rule %d: %w", i, err)
+		}
+		k := fr.key()
+		if atoms[k] == nil {
+			atoms[k] = make(map[string]bool)
+			proto[k] = fr
+		}
+		for _, a := range firewallEndpointAtoms(fr.endpoints) {
+			atoms[k][a] = true
+		}
+	}
+	var out []firewallRule
+	for k, set := range atoms {
+		fr := proto[k]
+		fr.endpoints = firewallEndpointsFromAtoms(sortedKeys(set))
+		out = append(out, fr)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].protocol != out[j].protocol {
+			return out[i].protocol < out[j].protocol
+		}
+		if out[i].ports.lo != out[j].ports.lo {
+			return out[i].ports.lo < out[j].ports.lo
+		}
+		return out[i].ports.hi < out[j].ports.hi
+	})
+	return out, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FirewallRulesDiff holds the rules to add to and remove from a firewall to
+// reach a desired rule set.
+type FirewallRulesDiff struct {
+	Add    *FirewallRulesRequest
+	Remove *FirewallRulesRequest
+}
+
+// IsEmpty reports whether the diff changes nothing.
+func (d *FirewallRulesDiff) IsEmpty() bool {
+	return d == nil || (firewallRulesEmpty(d.Add) && firewallRulesEmpty(d.Remove))
+}
+
+func firewallRulesEmpty(r *FirewallRulesRequest) bool {
+	return r == nil || (len(r.InboundRules) == 0 && len(r.OutboundRules) == 0)
+}
+
+// DiffFirewallRules compares the rules of a live firewall with a desired
+// rule set after normalizing both. Live rules are removed, as returned by
+// the API, only when they allow a source or destination that isn't
+// desired; the desired entries they don't already allow are added as one
+// rule per protocol and port range.
+func DiffFirewallRules(live *Firewall, desired *FirewallRulesRequest) (*FirewallRulesDiff, error) {
+	if live == nil {
+		return nil, NewArgError("live", "cannot be nil")
+	}
+	if desired == nil {
+		desired = &FirewallRulesRequest{}
+	}
+	diff := &FirewallRulesDiff{Add: &FirewallRulesRequest{}, Remove: &FirewallRulesRequest{}}
+
+	add, remove, err := diffFirewallRuleList(live.InboundRules, desired.InboundRules, newInboundFirewallRule)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range add {
+		diff.Add.InboundRules = append(diff.Add.InboundRules, r.inbound())
+	}
+	diff.Remove.InboundRules = remove
+
+	addOut, removeOut, err := diffFirewallRuleList(live.OutboundRules, desired.OutboundRules, newOutboundFirewallRule)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range addOut {
+		diff.Add.OutboundRules = append(diff.Add.OutboundRules, r.outbound())
+	}
+	diff.Remove.OutboundRules = removeOut
+	return diff, nil
+}
+
+func diffFirewallRuleList[T any](live, desired []T, convert func(T) (firewallRule, error)) ([]firewallRule, []T, error) {
+	want, err := normalizeFirewallRuleList(desired, convert)
+	if err != nil {
+		return nil, nil, err
+	}
+	wanted := make(map[string]map[string]bool, len(want))
+	for _, r := range want {
+		wanted[r.key()] = make(map[string]bool)
+		for _, a := range firewallEndpointAtoms(r.endpoints) {
+			wanted[r.key()][a] = true
+		}
+	}
+
+	var remove []T
+	kept := make(map[string]map[string]bool)
+	for i, r := range live {
+		fr, err := convert(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("godo: live firewall rule %d: %w", i, err)
+		}
+		k := fr.key()
+		atoms := firewallEndpointAtoms(fr.endpoints)
+		keep := len(atoms) > 0
+		for _, a := range atoms {
+			keep = keep && wanted[k][a]
+		}
+		if !keep {
+			remove = append(remove, r)
+			continue
+		}
+		if kept[k] == nil {
+			kept[k] = make(map[string]bool)
+		}
+		for _, a := range atoms {
+			kept[k][a] = true
+		}
+	}
+
+	var add []firewallRule
+	for _, r := range want {
+		var missing []string
+		for _, a := range firewallEndpointAtoms(r.endpoints) {
+			if !kept[r.key()][a] {
+				missing = append(missing, a)
+			}
+		}
+		if len(missing) > 0 {
+			r.endpoints = firewallEndpointsFromAtoms(missing)
+			add = append(add, r)
+		}
+	}
+	return add, remove, nil
+}
+
+// SyncFirewallRules makes the rules of a firewall match a desired rule set
+// with at most one AddRules and one RemoveRules call. Rules are added
+// before others are removed so that desired traffic keeps flowing. The
+// diff is returned; nothing is sent when it is empty.
+func SyncFirewallRules(ctx context.Context, client *Client, firewallID string, desired *FirewallRulesRequest) (*FirewallRulesDiff, error) {
+	if firewallID == "" {
+		return nil, NewArgError("firewallID", "cannot be empty")
+	}
+	fw, _, err := client.Firewalls.Get(ctx, firewallID)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := DiffFirewallRules(fw, desired)
+	if err != nil {
+		return nil, err
+	}
+	if !firewallRulesEmpty(diff.Add) {
+		if _, err := client.Firewalls.AddRules(ctx, firewallID, diff.Add); err != nil {
+			return diff, fmt.Errorf("godo: adding firewall rules: %w", err)
+		}
+	}
+	if !firewallRulesEmpty(diff.Remove) {
+		if _, err := client.Firewalls.RemoveRules(ctx, firewallID, diff.Remove); err != nil {
+			return diff, fmt.Errorf("godo: removing firewall rules: %w", err)
+		}
+	}
+	return diff, nil
+}
+
+// FirewallRuleFinding is a problem found in a rule set by
+// AnalyzeFirewallRules.
+type FirewallRuleFinding struct {
+	// Kind is one of the FirewallFinding* values.
+	Kind string
+	// Direction is "inbound" or "outbound".
+	Direction string
+	// Rule is the index of the rule in its list, and Other the index of the
+	// rule it shadows or overlaps with, or -1.
+	Rule    int
+	Other   int
+	Message string
+}
+
+// FirewallAnalysisOptions configures AnalyzeFirewallRules.
+type FirewallAnalysisOptions struct {
+	// SensitivePorts are the ports that must not be open to every address.
+	// Defaults to DefaultSensitivePorts.
+	SensitivePorts []int
+}
+
+// AnalyzeFirewallRules looks for problems in a rule set. A rule is shadowed
+// when another rule for the same protocol allows all of its ports and
+// sources or destinations, which makes it redundant; two rules overlap
+// when they share ports and a source or destination without one covering
+// the other. Addresses are compared as prefixes, so 10.0.0.0/8 covers
+// 10.1.2.3. Inbound rules that open a sensitive port to 0.0.0.0/0 or ::/0
+// are reported as exposed.
+func AnalyzeFirewallRules(rules *FirewallRulesRequest, opts *FirewallAnalysisOptions) ([]FirewallRuleFinding, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	sensitive := DefaultSensitivePorts
+	if opts != nil && opts.SensitivePorts != nil {
+		sensitive = opts.SensitivePorts
+	}
+
+	var inbound, outbound []firewallRule
+	for i, r := range rules.InboundRules {
+		fr, err := newInboundFirewallRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("godo: inbound rule %d: %w", i, err)
+		}
+		inbound = append(inbound, fr)
+	}
+	for i, r := range rules.OutboundRules {
+		fr, err := newOutboundFirewallRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("godo: outbound rule %d: %w", i, err)
+		}
+		outbound = append(outbound, fr)
+	}
+
+	findings := analyzeFirewallRuleList("inbound", inbound)
+	findings = append(findings, analyzeFirewallRuleList("outbound", outbound)...)
+
+	for i, r := range inbound {
+		if r.protocol == FirewallProtocolICMP {
+			continue
+		}
+		for _, a := range r.endpoints.Addresses {
+			if a != "0.0.0.0/0" && a != "::/0" {
+				continue
+			}
+			var open []string
+			for _, p := range sensitive {
+				if r.ports.contains(firewallPortRange{p, p}) {
+					open = append(open, strconv.Itoa(p))
+				}
+			}
+			if len(open) > 0 {
+				findings = append(findings, FirewallRuleFinding{
+					Kind: FirewallFindingExposed, Direction: "inbound", Rule: i, Other: -1,
+					Message: fmt.Sprintf("%s port %s open to %s", r.protocol, strings.Join(open, ", "), a),
+				})
+			}
+		}
+	}
+	return findings, nil
+}
+
+func analyzeFirewallRuleList(direction string, rules []firewallRule) []FirewallRuleFinding {
+	var findings []FirewallRuleFinding
+	for i, r := range rules {
+		for j, o := range rules {
+			if i == j || r.protocol != o.protocol || !r.ports.overlaps(o.ports) {
+				continue
+			}
+			// Of two identical rules, the later one is reported as shadowed.
+			if o.ports.contains(r.ports) && firewallEndpointsCover(o.endpoints, r.endpoints) &&
+				(j < i || !r.ports.contains(o.ports) || !firewallEndpointsCover(r.endpoints, o.endpoints)) {
+				findings = append(findings, FirewallRuleFinding{
+					Kind: FirewallFindingShadowed, Direction: direction, Rule: i, Other: j,
+					Message: fmt.Sprintf("%s %s is already allowed by rule %d", r.protocol, r.ports, j),
+				})
+				break
+			}
+		}
+	}
+	shadowed := make(map[int]bool)
+	for _, f := range findings {
+		shadowed[f.Rule] = true
+	}
+	for i, r := range rules {
+		for j := i + 1; j < len(rules); j++ {
+			o := rules[j]
+			if shadowed[i] || shadowed[j] || r.protocol != o.protocol || !r.ports.overlaps(o.ports) {
+				continue
+			}
+			if shared := firewallSharedEndpoint(r.endpoints, o.endpoints); shared != "" {
+				findings = append(findings, FirewallRuleFinding{
+					Kind: FirewallFindingOverlap, Direction: direction, Rule: i, Other: j,
+					Message: fmt.Sprintf("%s %s and %s %s both allow %s", r.protocol, r.ports, o.protocol, o.ports, shared),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// firewallEndpointsCover reports whether every source or destination of b
+// is allowed by a.
+func firewallEndpointsCover(a, b Sources) bool {
+	for _, addr := range b.Addresses {
+		if !firewallAddressesCover(a.Addresses, addr) {
+			return false
+		}
+	}
+	return stringsSubset(b.Tags, a.Tags) &&
+		stringsSubset(b.LoadBalancerUIDs, a.LoadBalancerUIDs) &&
+		stringsSubset(b.KubernetesIDs, a.KubernetesIDs) &&
+		intsSubset(b.DropletIDs, a.DropletIDs) &&
+		len(firewallEndpointAtoms(b)) > 0
+}
+
+// firewallSharedEndpoint returns a source or destination allowed by both a
+// and b, or "".
+func firewallSharedEndpoint(a, b Sources) string {
+	for _, x := range a.Addresses {
+		for _, y := range b.Addresses {
+			px, _ := netip.ParsePrefix(x)
+			py, _ := netip.ParsePrefix(y)
+			if px.Overlaps(py) {
+				if px.Bits() > py.Bits() {
+					return x
+				}
+				return y
+			}
+		}
+	}
+	for _, atom := range firewallEndpointAtoms(a) {
+		if strings.HasPrefix(atom, "address:") {
+			continue
+		}
+		for _, other := range firewallEndpointAtoms(b) {
+			if atom == other {
+				return atom
+			}
+		}
+	}
+	return ""
+}
+
+func firewallAddressesCover(prefixes []string, addr string) bool {
+	p, err := netip.ParsePrefix(addr)
+	if err != nil {
+		return false
+	}
+	for _, s := range prefixes {
+		q, err := netip.ParsePrefix(s)
+		if err == nil && q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringsSubset(sub, set []string) bool {
+	for _, s := range sub {
+		if !slices.Contains(set, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func intsSubset(sub, set []int) bool {
+	for _, s := range sub {
+		if !slices.Contains(set, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeFirewallRules(t *testing.T) {
+	got, err := NormalizeFirewallRules(&FirewallRulesRequest{
+		InboundRules: []InboundRule{
+			{Protocol: "TCP", PortRange: "443-443", Sources: &Sources{Addresses: []string{"192.0.2.1", "10.0.0.0/8"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"192.0.2.1/32"}, Tags: []string{"web", "web"}}},
+			{Protocol: "tcp", PortRange: "1-65535", Sources: &Sources{DropletIDs: []int{3, 1, 3}}},
+			{Protocol: "icmp", PortRange: "0", Sources: &Sources{Addresses: []string{"::/0"}}},
+		},
+		OutboundRules: []OutboundRule{
+			{Protocol: "udp", PortRange: "0", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0"}}},
+			{Protocol: "udp", PortRange: "all", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0"}}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &FirewallRulesRequest{
+		InboundRules: []InboundRule{
+			{Protocol: "icmp", Sources: &Sources{Addresses: []string{"::/0"}}},
+			{Protocol: "tcp", PortRange: "all", Sources: &Sources{DropletIDs: []int{1, 3}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"10.0.0.0/8", "192.0.2.1/32"}, Tags: []string{"web"}}},
+		},
+		OutboundRules: []OutboundRule{
+			{Protocol: "udp", PortRange: "all", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0"}}},
+		},
+	}, got)
+
+	_, err = NormalizeFirewallRules(&FirewallRulesRequest{InboundRules: []InboundRule{{Protocol: "tcp", PortRange: "90-80"}}})
+	assert.EqualError(t, err, `godo: firewall rule 0: invalid port range "90-80"`)
+	_, err = NormalizeFirewallRules(&FirewallRulesRequest{InboundRules: []InboundRule{{Protocol: "sctp", PortRange: "80"}}})
+	assert.EqualError(t, err, `godo: firewall rule 0: invalid protocol "sctp"`)
+}
+
+func TestDiffFirewallRules(t *testing.T) {
+	live := &Firewall{
+		InboundRules: []InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"192.0.2.0/24", "0.0.0.0/0"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+		},
+		OutboundRules: []OutboundRule{
+			{Protocol: "tcp", PortRange: "0", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+		},
+	}
+	desired := &FirewallRulesRequest{
+		InboundRules: []InboundRule{
+			{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"::/0", "0.0.0.0/0"}}},
+			{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"192.0.2.0/24"}, Tags: []string{"bastion"}}},
+		},
+		OutboundRules: []OutboundRule{
+			{Protocol: "tcp", PortRange: "all", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+		},
+	}
+
+	diff, err := DiffFirewallRules(live, desired)
+	require.NoError(t, err)
+	assert.Equal(t, &FirewallRulesRequest{
+		InboundRules: []InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"192.0.2.0/24"}, Tags: []string{"bastion"}}},
+		},
+	}, diff.Add)
+	assert.Equal(t, &FirewallRulesRequest{InboundRules: live.InboundRules[:1]}, diff.Remove)
+
+	diff, err = DiffFirewallRules(live, &FirewallRulesRequest{
+		InboundRules:  live.InboundRules,
+		OutboundRules: live.OutboundRules,
+	})
+	require.NoError(t, err)
+	assert.True(t, diff.IsEmpty())
+}
+
+func TestSyncFirewallRules(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/v2/firewalls/fe6b88f2", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"firewall": {"id": "fe6b88f2", "inbound_rules": [
+			{"protocol": "tcp", "ports": "22", "sources": {"addresses": ["0.0.0.0/0"]}},
+			{"protocol": "tcp", "ports": "443", "sources": {"addresses": ["0.0.0.0/0"]}}
+		]}}`)
+	})
+	mux.HandleFunc("/v2/firewalls/fe6b88f2/rules", func(w http.ResponseWriter, r *http.Request) {
+		var req FirewallRulesRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		for _, rule := range req.InboundRules {
+			calls = append(calls, fmt.Sprintf("%s %s %s %v", r.Method, rule.Protocol, rule.PortRange, rule.Sources.Addresses))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	desired := &FirewallRulesRequest{InboundRules: []InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"0.0.0.0/0"}}},
+		{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}}
+	_, err := SyncFirewallRules(ctx, client, "fe6b88f2", desired)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"POST tcp 22 [192.0.2.0/24]",
+		"DELETE tcp 22 [0.0.0.0/0]",
+	}, calls)
+
+	calls = nil
+	_, err = SyncFirewallRules(ctx, client, "fe6b88f2", &FirewallRulesRequest{InboundRules: []InboundRule{
+		{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"0.0.0.0/0"}}},
+		{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"0.0.0.0/0"}}},
+	}})
+	require.NoError(t, err)
+	assert.Empty(t, calls)
+}
+
+func TestAnalyzeFirewallRules(t *testing.T) {
+	findings, err := AnalyzeFirewallRules(&FirewallRulesRequest{
+		InboundRules: []InboundRule{
+			{Protocol: "tcp", PortRange: "1-1024", Sources: &Sources{Addresses: []string{"10.0.0.0/8"}}},
+			{Protocol: "tcp", PortRange: "80", Sources: &Sources{Addresses: []string{"10.1.2.3"}}},
+			{Protocol: "tcp", PortRange: "1000-2000", Sources: &Sources{Addresses: []string{"10.1.0.0/16", "192.0.2.1"}}},
+			{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"0.0.0.0/0"}}},
+			{Protocol: "udp", PortRange: "80", Sources: &Sources{Addresses: []string{"10.1.2.3"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+		},
+		OutboundRules: []OutboundRule{
+			{Protocol: "tcp", PortRange: "all", Destinations: &Destinations{Tags: []string{"db"}}},
+			{Protocol: "tcp", PortRange: "5432", Destinations: &Destinations{Tags: []string{"db"}}},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s %s %d %d: %s", f.Kind, f.Direction, f.Rule, f.Other, f.Message))
+	}
+	assert.Equal(t, []string{
+		"shadowed inbound 1 0: tcp 80 is already allowed by rule 0",
+		"overlap inbound 0 2: tcp 1-1024 and tcp 1000-2000 both allow 10.1.0.0/16",
+		"overlap inbound 0 3: tcp 1-1024 and tcp 22 both allow 10.0.0.0/8",
+		"overlap inbound 0 5: tcp 1-1024 and tcp 443 both allow 10.0.0.0/8",
+		"shadowed outbound 1 0: tcp 5432 is already allowed by rule 0",
+		"exposed inbound 3 -1: tcp port 22 open to 0.0.0.0/0",
+	}, got)
+
+	findings, err = AnalyzeFirewallRules(&FirewallRulesRequest{
+		InboundRules: []InboundRule{{Protocol: "tcp", PortRange: "443", Sources: &Sources{Addresses: []string{"::/0"}}}},
+	}, &FirewallAnalysisOptions{SensitivePorts: []int{443}})
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, "tcp port 443 open to ::/0", findings[0].Message)
+}
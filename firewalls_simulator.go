@@ -0,0 +1,432 @@
+package godo
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConnectivityEndpoint is one end of a connection checked by a
+// FirewallSimulator. Exactly one field is set. An address that belongs to a
+// known droplet or load balancer is treated as that resource.
+type ConnectivityEndpoint struct {
+	DropletID      int
+	LoadBalancerID string
+	Address        string
+}
+
+// ConnectivityQuery asks whether traffic of a protocol can reach a port of
+// the destination from the source. Port is ignored for ICMP.
+type ConnectivityQuery struct {
+	Source      ConnectivityEndpoint
+	Destination ConnectivityEndpoint
+	Protocol    string
+	Port        int
+}
+
+// FirewallMatch identifies the firewall rule that allowed traffic.
+type FirewallMatch struct {
+	FirewallID   string
+	FirewallName string
+	// Direction is "inbound" or "outbound", and Rule the index of the rule
+	// in the firewall's list for that direction.
+	Direction string
+	Rule      int
+	// Entry is the source or destination of the rule that matched, such as
+	// "address:10.0.0.0/8" or "tag:web".
+	Entry string
+}
+
+func (m *FirewallMatch) String() string {
+	return fmt.Sprintf("%s rule %d of firewall %s (%s) matches %s", m.Direction, m.Rule, m.FirewallName, m.FirewallID, m.Entry)
+}
+
+// ConnectivityResult is the answer to a ConnectivityQuery. Egress and
+// Ingress hold the rules that allowed the traffic out of the source and into
+// the destination, when firewalls apply to them. Explanation describes each
+// step of the evaluation.
+type ConnectivityResult struct {
+	Allowed     bool
+	Egress      *FirewallMatch
+	Ingress     *FirewallMatch
+	Explanation []string
+}
+
+func (r *ConnectivityResult) String() string {
+	var b strings.Builder
+	if r.Allowed {
+		b.WriteString("allowed\n")
+	} else {
+		b.WriteString("denied\n")
+	}
+	for _, line := range r.Explanation {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	return b.String()
+}
+
+// FirewallSimulator answers reachability questions offline from fetched
+// firewalls, droplets and load balancers.
+//
+// It follows the semantics of cloud firewalls: traffic is allowed in and out
+// of a droplet no firewall applies to; once a firewall applies, through its
+// droplet IDs or tags, only the traffic matched by a rule of one of its
+// firewalls is allowed in each direction. Firewalls are stateful, so replies
+// are always allowed. Droplets in the same VPC talk over their private
+// addresses, other droplets over their public ones. Load balancers reach
+// their droplets over the VPC and are matched by ID; traffic to a load
+// balancer must match a forwarding rule and its allow and deny lists.
+type FirewallSimulator struct {
+	firewalls     []Firewall
+	droplets      map[int]*Droplet
+	loadBalancers map[string]*LoadBalancer
+}
+
+// NewFirewallSimulator returns a simulator for a set of resources, as
+// returned by Firewalls.List, Droplets.List and LoadBalancers.List.
+func NewFirewallSimulator(firewalls []Firewall, droplets []Droplet, loadBalancers []LoadBalancer) *FirewallSimulator {
+	s := &FirewallSimulator{
+		firewalls:     firewalls,
+		droplets:      make(map[int]*Droplet, len(droplets)),
+		loadBalancers: make(map[string]*LoadBalancer, len(loadBalancers)),
+	}
+	for i := range droplets {
+		s.droplets[droplets[i].ID] = &droplets[i]
+	}
+	for i := range loadBalancers {
+		s.loadBalancers[loadBalancers[i].ID] = &loadBalancers[i]
+	}
+	return s
+}
+
+// simEndpoint is a resolved ConnectivityEndpoint.
+type simEndpoint struct {
+	name     string
+	droplet  *Droplet
+	lb       *LoadBalancer
+	vpc      string
+	public   []netip.Addr
+	private  []netip.Addr
+	external bool
+}
+
+// Check evaluates a query.
+func (s *FirewallSimulator) Check(q ConnectivityQuery) (*ConnectivityResult, error) {
+	protocol := strings.ToLower(q.Protocol)
+	ports := firewallPortRange{q.Port, q.Port}
+	switch protocol {
+	case FirewallProtocolICMP:
+		ports = firewallPortRange{}
+	case FirewallProtocolTCP, FirewallProtocolUDP:
+		if q.Port < 1 || q.Port > 65535 {
+			return nil, NewArgError("Port", "must be between 1 and 65535")
+		}
+	default:
+		return nil, NewArgError("Protocol", "must be tcp, udp or icmp")
+	}
+	src, err := s.resolve("Source", q.Source)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := s.resolve("Destination", q.Destination)
+	if err != nil {
+		return nil, err
+	}
+	if src.external && dst.external {
+		return nil, NewArgError("Source", "either source or destination must be a droplet or load balancer")
+	}
+
+	traffic := protocol
+	if ports.lo != 0 {
+		traffic += "/" + strconv.Itoa(q.Port)
+	}
+	// Droplets in the same VPC connect over the VPC, and so do load
+	// balancers to their droplets. Load balancers are reached on their
+	// public addresses.
+	srcAddrs, dstAddrs := src.public, dst.public
+	if src.vpc != "" && src.vpc == dst.vpc && dst.lb == nil {
+		srcAddrs, dstAddrs = src.private, dst.private
+	}
+
+	res := &ConnectivityResult{Allowed: true}
+	explain := func(format string, args ...interface{}) {
+		res.Explanation = append(res.Explanation, fmt.Sprintf(format, args...))
+	}
+
+	if src.droplet != nil {
+		match, fws, err := s.evaluate(src.droplet, "outbound", protocol, ports, dst, dstAddrs)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(fws) == 0:
+			explain("no firewall applies to %s, outbound traffic is allowed", src.name)
+		case match != nil:
+			res.Egress = match
+			explain("%s out of %s: %s", traffic, src.name, match)
+		default:
+			res.Allowed = false
+			explain("no outbound rule of %s allows %s to %s", strings.Join(fws, ", "), traffic, dst.name)
+		}
+	}
+
+	switch {
+	case dst.droplet != nil:
+		match, fws, err := s.evaluate(dst.droplet, "inbound", protocol, ports, src, srcAddrs)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(fws) == 0:
+			explain("no firewall applies to %s, inbound traffic is allowed", dst.name)
+		case match != nil:
+			res.Ingress = match
+			explain("%s into %s: %s", traffic, dst.name, match)
+		default:
+			res.Allowed = false
+			explain("no inbound rule of %s allows %s from %s", strings.Join(fws, ", "), traffic, src.name)
+		}
+	case dst.lb != nil:
+		if ok, reason := loadBalancerAccepts(dst.lb, protocol, q.Port, srcAddrs); ok {
+			explain("%s %s", dst.name, reason)
+		} else {
+			res.Allowed = false
+			explain("%s %s", dst.name, reason)
+		}
+	}
+	return res, nil
+}
+
+func (s *FirewallSimulator) resolve(arg string, ep ConnectivityEndpoint) (*simEndpoint, error) {
+	set := 0
+	for _, ok := range []bool{ep.DropletID != 0, ep.LoadBalancerID != "", ep.Address != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, NewArgError(arg, "exactly one of DropletID, LoadBalancerID and Address must be set")
+	}
+
+	if ep.Address != "" {
+		addr, err := netip.ParseAddr(ep.Address)
+		if err != nil {
+			return nil, NewArgError(arg, fmt.Sprintf("invalid address %q", ep.Address))
+		}
+		for id, d := range s.droplets {
+			e := dropletSimEndpoint(d)
+			if containsAddr(e.public, addr) || containsAddr(e.private, addr) {
+				return s.resolve(arg, ConnectivityEndpoint{DropletID: id})
+			}
+		}
+		for id, lb := range s.loadBalancers {
+			if lb.IP == ep.Address || lb.IPv6 == ep.Address {
+				return s.resolve(arg, ConnectivityEndpoint{LoadBalancerID: id})
+			}
+		}
+		return &simEndpoint{name: ep.Address, public: []netip.Addr{addr}, external: true}, nil
+	}
+
+	if ep.DropletID != 0 {
+		d, ok := s.droplets[ep.DropletID]
+		if !ok {
+			return nil, NewArgError(arg, fmt.Sprintf("unknown droplet %d", ep.DropletID))
+		}
+		return dropletSimEndpoint(d), nil
+	}
+
+	lb, ok := s.loadBalancers[ep.LoadBalancerID]
+	if !ok {
+		return nil, NewArgError(arg, fmt.Sprintf("unknown load balancer %s", ep.LoadBalancerID))
+	}
+	e := &simEndpoint{name: fmt.Sprintf("load balancer %s", lb.Name), lb: lb, vpc: lb.VPCUUID}
+	for _, ip := range []string{lb.IP, lb.IPv6} {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			e.public = append(e.public, addr)
+		}
+	}
+	return e, nil
+}
+
+func dropletSimEndpoint(d *Droplet) *simEndpoint {
+	e := &simEndpoint{name: fmt.Sprintf("droplet %s", d.Name), droplet: d, vpc: d.VPCUUID}
+	if d.Networks == nil {
+		return e
+	}
+	for _, n := range d.Networks.V4 {
+		addr, err := netip.ParseAddr(n.IPAddress)
+		if err != nil {
+			continue
+		}
+		if n.Type == "private" {
+			e.private = append(e.private, addr)
+		} else {
+			e.public = append(e.public, addr)
+		}
+	}
+	for _, n := range d.Networks.V6 {
+		if addr, err := netip.ParseAddr(n.IPAddress); err == nil {
+			e.public = append(e.public, addr)
+		}
+	}
+	return e
+}
+
+// evaluate looks for a rule of the firewalls applying to a droplet that
+// allows traffic to or from peer. It returns the names of those firewalls,
+// which are empty when none applies.
+func (s *FirewallSimulator) evaluate(d *Droplet, direction, protocol string, ports firewallPortRange, peer *simEndpoint, peerAddrs []netip.Addr) (*FirewallMatch, []string, error) {
+	var names []string
+	var match *FirewallMatch
+	for _, fw := range s.firewalls {
+		if !firewallAppliesTo(&fw, d) {
+			continue
+		}
+		names = append(names, fw.Name)
+		if match != nil {
+			continue
+		}
+		var rules []firewallRule
+		if direction == "inbound" {
+			for i, r := range fw.InboundRules {
+				fr, err := newInboundFirewallRule(r)
+				if err != nil {
+					return nil, nil, fmt.Errorf("godo: firewall %s inbound rule %d: %w", fw.ID, i, err)
+				}
+				rules = append(rules, fr)
+			}
+		} else {
+			for i, r := range fw.OutboundRules {
+				fr, err := newOutboundFirewallRule(r)
+				if err != nil {
+					return nil, nil, fmt.Errorf("godo: firewall %s outbound rule %d: %w", fw.ID, i, err)
+				}
+				rules = append(rules, fr)
+			}
+		}
+		for i, r := range rules {
+			if r.protocol != protocol || !r.ports.contains(ports) {
+				continue
+			}
+			if entry := firewallEndpointMatch(r.endpoints, peer, peerAddrs); entry != "" {
+				match = &FirewallMatch{FirewallID: fw.ID, FirewallName: fw.Name, Direction: direction, Rule: i, Entry: entry}
+				break
+			}
+		}
+	}
+	return match, names, nil
+}
+
+func firewallAppliesTo(fw *Firewall, d *Droplet) bool {
+	for _, id := range fw.DropletIDs {
+		if id == d.ID {
+			return true
+		}
+	}
+	for _, t := range fw.Tags {
+		if slices.Contains(d.Tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// firewallEndpointMatch returns the entry of a rule's sources or
+// destinations that matches an endpoint, or "". Kubernetes clusters are
+// matched through the k8s:<cluster ID> tag of their nodes.
+func firewallEndpointMatch(s Sources, ep *simEndpoint, addrs []netip.Addr) string {
+	for _, a := range s.Addresses {
+		p, err := netip.ParsePrefix(a)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if p.Contains(addr) {
+				return "address:" + a
+			}
+		}
+	}
+	if ep.droplet != nil {
+		for _, id := range s.DropletIDs {
+			if id == ep.droplet.ID {
+				return "droplet:" + strconv.Itoa(id)
+			}
+		}
+		for _, t := range s.Tags {
+			if slices.Contains(ep.droplet.Tags, t) {
+				return "tag:" + t
+			}
+		}
+		for _, id := range s.KubernetesIDs {
+			if slices.Contains(ep.droplet.Tags, "k8s:"+id) {
+				return "kubernetes:" + id
+			}
+		}
+	}
+	if ep.lb != nil && slices.Contains(s.LoadBalancerUIDs, ep.lb.ID) {
+		return "load_balancer:" + ep.lb.ID
+	}
+	return ""
+}
+
+// loadBalancerAccepts reports whether a load balancer accepts traffic on a
+// port from a set of addresses, with the reason.
+func loadBalancerAccepts(lb *LoadBalancer, protocol string, port int, addrs []netip.Addr) (bool, string) {
+	forwarded := false
+	for _, fr := range lb.ForwardingRules {
+		entry := FirewallProtocolTCP
+		switch strings.ToLower(fr.EntryProtocol) {
+		case "udp", "http3":
+			entry = FirewallProtocolUDP
+		}
+		if entry == protocol && fr.EntryPort == port {
+			forwarded = true
+			break
+		}
+	}
+	if !forwarded {
+		return false, fmt.Sprintf("has no forwarding rule for %s/%d", protocol, port)
+	}
+	if lb.Firewall != nil {
+		if entry := lbFirewallMatch(lb.Firewall.Deny, addrs); entry != "" {
+			return false, "denies " + entry
+		}
+		if len(lb.Firewall.Allow) > 0 {
+			entry := lbFirewallMatch(lb.Firewall.Allow, addrs)
+			if entry == "" {
+				return false, "allow list does not include the source"
+			}
+			return true, fmt.Sprintf("forwards %s/%d and allows %s", protocol, port, entry)
+		}
+	}
+	return true, fmt.Sprintf("forwards %s/%d", protocol, port)
+}
+
+// lbFirewallMatch returns the first "ip:" or "cidr:" entry of a load
+// balancer allow or deny list that matches one of addrs, or "".
+func lbFirewallMatch(entries []string, addrs []netip.Addr) string {
+	for _, e := range entries {
+		_, v, _ := strings.Cut(e, ":")
+		p, err := parseFirewallPrefix(v)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if p.Contains(addr) {
+				return e
+			}
+		}
+	}
+	return ""
+}
+
+func containsAddr(addrs []netip.Addr, addr netip.Addr) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package godo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFirewallSimulator() *FirewallSimulator {
+	droplet := func(id int, name, vpc, public, private string, tags ...string) Droplet {
+		return Droplet{ID: id, Name: name, VPCUUID: vpc, Tags: tags, Networks: &Networks{V4: []NetworkV4{
+			{IPAddress: public, Type: "public"},
+			{IPAddress: private, Type: "private"},
+		}}}
+	}
+	return NewFirewallSimulator(
+		[]Firewall{
+			{
+				ID: "fw-web", Name: "web", Tags: []string{"web"},
+				InboundRules: []InboundRule{
+					{Protocol: "tcp", PortRange: "22", Sources: &Sources{Addresses: []string{"198.51.100.0/24"}}},
+					{Protocol: "tcp", PortRange: "8080", Sources: &Sources{LoadBalancerUIDs: []string{"lb-1"}}},
+				},
+				OutboundRules: []OutboundRule{
+					{Protocol: "tcp", PortRange: "5432", Destinations: &Destinations{Tags: []string{"db"}}},
+					{Protocol: "udp", PortRange: "53", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0"}}},
+				},
+			},
+			{
+				ID: "fw-db", Name: "db", DropletIDs: []int{3},
+				InboundRules: []InboundRule{
+					{Protocol: "tcp", PortRange: "5432", Sources: &Sources{Addresses: []string{"10.10.0.0/16"}}},
+					{Protocol: "icmp", Sources: &Sources{KubernetesIDs: []string{"c1"}}},
+				},
+			},
+		},
+		[]Droplet{
+			droplet(1, "web-1", "vpc-a", "203.0.113.1", "10.10.0.1", "web"),
+			droplet(2, "web-2", "vpc-b", "203.0.113.2", "10.20.0.2", "web"),
+			droplet(3, "db-1", "vpc-a", "203.0.113.3", "10.10.0.3", "db"),
+			droplet(4, "node-1", "vpc-a", "203.0.113.4", "10.10.0.4", "k8s:c1"),
+		},
+		[]LoadBalancer{{
+			ID: "lb-1", Name: "front", IP: "192.0.2.10", VPCUUID: "vpc-a",
+			ForwardingRules: []ForwardingRule{{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "http", TargetPort: 8080}},
+			Firewall:        &LBFirewall{Deny: []string{"cidr:198.51.100.0/24"}},
+		}},
+	)
+}
+
+func TestFirewallSimulator(t *testing.T) {
+	sim := testFirewallSimulator()
+
+	res, err := sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{DropletID: 1}, Destination: ConnectivityEndpoint{DropletID: 3},
+		Protocol: "tcp", Port: 5432,
+	})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, &FirewallMatch{FirewallID: "fw-web", FirewallName: "web", Direction: "outbound", Rule: 0, Entry: "tag:db"}, res.Egress)
+	assert.Equal(t, &FirewallMatch{FirewallID: "fw-db", FirewallName: "db", Direction: "inbound", Rule: 0, Entry: "address:10.10.0.0/16"}, res.Ingress)
+	assert.Equal(t, `allowed
+  tcp/5432 out of droplet web-1: outbound rule 0 of firewall web (fw-web) matches tag:db
+  tcp/5432 into droplet db-1: inbound rule 0 of firewall db (fw-db) matches address:10.10.0.0/16
+`, res.String())
+
+	// web-2 is in another VPC and connects from its public address.
+	res, err = sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{DropletID: 2}, Destination: ConnectivityEndpoint{Address: "203.0.113.3"},
+		Protocol: "tcp", Port: 5432,
+	})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.NotNil(t, res.Egress)
+	assert.Equal(t, "no inbound rule of db allows tcp/5432 from droplet web-2", res.Explanation[1])
+
+	res, err = sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{DropletID: 4}, Destination: ConnectivityEndpoint{DropletID: 3},
+		Protocol: "icmp",
+	})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, "no firewall applies to droplet node-1, outbound traffic is allowed", res.Explanation[0])
+	assert.Equal(t, "kubernetes:c1", res.Ingress.Entry)
+
+	res, err = sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{DropletID: 1}, Destination: ConnectivityEndpoint{Address: "8.8.8.8"},
+		Protocol: "tcp", Port: 443,
+	})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, []string{"no outbound rule of web allows tcp/443 to 8.8.8.8"}, res.Explanation)
+}
+
+func TestFirewallSimulator_LoadBalancer(t *testing.T) {
+	sim := testFirewallSimulator()
+
+	res, err := sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{LoadBalancerID: "lb-1"}, Destination: ConnectivityEndpoint{DropletID: 1},
+		Protocol: "tcp", Port: 8080,
+	})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, "load_balancer:lb-1", res.Ingress.Entry)
+
+	res, err = sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{Address: "192.0.2.99"}, Destination: ConnectivityEndpoint{Address: "192.0.2.10"},
+		Protocol: "tcp", Port: 443,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "allowed\n  load balancer front forwards tcp/443\n", res.String())
+
+	res, err = sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{Address: "198.51.100.7"}, Destination: ConnectivityEndpoint{LoadBalancerID: "lb-1"},
+		Protocol: "tcp", Port: 443,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "denied\n  load balancer front denies cidr:198.51.100.0/24\n", res.String())
+
+	res, err = sim.Check(ConnectivityQuery{
+		Source: ConnectivityEndpoint{Address: "192.0.2.99"}, Destination: ConnectivityEndpoint{LoadBalancerID: "lb-1"},
+		Protocol: "udp", Port: 443,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "denied\n  load balancer front has no forwarding rule for udp/443\n", res.String())
+}
+
+func TestFirewallSimulator_InvalidQuery(t *testing.T) {
+	sim := testFirewallSimulator()
+
+	_, err := sim.Check(ConnectivityQuery{Source: ConnectivityEndpoint{DropletID: 1, Address: "10.0.0.1"}, Destination: ConnectivityEndpoint{DropletID: 3}, Protocol: "tcp", Port: 22})
+	assert.EqualError(t, err, "Source is invalid because exactly one of DropletID, LoadBalancerID and Address must be set")
+	_, err = sim.Check(ConnectivityQuery{Source: ConnectivityEndpoint{DropletID: 9}, Destination: ConnectivityEndpoint{DropletID: 3}, Protocol: "tcp", Port: 22})
+	assert.EqualError(t, err, "Source is invalid because unknown droplet 9")
+	_, err = sim.Check(ConnectivityQuery{Source: ConnectivityEndpoint{DropletID: 1}, Destination: ConnectivityEndpoint{DropletID: 3}, Protocol: "tcp"})
+	assert.EqualError(t, err, "Port is invalid because must be between 1 and 65535")
+	_, err = sim.Check(ConnectivityQuery{Source: ConnectivityEndpoint{Address: "8.8.8.8"}, Destination: ConnectivityEndpoint{Address: "1.1.1.1"}, Protocol: "icmp"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package godo
+
+import (
+	"context"
+	"net/netip"
+	"time"
+)
+
+// collectPages calls list for every page of a paginated listing and returns
+// the concatenated results.
+func collectPages[T any](list func(opt *ListOptions) ([]T, *Response, error)) ([]T, error) {
+	var all []T
+	opt := &ListOptions{PerPage: 200}
+	for {
+		items, resp, err := list(opt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+			return all, nil
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+		opt.Page = page + 1
+	}
+}
+
+// parseFirewallPrefix parses an address or a CIDR range. An address is
+// returned as a single-address prefix, and a range with its host bits
+// cleared.
+func parseFirewallPrefix(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+// sleepContext waits for d or until ctx is done, and returns ctx.Err() in
+// the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
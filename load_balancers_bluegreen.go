@@ -0,0 +1,269 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBackendSwitchHealthTimeout = 5 * time.Minute
+	defaultBackendSwitchPollInterval  = 10 * time.Second
+
+	// backendHealthWindow is how far back health check metrics are read;
+	// the latest sample of each droplet is used.
+	backendHealthWindow = 5 * time.Minute
+)
+
+// LoadBalancerActive is the status of a load balancer that is serving
+// traffic.
+const LoadBalancerActive = "active"
+
+// BackendSwitchOutcome is the result of a SwitchLoadBalancerBackends run.
+type BackendSwitchOutcome string
+
+const (
+	// BackendSwitchSucceeded means the new backends passed their health
+	// checks and the old ones were removed.
+	BackendSwitchSucceeded BackendSwitchOutcome = "succeeded"
+	// BackendSwitchRolledBack means the new backends did not pass their
+	// health checks in time and the load balancer was restored.
+	BackendSwitchRolledBack BackendSwitchOutcome = "rolled_back"
+)
+
+// SwitchLoadBalancerBackendsRequest configures SwitchLoadBalancerBackends.
+// Exactly one of DropletIDs and Tag is set, matching how the load balancer
+// selects its backends.
+type SwitchLoadBalancerBackendsRequest struct {
+	LoadBalancerID string
+	// DropletIDs are the new backends. They are added next to the current
+	// ones, which are removed once the new ones are healthy.
+	DropletIDs []int
+	// Tag replaces the tag of the load balancer. The switch is immediate, so
+	// the old tag is restored if the droplets with the new tag don't become
+	// healthy.
+	Tag string
+
+	// HealthTimeout bounds the wait for the new backends to pass their health
+	// checks. Defaults to five minutes.
+	HealthTimeout time.Duration
+	// PollInterval is the delay between health polls. Defaults to ten seconds.
+	PollInterval time.Duration
+	// DrainDelay is how long the old and new backends serve together once
+	// the new ones are healthy, before the old ones are removed.
+	DrainDelay time.Duration
+}
+
+// SwitchLoadBalancerBackendsReport describes what SwitchLoadBalancerBackends
+// did.
+type SwitchLoadBalancerBackendsReport struct {
+	LoadBalancerID string
+	Outcome        BackendSwitchOutcome
+	// Reason explains why the switch was rolled back.
+	Reason string
+
+	// Added and Removed are the droplets added to and removed from the load
+	// balancer by a switch of droplet IDs.
+	Added   []int
+	Removed []int
+	// PreviousTag is the tag of the load balancer before a switch of tag.
+	PreviousTag string
+	// Unhealthy lists the new backends that had not passed their health
+	// checks when the switch was rolled back.
+	Unhealthy []int
+}
+
+// SwitchLoadBalancerBackends moves the traffic of a load balancer to a new
+// group of droplets. The new droplets are added, or the load balancer's tag
+// is changed, and the workflow waits until the load balancer is active and
+// MonitoringService.GetLoadBalancerDropletsHealthChecks reports every new
+// droplet healthy. The old droplets are then removed. If the new droplets
+// aren't healthy within the timeout, or ctx is cancelled while waiting, the
+// load balancer is restored to its previous backends.
+//
+// An error is only returned when the workflow can't be carried out, for
+// example because an API call fails; failing health checks are reported
+// through the Outcome of the returned report.
+func SwitchLoadBalancerBackends(ctx context.Context, client *Client, req *SwitchLoadBalancerBackendsRequest) (*SwitchLoadBalancerBackendsReport, error) {
+	if req == nil || req.LoadBalancerID == "" {
+		return nil, NewArgError("req.LoadBalancerID", "cannot be empty")
+	}
+	if (len(req.DropletIDs) == 0) == (req.Tag == "") {
+		return nil, NewArgError("req", "exactly one of DropletIDs and Tag must be set")
+	}
+	report := &SwitchLoadBalancerBackendsReport{LoadBalancerID: req.LoadBalancerID}
+
+	lb, _, err := client.LoadBalancers.Get(ctx, req.LoadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Tag != "" {
+		return report, switchLoadBalancerTag(ctx, client, req, lb, report)
+	}
+	if lb.Tag != "" {
+		return nil, NewArgError("req.DropletIDs", fmt.Sprintf("load balancer selects droplets by tag %q", lb.Tag))
+	}
+
+	for _, id := range req.DropletIDs {
+		if !slices.Contains(lb.DropletIDs, id) {
+			report.Added = append(report.Added, id)
+		}
+	}
+	var old []int
+	for _, id := range lb.DropletIDs {
+		if !slices.Contains(req.DropletIDs, id) {
+			old = append(old, id)
+		}
+	}
+
+	if len(report.Added) > 0 {
+		if _, err := client.LoadBalancers.AddDroplets(ctx, lb.ID, report.Added...); err != nil {
+			return report, fmt.Errorf("godo: adding droplets to load balancer: %w", err)
+		}
+	}
+	unhealthy, err := waitForBackendHealth(ctx, client, req, req.DropletIDs)
+	if unhealthy != nil || err != nil {
+		report.Outcome, report.Unhealthy, report.Reason = BackendSwitchRolledBack, unhealthy, backendSwitchReason(unhealthy, err)
+		if len(report.Added) > 0 {
+			if _, rerr := client.LoadBalancers.RemoveDroplets(context.WithoutCancel(ctx), lb.ID, report.Added...); rerr != nil {
+				return report, fmt.Errorf("godo: rolling back load balancer droplets: %w", rerr)
+			}
+		}
+		return report, err
+	}
+
+	if err := sleepContext(ctx, req.DrainDelay); err != nil {
+		return report, err
+	}
+	if len(old) > 0 {
+		if _, err := client.LoadBalancers.RemoveDroplets(ctx, lb.ID, old...); err != nil {
+			return report, fmt.Errorf("godo: removing droplets from load balancer: %w", err)
+		}
+		report.Removed = old
+	}
+	report.Outcome = BackendSwitchSucceeded
+	return report, nil
+}
+
+func switchLoadBalancerTag(ctx context.Context, client *Client, req *SwitchLoadBalancerBackendsRequest, lb *LoadBalancer, report *SwitchLoadBalancerBackendsReport) error {
+	if len(lb.DropletIDs) > 0 && lb.Tag == "" {
+		return NewArgError("req.Tag", "load balancer selects droplets by ID")
+	}
+	report.PreviousTag = lb.Tag
+	if lb.Tag == req.Tag {
+		report.Outcome = BackendSwitchSucceeded
+		return nil
+	}
+
+	droplets, err := collectPages(func(opt *ListOptions) ([]Droplet, *Response, error) {
+		return client.Droplets.ListByTag(ctx, req.Tag, opt)
+	})
+	if err != nil {
+		return err
+	}
+	if len(droplets) == 0 {
+		return NewArgError("req.Tag", fmt.Sprintf("no droplets are tagged %q", req.Tag))
+	}
+	ids := make([]int, 0, len(droplets))
+	for _, d := range droplets {
+		ids = append(ids, d.ID)
+	}
+
+	update := lb.AsRequest()
+	update.Tag, update.DropletIDs = req.Tag, nil
+	if _, _, err := client.LoadBalancers.Update(ctx, lb.ID, update); err != nil {
+		return fmt.Errorf("godo: switching load balancer tag: %w", err)
+	}
+	unhealthy, err := waitForBackendHealth(ctx, client, req, ids)
+	if unhealthy != nil || err != nil {
+		report.Outcome, report.Unhealthy, report.Reason = BackendSwitchRolledBack, unhealthy, backendSwitchReason(unhealthy, err)
+		update.Tag = lb.Tag
+		if _, _, rerr := client.LoadBalancers.Update(context.WithoutCancel(ctx), lb.ID, update); rerr != nil {
+			return fmt.Errorf("godo: rolling back load balancer tag: %w", rerr)
+		}
+		return err
+	}
+	report.Outcome = BackendSwitchSucceeded
+	return nil
+}
+
+// waitForBackendHealth polls until the load balancer is active and every
+// droplet passes its health checks. When the timeout expires it returns the
+// droplets still unhealthy; an error is returned when ctx is done or a call
+// fails.
+func waitForBackendHealth(ctx context.Context, client *Client, req *SwitchLoadBalancerBackendsRequest, dropletIDs []int) ([]int, error) {
+	timeout, interval := req.HealthTimeout, req.PollInterval
+	if timeout <= 0 {
+		timeout = defaultBackendSwitchHealthTimeout
+	}
+	if interval <= 0 {
+		interval = defaultBackendSwitchPollInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		unhealthy, err := unhealthyBackends(ctx, client, req.LoadBalancerID, dropletIDs)
+		if err != nil || len(unhealthy) == 0 {
+			return nil, err
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			return unhealthy, nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return unhealthy, err
+		}
+	}
+}
+
+// unhealthyBackends returns the droplets whose latest health check sample is
+// missing or failing. All droplets are unhealthy while the load balancer
+// isn't active.
+func unhealthyBackends(ctx context.Context, client *Client, lbID string, dropletIDs []int) ([]int, error) {
+	lb, _, err := client.LoadBalancers.Get(ctx, lbID)
+	if err != nil {
+		return nil, err
+	}
+	if lb.Status != LoadBalancerActive {
+		return append([]int(nil), dropletIDs...), nil
+	}
+
+	now := time.Now()
+	resp, _, err := client.Monitoring.GetLoadBalancerDropletsHealthChecks(ctx, &LoadBalancerMetricsRequest{
+		LoadBalancerID: lbID,
+		Start:          now.Add(-backendHealthWindow),
+		End:            now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	healthy := make(map[int]bool)
+	for _, series := range resp.Data.Result {
+		id, err := strconv.Atoi(string(series.Metric["droplet_id"]))
+		if err != nil {
+			id, err = strconv.Atoi(string(series.Metric["host_id"]))
+		}
+		if err != nil || len(series.Values) == 0 {
+			continue
+		}
+		healthy[id] = series.Values[len(series.Values)-1].Value >= 1
+	}
+
+	var unhealthy []int
+	for _, id := range dropletIDs {
+		if !healthy[id] {
+			unhealthy = append(unhealthy, id)
+		}
+	}
+	sort.Ints(unhealthy)
+	return unhealthy, nil
+}
+
+func backendSwitchReason(unhealthy []int, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("droplets %v did not pass their health checks in time", unhealthy)
+}
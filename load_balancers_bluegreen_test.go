@@ -0,0 +1,131 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTestBackendSwitch serves load balancer lb-1 and its droplet health
+// checks, and records the changes made to it. healthy returns the health
+// samples of the droplets at each poll.
+func serveTestBackendSwitch(t *testing.T, lbJSON string, healthy func(poll int) map[int]int) *[]string {
+	var (
+		mu    sync.Mutex
+		calls []string
+		polls int
+	)
+	mux.HandleFunc("/v2/load_balancers/lb-1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var req LoadBalancerRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			mu.Lock()
+			calls = append(calls, fmt.Sprintf("PUT tag=%s", req.Tag))
+			mu.Unlock()
+		}
+		fmt.Fprintf(w, `{"load_balancer": %s}`, lbJSON)
+	})
+	mux.HandleFunc("/v2/load_balancers/lb-1/droplets", func(w http.ResponseWriter, r *http.Request) {
+		var req dropletIDsRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s %v", r.Method, req.IDs))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/v2/monitoring/metrics/load_balancer/droplets_health_checks", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "lb-1", r.URL.Query().Get("lb_id"))
+		mu.Lock()
+		polls++
+		samples := healthy(polls)
+		mu.Unlock()
+		var series []string
+		for id, v := range samples {
+			series = append(series, fmt.Sprintf(`{"metric": {"droplet_id": "%d"}, "values": [[1729453800, "0"], [1729453920, "%d"]]}`, id, v))
+		}
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "matrix", "result": [%s]}}`, strings.Join(series, ","))
+	})
+	return &calls
+}
+
+func TestSwitchLoadBalancerBackends(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := serveTestBackendSwitch(t, `{"id": "lb-1", "status": "active", "droplet_ids": [1, 2]}`, func(poll int) map[int]int {
+		if poll == 1 {
+			return map[int]int{1: 1, 2: 1, 3: 0}
+		}
+		return map[int]int{1: 1, 2: 1, 3: 1, 4: 1}
+	})
+
+	report, err := SwitchLoadBalancerBackends(ctx, client, &SwitchLoadBalancerBackendsRequest{
+		LoadBalancerID: "lb-1",
+		DropletIDs:     []int{2, 3, 4},
+		PollInterval:   time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &SwitchLoadBalancerBackendsReport{
+		LoadBalancerID: "lb-1",
+		Outcome:        BackendSwitchSucceeded,
+		Added:          []int{3, 4},
+		Removed:        []int{1},
+	}, report)
+	assert.Equal(t, []string{"POST [3 4]", "DELETE [1]"}, *calls)
+}
+
+func TestSwitchLoadBalancerBackends_RollBack(t *testing.T) {
+	setup()
+	defer teardown()
+
+	calls := serveTestBackendSwitch(t, `{"id": "lb-1", "status": "active", "droplet_ids": [1]}`, func(int) map[int]int {
+		return map[int]int{1: 1, 2: 0}
+	})
+
+	report, err := SwitchLoadBalancerBackends(ctx, client, &SwitchLoadBalancerBackendsRequest{
+		LoadBalancerID: "lb-1",
+		DropletIDs:     []int{2, 3},
+		HealthTimeout:  20 * time.Millisecond,
+		PollInterval:   time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BackendSwitchRolledBack, report.Outcome)
+	assert.Equal(t, []int{2, 3}, report.Unhealthy)
+	assert.Equal(t, "droplets [2 3] did not pass their health checks in time", report.Reason)
+	assert.Equal(t, []string{"POST [2 3]", "DELETE [2 3]"}, *calls)
+}
+
+func TestSwitchLoadBalancerBackends_Tag(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "green", r.URL.Query().Get("tag_name"))
+		fmt.Fprint(w, `{"droplets": [{"id": 7}, {"id": 8}]}`)
+	})
+	calls := serveTestBackendSwitch(t, `{"id": "lb-1", "status": "active", "tag": "blue", "droplet_ids": [1, 2]}`, func(int) map[int]int {
+		return map[int]int{7: 1, 8: 0}
+	})
+
+	report, err := SwitchLoadBalancerBackends(ctx, client, &SwitchLoadBalancerBackendsRequest{
+		LoadBalancerID: "lb-1",
+		Tag:            "green",
+		HealthTimeout:  20 * time.Millisecond,
+		PollInterval:   time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BackendSwitchRolledBack, report.Outcome)
+	assert.Equal(t, "blue", report.PreviousTag)
+	assert.Equal(t, []int{8}, report.Unhealthy)
+	assert.Equal(t, []string{"PUT tag=green", "PUT tag=blue"}, *calls)
+
+	_, err = SwitchLoadBalancerBackends(ctx, client, &SwitchLoadBalancerBackendsRequest{LoadBalancerID: "lb-1", DropletIDs: []int{3}})
+	assert.EqualError(t, err, `req.DropletIDs is invalid because load balancer selects droplets by tag "blue"`)
+}
@@ -0,0 +1,397 @@
+package godo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailoverInterval           = 10 * time.Second
+	defaultFailoverThreshold          = 3
+	defaultFailoverActionTimeout      = 2 * time.Minute
+	defaultFailoverActionPollInterval = 2 * time.Second
+
+	// failoverEventHistory is the number of events a FailoverController
+	// keeps.
+	failoverEventHistory = 100
+)
+
+// FailoverProbe checks the health of a droplet.
+type FailoverProbe interface {
+	Check(ctx context.Context, droplet *Droplet) error
+}
+
+// FailoverProbeFunc adapts a function to a FailoverProbe.
+type FailoverProbeFunc func(ctx context.Context, droplet *Droplet) error
+
+// Check calls f.
+func (f FailoverProbeFunc) Check(ctx context.Context, droplet *Droplet) error {
+	return f(ctx, droplet)
+}
+
+// TCPProbe returns a probe that connects to a port of a droplet's public
+// IPv4 address.
+func TCPProbe(port int, timeout time.Duration) FailoverProbe {
+	return FailoverProbeFunc(func(ctx context.Context, droplet *Droplet) error {
+		ip, err := droplet.PublicIPv4()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// LeaderElector decides which of several controllers watching the same
+// reserved IPs may reassign them, so that they don't flap between droplets.
+type LeaderElector interface {
+	IsLeader(ctx context.Context) (bool, error)
+}
+
+// FailoverEventType is the kind of a FailoverEvent.
+type FailoverEventType string
+
+const (
+	// FailoverEventProbeFailed is recorded when the droplet holding the
+	// reserved IPs fails its health check.
+	FailoverEventProbeFailed FailoverEventType = "probe_failed"
+	// FailoverEventRecovered is recorded when the droplet passes its health
+	// check after failing it.
+	FailoverEventRecovered FailoverEventType = "recovered"
+	// FailoverEventSkipped is recorded when a failover is due but isn't
+	// carried out, because the other droplet is unhealthy too or this
+	// controller isn't the leader.
+	FailoverEventSkipped FailoverEventType = "skipped"
+	// FailoverEventFailedOver is recorded when the reserved IPs have moved to
+	// the other droplet.
+	FailoverEventFailedOver FailoverEventType = "failed_over"
+	// FailoverEventReconciled is recorded when the reserved IPv6 address is
+	// moved to the droplet holding the reserved IPv4 address.
+	FailoverEventReconciled FailoverEventType = "reconciled"
+	// FailoverEventError is recorded when a check or a reassignment fails.
+	FailoverEventError FailoverEventType = "error"
+)
+
+// FailoverEvent is something that happened in a FailoverController.
+type FailoverEvent struct {
+	Time      time.Time
+	Type      FailoverEventType
+	DropletID int
+	Message   string
+	Err       error
+}
+
+// FailoverConfig configures a FailoverController.
+type FailoverConfig struct {
+	// ReservedIPv4 and ReservedIPv6 are the addresses to move. At least one
+	// is set.
+	ReservedIPv4 string
+	ReservedIPv6 string
+	// PrimaryID and StandbyID are the droplets that hold the addresses. They
+	// must be in the region of the addresses.
+	PrimaryID int
+	StandbyID int
+
+	Probe FailoverProbe
+	// Leader, if set, is asked before every reassignment.
+	Leader LeaderElector
+	// OnEvent, if set, receives every event.
+	OnEvent func(FailoverEvent)
+
+	// Interval is the delay between health checks. Defaults to ten seconds.
+	Interval time.Duration
+	// FailureThreshold is the number of consecutive failed health checks
+	// that trigger a failover. Defaults to three.
+	FailureThreshold int
+	// ActionTimeout bounds the wait for an assign action to complete.
+	// Defaults to two minutes.
+	ActionTimeout time.Duration
+	// ActionPollInterval is the delay between action status polls. Defaults
+	// to two seconds.
+	ActionPollInterval time.Duration
+}
+
+// FailoverController moves reserved IPs between a primary and a standby
+// droplet. It checks the health of the droplet currently holding the
+// addresses and, after FailureThreshold consecutive failures, assigns them
+// to the other droplet if that one is healthy. The roles are symmetric: once
+// the standby holds the addresses, the addresses move back if it fails in
+// turn. The holder is read from the API at every check, so a controller
+// notices reassignments made by others.
+type FailoverController struct {
+	client *Client
+	cfg    FailoverConfig
+
+	mu       sync.Mutex
+	failures int
+	events   []FailoverEvent
+}
+
+// NewFailoverController returns a controller for the reserved IPs of cfg.
+func NewFailoverController(client *Client, cfg *FailoverConfig) (*FailoverController, error) {
+	if cfg == nil {
+		return nil, NewArgError("cfg", "cannot be nil")
+	}
+	c := &FailoverController{client: client, cfg: *cfg}
+	switch {
+	case c.cfg.ReservedIPv4 == "" && c.cfg.ReservedIPv6 == "":
+		return nil, NewArgError("cfg", "at least one of ReservedIPv4 and ReservedIPv6 must be set")
+	case c.cfg.PrimaryID == 0 || c.cfg.StandbyID == 0 || c.cfg.PrimaryID == c.cfg.StandbyID:
+		return nil, NewArgError("cfg", "PrimaryID and StandbyID must be two droplets")
+	case c.cfg.Probe == nil:
+		return nil, NewArgError("cfg.Probe", "cannot be nil")
+	}
+	if c.cfg.Interval <= 0 {
+		c.cfg.Interval = defaultFailoverInterval
+	}
+	if c.cfg.FailureThreshold <= 0 {
+		c.cfg.FailureThreshold = defaultFailoverThreshold
+	}
+	if c.cfg.ActionTimeout <= 0 {
+		c.cfg.ActionTimeout = defaultFailoverActionTimeout
+	}
+	if c.cfg.ActionPollInterval <= 0 {
+		c.cfg.ActionPollInterval = defaultFailoverActionPollInterval
+	}
+	return c, nil
+}
+
+// Run checks the droplets every Interval until ctx is done, and returns
+// ctx.Err(). Errors of a check are recorded as events and don't stop it.
+func (c *FailoverController) Run(ctx context.Context) error {
+	for {
+		if err := c.Step(ctx); err != nil && ctx.Err() == nil {
+			c.record(FailoverEvent{Type: FailoverEventError, Message: "check failed", Err: err})
+		}
+		if err := sleepContext(ctx, c.cfg.Interval); err != nil {
+			return err
+		}
+	}
+}
+
+// Events returns the most recent events, oldest first.
+func (c *FailoverController) Events() []FailoverEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]FailoverEvent(nil), c.events...)
+}
+
+func (c *FailoverController) record(e FailoverEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	c.mu.Lock()
+	c.events = append(c.events, e)
+	if len(c.events) > failoverEventHistory {
+		c.events = c.events[len(c.events)-failoverEventHistory:]
+	}
+	c.mu.Unlock()
+	if c.cfg.OnEvent != nil {
+		c.cfg.OnEvent(e)
+	}
+}
+
+// Step runs a single health check, and fails over if it is due. When the
+// IPv4 and IPv6 addresses are held by different droplets, such as after a
+// failover that only moved one of them, the IPv6 address is moved to the
+// healthy IPv4 holder.
+func (c *FailoverController) Step(ctx context.Context) error {
+	h, err := c.holders(ctx)
+	if err != nil {
+		return err
+	}
+	holder := h.ipv4
+	if c.cfg.ReservedIPv4 == "" {
+		holder = h.ipv6
+	}
+	// Unassigned addresses, or addresses held by another droplet, are
+	// assigned to the primary like after a failure of the standby.
+	active, other := c.cfg.StandbyID, c.cfg.PrimaryID
+	if holder == c.cfg.PrimaryID {
+		active, other = c.cfg.PrimaryID, c.cfg.StandbyID
+	}
+
+	if holder == active {
+		droplet, _, err := c.client.Droplets.Get(ctx, active)
+		if err != nil {
+			return err
+		}
+		perr := c.cfg.Probe.Check(ctx, droplet)
+		c.mu.Lock()
+		recovered := perr == nil && c.failures > 0
+		if perr == nil {
+			c.failures = 0
+		} else {
+			c.failures++
+		}
+		failures := c.failures
+		c.mu.Unlock()
+		if recovered {
+			c.record(FailoverEvent{Type: FailoverEventRecovered, DropletID: active, Message: "health check passed"})
+		}
+		if perr == nil {
+			return c.reconcile(ctx, h, active)
+		}
+		c.record(FailoverEvent{
+			Type: FailoverEventProbeFailed, DropletID: active, Err: perr,
+			Message: fmt.Sprintf("health check failed %d of %d times", failures, c.cfg.FailureThreshold),
+		})
+		if failures < c.cfg.FailureThreshold {
+			return nil
+		}
+	}
+
+	target, _, err := c.client.Droplets.Get(ctx, other)
+	if err != nil {
+		return err
+	}
+	if target.Region != nil && h.region != "" && target.Region.Slug != h.region {
+		return fmt.Errorf("godo: droplet %d is in %s, not in the region of the reserved IPs %s", other, target.Region.Slug, h.region)
+	}
+	if perr := c.cfg.Probe.Check(ctx, target); perr != nil {
+		c.record(FailoverEvent{Type: FailoverEventSkipped, DropletID: other, Err: perr, Message: "droplet to fail over to is unhealthy"})
+		return nil
+	}
+	if leader, err := c.isLeader(ctx); err != nil || !leader {
+		if err == nil {
+			c.record(FailoverEvent{Type: FailoverEventSkipped, DropletID: other, Message: "not the leader"})
+		}
+		return err
+	}
+
+	if err := c.assign(ctx, other, h.ipv4 != other, h.ipv6 != other); err != nil {
+		c.record(FailoverEvent{Type: FailoverEventError, DropletID: other, Err: err, Message: "failover failed"})
+		return err
+	}
+	c.mu.Lock()
+	c.failures = 0
+	c.mu.Unlock()
+	c.record(FailoverEvent{Type: FailoverEventFailedOver, DropletID: other, Message: fmt.Sprintf("reserved IPs moved from droplet %d", holder)})
+	return nil
+}
+
+// reconcile moves the IPv6 address to the healthy droplet holding the IPv4
+// address when they differ.
+func (c *FailoverController) reconcile(ctx context.Context, h reservedIPHolders, holder int) error {
+	if c.cfg.ReservedIPv4 == "" || c.cfg.ReservedIPv6 == "" || h.ipv6 == holder {
+		return nil
+	}
+	if leader, err := c.isLeader(ctx); err != nil || !leader {
+		return err
+	}
+	if err := c.assign(ctx, holder, false, true); err != nil {
+		c.record(FailoverEvent{Type: FailoverEventError, DropletID: holder, Err: err, Message: "moving reserved IPv6 failed"})
+		return err
+	}
+	c.record(FailoverEvent{Type: FailoverEventReconciled, DropletID: holder, Message: fmt.Sprintf("reserved IPv6 moved from droplet %d", h.ipv6)})
+	return nil
+}
+
+func (c *FailoverController) isLeader(ctx context.Context) (bool, error) {
+	if c.cfg.Leader == nil {
+		return true, nil
+	}
+	leader, err := c.cfg.Leader.IsLeader(ctx)
+	if err != nil {
+		return false, fmt.Errorf("godo: leader election: %w", err)
+	}
+	return leader, nil
+}
+
+// reservedIPHolders are the droplets the reserved IPs are assigned to, or 0,
+// and the region of the addresses.
+type reservedIPHolders struct {
+	ipv4, ipv6 int
+	region     string
+}
+
+func (c *FailoverController) holders(ctx context.Context) (reservedIPHolders, error) {
+	var h reservedIPHolders
+	if c.cfg.ReservedIPv4 != "" {
+		ip, _, err := c.client.ReservedIPs.Get(ctx, c.cfg.ReservedIPv4)
+		if err != nil {
+			return h, err
+		}
+		if ip.Droplet != nil {
+			h.ipv4 = ip.Droplet.ID
+		}
+		if ip.Region != nil {
+			h.region = ip.Region.Slug
+		}
+	}
+	if c.cfg.ReservedIPv6 != "" {
+		ip, _, err := c.client.ReservedIPV6s.Get(ctx, c.cfg.ReservedIPv6)
+		if err != nil {
+			return h, err
+		}
+		if ip.Droplet != nil {
+			h.ipv6 = ip.Droplet.ID
+		}
+		if h.region == "" {
+			h.region = ip.RegionSlug
+		}
+	}
+	return h, nil
+}
+
+// assign moves the selected reserved IPs to a droplet and waits for the
+// actions to complete.
+func (c *FailoverController) assign(ctx context.Context, dropletID int, ipv4, ipv6 bool) error {
+	var actions []*Action
+	if ipv4 && c.cfg.ReservedIPv4 != "" {
+		a, _, err := c.client.ReservedIPActions.Assign(ctx, c.cfg.ReservedIPv4, dropletID)
+		if err != nil {
+			return fmt.Errorf("godo: assigning %s: %w", c.cfg.ReservedIPv4, err)
+		}
+		actions = append(actions, a)
+	}
+	if ipv6 && c.cfg.ReservedIPv6 != "" {
+		a, _, err := c.client.ReservedIPV6Actions.Assign(ctx, c.cfg.ReservedIPv6, dropletID)
+		if err != nil {
+			return fmt.Errorf("godo: assigning %s: %w", c.cfg.ReservedIPv6, err)
+		}
+		actions = append(actions, a)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ActionTimeout)
+	defer cancel()
+	var errs []error
+	for _, a := range actions {
+		if err := waitForAction(ctx, c.client, a, c.cfg.ActionPollInterval); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitForAction polls an action until it completes.
+func waitForAction(ctx context.Context, client *Client, action *Action, interval time.Duration) error {
+	for {
+		switch action.Status {
+		case ActionCompleted:
+			return nil
+		case ActionInProgress, "":
+		default:
+			return fmt.Errorf("godo: action %d (%s) %s", action.ID, action.Type, action.Status)
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return fmt.Errorf("godo: waiting for action %d (%s): %w", action.ID, action.Type, err)
+		}
+		a, _, err := client.Actions.Get(ctx, action.ID)
+		if err != nil {
+			return err
+		}
+		action = a
+	}
+}
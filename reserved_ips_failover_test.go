@@ -0,0 +1,212 @@
+package godo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLeader bool
+
+func (l fakeLeader) IsLeader(context.Context) (bool, error) {
+	return bool(l), nil
+}
+
+// fakeFailoverAPI is the state of the reserved IPs served by
+// setupFailoverAPI.
+type fakeFailoverAPI struct {
+	ipv4, ipv6 int
+	// failIPv6 makes IPv6 assign actions error.
+	failIPv6 bool
+	assigns  []string
+}
+
+// setupFailoverAPI serves reserved IPs held by droplet 1, and records the
+// droplets they are assigned to.
+func setupFailoverAPI(t *testing.T) *fakeFailoverAPI {
+	api := &fakeFailoverAPI{ipv4: 1, ipv6: 1}
+	droplet := func(id int) string {
+		if id == 0 {
+			return "null"
+		}
+		return fmt.Sprintf(`{"id": %d}`, id)
+	}
+	mux.HandleFunc("/v2/reserved_ips/192.0.2.10", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, `{"reserved_ip": {"ip": "192.0.2.10", "region": {"slug": "nyc3"}, "droplet": %s}}`, droplet(api.ipv4))
+	})
+	mux.HandleFunc("/v2/reserved_ipv6/2001:db8::10", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, `{"reserved_ipv6": {"ip": "2001:db8::10", "region_slug": "nyc3", "droplet": %s}}`, droplet(api.ipv6))
+	})
+	mux.HandleFunc("/v2/reserved_ips/192.0.2.10/actions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		var req ActionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		api.assigns = append(api.assigns, fmt.Sprintf("ipv4 %v", req["droplet_id"]))
+		api.ipv4 = int(req["droplet_id"].(float64))
+		fmt.Fprint(w, `{"action": {"id": 1, "type": "assign_ip", "status": "in-progress"}}`)
+	})
+	mux.HandleFunc("/v2/reserved_ipv6/2001:db8::10/actions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		var req ActionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		api.assigns = append(api.assigns, fmt.Sprintf("ipv6 %v", req["droplet_id"]))
+		if api.failIPv6 {
+			fmt.Fprint(w, `{"action": {"id": 2, "type": "assign", "status": "errored"}}`)
+			return
+		}
+		api.ipv6 = int(req["droplet_id"].(float64))
+		fmt.Fprint(w, `{"action": {"id": 2, "type": "assign", "status": "completed"}}`)
+	})
+	mux.HandleFunc("/v2/actions/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"action": {"id": 1, "type": "assign_ip", "status": "completed"}}`)
+	})
+	mux.HandleFunc("/v2/droplets/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		id := strings.TrimPrefix(r.URL.Path, "/v2/droplets/")
+		fmt.Fprintf(w, `{"droplet": {"id": %s, "region": {"slug": "nyc3"}}}`, id)
+	})
+	return api
+}
+
+func failoverEventTypes(c *FailoverController) []FailoverEventType {
+	var types []FailoverEventType
+	for _, e := range c.Events() {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestFailoverController_Step(t *testing.T) {
+	setup()
+	defer teardown()
+
+	api := setupFailoverAPI(t)
+
+	down := map[int]bool{1: true}
+	c, err := NewFailoverController(client, &FailoverConfig{
+		ReservedIPv4:       "192.0.2.10",
+		ReservedIPv6:       "2001:db8::10",
+		PrimaryID:          1,
+		StandbyID:          2,
+		FailureThreshold:   2,
+		ActionPollInterval: time.Millisecond,
+		Probe: FailoverProbeFunc(func(ctx context.Context, d *Droplet) error {
+			if down[d.ID] {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+		Leader: fakeLeader(true),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Step(ctx))
+	assert.Empty(t, api.assigns)
+	require.NoError(t, c.Step(ctx))
+	assert.Equal(t, []string{"ipv4 2", "ipv6 2"}, api.assigns)
+	assert.Equal(t, []FailoverEventType{FailoverEventProbeFailed, FailoverEventProbeFailed, FailoverEventFailedOver}, failoverEventTypes(c))
+	events := c.Events()
+	assert.Equal(t, "health check failed 2 of 2 times", events[1].Message)
+	assert.Equal(t, 2, events[2].DropletID)
+	assert.Equal(t, "reserved IPs moved from droplet 1", events[2].Message)
+
+	// The standby now holds the addresses and passes its check.
+	require.NoError(t, c.Step(ctx))
+	assert.Len(t, c.Events(), 3)
+}
+
+func TestFailoverController_Skipped(t *testing.T) {
+	setup()
+	defer teardown()
+
+	api := setupFailoverAPI(t)
+
+	down := map[int]bool{1: true, 2: true}
+	cfg := &FailoverConfig{
+		ReservedIPv4:     "192.0.2.10",
+		PrimaryID:        1,
+		StandbyID:        2,
+		FailureThreshold: 1,
+		Probe: FailoverProbeFunc(func(ctx context.Context, d *Droplet) error {
+			if down[d.ID] {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+	}
+	c, err := NewFailoverController(client, cfg)
+	require.NoError(t, err)
+	require.NoError(t, c.Step(ctx))
+	assert.Equal(t, []FailoverEventType{FailoverEventProbeFailed, FailoverEventSkipped}, failoverEventTypes(c))
+	assert.Equal(t, "droplet to fail over to is unhealthy", c.Events()[1].Message)
+
+	down[2] = false
+	cfg.Leader = fakeLeader(false)
+	c, err = NewFailoverController(client, cfg)
+	require.NoError(t, err)
+	require.NoError(t, c.Step(ctx))
+	assert.Equal(t, []FailoverEventType{FailoverEventProbeFailed, FailoverEventSkipped}, failoverEventTypes(c))
+	assert.Equal(t, "not the leader", c.Events()[1].Message)
+	assert.Empty(t, api.assigns)
+}
+
+func TestFailoverController_PartialFailover(t *testing.T) {
+	setup()
+	defer teardown()
+
+	api := setupFailoverAPI(t)
+	api.failIPv6 = true
+
+	c, err := NewFailoverController(client, &FailoverConfig{
+		ReservedIPv4:       "192.0.2.10",
+		ReservedIPv6:       "2001:db8::10",
+		PrimaryID:          1,
+		StandbyID:          2,
+		FailureThreshold:   1,
+		ActionPollInterval: time.Millisecond,
+		Probe: FailoverProbeFunc(func(ctx context.Context, d *Droplet) error {
+			if d.ID == 1 {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+	})
+	require.NoError(t, err)
+
+	assert.EqualError(t, c.Step(ctx), "godo: action 2 (assign) errored")
+	assert.Equal(t, 2, api.ipv4)
+	assert.Equal(t, 1, api.ipv6)
+
+	// The healthy IPv4 holder gets the IPv6 address at the next check.
+	api.failIPv6 = false
+	require.NoError(t, c.Step(ctx))
+	assert.Equal(t, []string{"ipv4 2", "ipv6 2", "ipv6 2"}, api.assigns)
+	assert.Equal(t, 2, api.ipv6)
+	assert.Equal(t, []FailoverEventType{FailoverEventProbeFailed, FailoverEventError, FailoverEventRecovered, FailoverEventReconciled}, failoverEventTypes(c))
+	assert.Equal(t, "reserved IPv6 moved from droplet 1", c.Events()[3].Message)
+
+	require.NoError(t, c.Step(ctx))
+	assert.Len(t, api.assigns, 3)
+}
+
+func TestNewFailoverController_Invalid(t *testing.T) {
+	probe := FailoverProbeFunc(func(context.Context, *Droplet) error { return nil })
+
+	_, err := NewFailoverController(client, &FailoverConfig{PrimaryID: 1, StandbyID: 2, Probe: probe})
+	assert.EqualError(t, err, "cfg is invalid because at least one of ReservedIPv4 and ReservedIPv6 must be set")
+	_, err = NewFailoverController(client, &FailoverConfig{ReservedIPv4: "192.0.2.10", PrimaryID: 1, StandbyID: 1, Probe: probe})
+	assert.EqualError(t, err, "cfg is invalid because PrimaryID and StandbyID must be two droplets")
+	_, err = NewFailoverController(client, &FailoverConfig{ReservedIPv4: "192.0.2.10", PrimaryID: 1, StandbyID: 2})
+	assert.EqualError(t, err, "cfg.Probe is invalid because cannot be nil")
+}
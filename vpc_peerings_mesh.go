@@ -0,0 +1,341 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVPCPeeringMeshPrefix       = "mesh"
+	defaultVPCPeeringMeshWaitTimeout  = 5 * time.Minute
+	defaultVPCPeeringMeshPollInterval = 5 * time.Second
+
+	// VPCPeeringActive is the status of a peering that routes traffic.
+	VPCPeeringActive = "ACTIVE"
+)
+
+// VPCPeeringActionType is the kind of change a VPCPeeringAction makes.
+type VPCPeeringActionType string
+
+const (
+	// VPCPeeringCreate creates the peering of a pair that has none.
+	VPCPeeringCreate VPCPeeringActionType = "create"
+	// VPCPeeringRename gives the kept peering of a pair its mesh name.
+	VPCPeeringRename VPCPeeringActionType = "rename"
+	// VPCPeeringDelete deletes a duplicate peering, or one owned by the mesh
+	// that is no longer desired.
+	VPCPeeringDelete VPCPeeringActionType = "delete"
+)
+
+// VPCPeeringAction is a change to the peerings of a mesh. Name is the name
+// the peering has after the change, and Peering the existing peering that
+// is renamed or deleted.
+type VPCPeeringAction struct {
+	Type    VPCPeeringActionType
+	Name    string
+	VPCIDs  []string
+	Peering *VPCPeering
+}
+
+// VPCPeeringMeshOptions configures PlanVPCPeeringMesh and
+// ApplyVPCPeeringMesh.
+type VPCPeeringMeshOptions struct {
+	// Prefix starts the name of every peering of the mesh, which is
+	// "<prefix>-<vpc>-<vpc>" with the VPC names in order. Peerings with the
+	// prefix are owned by the mesh, and deleted when they peer a VPC of the
+	// mesh with one that is no longer in it. Meshes that share VPCs need
+	// distinct prefixes. Defaults to "mesh".
+	Prefix string
+	// WaitTimeout bounds the wait for created peerings to become active.
+	// Defaults to five minutes.
+	WaitTimeout time.Duration
+	// PollInterval is the delay between status polls. Defaults to five
+	// seconds.
+	PollInterval time.Duration
+}
+
+func (o *VPCPeeringMeshOptions) prefix() string {
+	if o == nil || o.Prefix == "" {
+		return defaultVPCPeeringMeshPrefix
+	}
+	return o.Prefix
+}
+
+// VPCPeeringMeshPlan is the set of changes that peers every pair of a set
+// of VPCs exactly once.
+type VPCPeeringMeshPlan struct {
+	VPCs    []*VPC
+	Actions []VPCPeeringAction
+}
+
+// HasChanges reports whether applying the plan changes anything.
+func (p *VPCPeeringMeshPlan) HasChanges() bool {
+	return len(p.Actions) > 0
+}
+
+// String describes the plan, one line per action.
+func (p *VPCPeeringMeshPlan) String() string {
+	if !p.HasChanges() {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	for _, a := range p.Actions {
+		switch a.Type {
+		case VPCPeeringCreate:
+			fmt.Fprintf(&b, "+ %s (%s)\n", a.Name, strings.Join(a.VPCIDs, ", "))
+		case VPCPeeringRename:
+			fmt.Fprintf(&b, "~ %s (%s)\n  was %s\n", a.Name, strings.Join(a.VPCIDs, ", "), a.Peering.Name)
+		case VPCPeeringDelete:
+			fmt.Fprintf(&b, "- %s (%s)\n", a.Name, strings.Join(a.VPCIDs, ", "))
+		}
+	}
+	return b.String()
+}
+
+// PlanVPCPeeringMesh compares the peerings of an account with a full mesh
+// between VPCs, given by ID or name, possibly in different regions. Each
+// pair keeps one existing peering, renamed to its deterministic name if
+// needed, or gets a new one; duplicate peerings of a pair and peerings
+// owned by the mesh between one of its VPCs and a VPC no longer in it are
+// deleted. Owned peerings between two other VPCs are left alone, as they
+// may belong to another mesh with the same prefix. An error is returned if
+// the ranges of two VPCs overlap, as they can't be peered.
+func PlanVPCPeeringMesh(ctx context.Context, client *Client, vpcs []string, opts *VPCPeeringMeshOptions) (*VPCPeeringMeshPlan, error) {
+	if len(vpcs) < 2 {
+		return nil, NewArgError("vpcs", "must name at least two VPCs")
+	}
+	all, err := collectPages(func(opt *ListOptions) ([]*VPC, *Response, error) {
+		return client.VPCs.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	members, err := resolveMeshVPCs(all, vpcs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMeshRanges(members); err != nil {
+		return nil, err
+	}
+
+	peerings, err := collectPages(func(opt *ListOptions) ([]*VPCPeering, *Response, error) {
+		return client.VPCs.ListVPCPeerings(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	byPair := make(map[string][]*VPCPeering)
+	for _, p := range peerings {
+		if len(p.VPCIDs) == 2 {
+			byPair[vpcPairKey(p.VPCIDs[0], p.VPCIDs[1])] = append(byPair[vpcPairKey(p.VPCIDs[0], p.VPCIDs[1])], p)
+		}
+	}
+
+	prefix := opts.prefix()
+	plan := &VPCPeeringMeshPlan{VPCs: members}
+	member := make(map[string]bool, len(members))
+	for _, v := range members {
+		member[v.ID] = true
+	}
+	desired := make(map[string]bool)
+	for i, a := range members {
+		for _, b := range members[i+1:] {
+			key := vpcPairKey(a.ID, b.ID)
+			desired[key] = true
+			name := vpcPeeringMeshName(prefix, a, b)
+			ids := []string{a.ID, b.ID}
+
+			existing := byPair[key]
+			if len(existing) == 0 {
+				plan.Actions = append(plan.Actions, VPCPeeringAction{Type: VPCPeeringCreate, Name: name, VPCIDs: ids})
+				continue
+			}
+			// Keep the peering that already has the name, or the oldest.
+			sort.SliceStable(existing, func(i, j int) bool {
+				if (existing[i].Name == name) != (existing[j].Name == name) {
+					return existing[i].Name == name
+				}
+				return existing[i].CreatedAt.Before(existing[j].CreatedAt)
+			})
+			if keep := existing[0]; keep.Name != name {
+				plan.Actions = append(plan.Actions, VPCPeeringAction{Type: VPCPeeringRename, Name: name, VPCIDs: ids, Peering: keep})
+			}
+			for _, dup := range existing[1:] {
+				plan.Actions = append(plan.Actions, VPCPeeringAction{Type: VPCPeeringDelete, Name: dup.Name, VPCIDs: dup.VPCIDs, Peering: dup})
+			}
+		}
+	}
+	for _, p := range peerings {
+		if len(p.VPCIDs) != 2 || !strings.HasPrefix(p.Name, prefix+"-") {
+			continue
+		}
+		a, b := p.VPCIDs[0], p.VPCIDs[1]
+		if !desired[vpcPairKey(a, b)] && (member[a] || member[b]) {
+			plan.Actions = append(plan.Actions, VPCPeeringAction{Type: VPCPeeringDelete, Name: p.Name, VPCIDs: p.VPCIDs, Peering: p})
+		}
+	}
+	sort.SliceStable(plan.Actions, func(i, j int) bool {
+		return vpcPeeringActionOrder(plan.Actions[i].Type) < vpcPeeringActionOrder(plan.Actions[j].Type)
+	})
+	return plan, nil
+}
+
+// ApplyVPCPeeringMesh applies a plan: peerings are deleted, renamed, then
+// created, and the created peerings are waited on until they are active.
+func ApplyVPCPeeringMesh(ctx context.Context, client *Client, plan *VPCPeeringMeshPlan, opts *VPCPeeringMeshOptions) error {
+	if plan == nil {
+		return NewArgError("plan", "cannot be nil")
+	}
+	var created []*VPCPeering
+	for _, a := range plan.Actions {
+		switch a.Type {
+		case VPCPeeringDelete:
+			if _, err := client.VPCs.DeleteVPCPeering(ctx, a.Peering.ID); err != nil {
+				return fmt.Errorf("godo: deleting VPC peering %s: %w", a.Name, err)
+			}
+		case VPCPeeringRename:
+			if _, _, err := client.VPCs.UpdateVPCPeering(ctx, a.Peering.ID, &VPCPeeringUpdateRequest{Name: a.Name}); err != nil {
+				return fmt.Errorf("godo: renaming VPC peering %s: %w", a.Peering.Name, err)
+			}
+		case VPCPeeringCreate:
+			p, _, err := client.VPCs.CreateVPCPeering(ctx, &VPCPeeringCreateRequest{Name: a.Name, VPCIDs: a.VPCIDs})
+			if err != nil {
+				return fmt.Errorf("godo: creating VPC peering %s: %w", a.Name, err)
+			}
+			created = append(created, p)
+		}
+	}
+	return waitForVPCPeerings(ctx, client, created, opts)
+}
+
+// EnsureVPCPeeringMesh plans and applies a full mesh of peerings between
+// VPCs. The applied plan is returned.
+func EnsureVPCPeeringMesh(ctx context.Context, client *Client, vpcs []string, opts *VPCPeeringMeshOptions) (*VPCPeeringMeshPlan, error) {
+	plan, err := PlanVPCPeeringMesh(ctx, client, vpcs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan, ApplyVPCPeeringMesh(ctx, client, plan, opts)
+}
+
+func waitForVPCPeerings(ctx context.Context, client *Client, peerings []*VPCPeering, opts *VPCPeeringMeshOptions) error {
+	timeout, interval := defaultVPCPeeringMeshWaitTimeout, defaultVPCPeeringMeshPollInterval
+	if opts != nil && opts.WaitTimeout > 0 {
+		timeout = opts.WaitTimeout
+	}
+	if opts != nil && opts.PollInterval > 0 {
+		interval = opts.PollInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pending := peerings
+	for {
+		var still []*VPCPeering
+		for _, p := range pending {
+			if p.Status == VPCPeeringActive {
+				continue
+			}
+			current, _, err := client.VPCs.GetVPCPeering(ctx, p.ID)
+			if err != nil {
+				return err
+			}
+			if current.Status != VPCPeeringActive {
+				still = append(still, current)
+			}
+		}
+		if pending = still; len(pending) == 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			names := make([]string, len(pending))
+			for i, p := range pending {
+				names[i] = fmt.Sprintf("%s (%s)", p.Name, p.Status)
+			}
+			return fmt.Errorf("godo: VPC peerings not active: %s: %w", strings.Join(names, ", "), err)
+		}
+	}
+}
+
+// resolveMeshVPCs finds VPCs by ID or name, sorted by name.
+func resolveMeshVPCs(all []*VPC, refs []string) ([]*VPC, error) {
+	seen := make(map[string]bool)
+	var members []*VPC
+	for _, ref := range refs {
+		var match *VPC
+		for _, v := range all {
+			if v.ID == ref {
+				match = v
+				break
+			}
+			if v.Name == ref {
+				if match != nil {
+					return nil, NewArgError("vpcs", fmt.Sprintf("more than one VPC is named %s", ref))
+				}
+				match = v
+			}
+		}
+		if match == nil {
+			return nil, NewArgError("vpcs", fmt.Sprintf("no VPC %s", ref))
+		}
+		if !seen[match.ID] {
+			seen[match.ID] = true
+			members = append(members, match)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Name != members[j].Name {
+			return members[i].Name < members[j].Name
+		}
+		return members[i].ID < members[j].ID
+	})
+	return members, nil
+}
+
+func checkMeshRanges(vpcs []*VPC) error {
+	prefixes := make([]netip.Prefix, len(vpcs))
+	for i, v := range vpcs {
+		p, err := netip.ParsePrefix(v.IPRange)
+		if err != nil {
+			return fmt.Errorf("godo: VPC %s has invalid range %q", v.Name, v.IPRange)
+		}
+		prefixes[i] = p
+	}
+	var overlaps []string
+	for i := range vpcs {
+		for j := i + 1; j < len(vpcs); j++ {
+			if prefixes[i].Overlaps(prefixes[j]) {
+				overlaps = append(overlaps, fmt.Sprintf("%s (%s) and %s (%s)", vpcs[i].Name, vpcs[i].IPRange, vpcs[j].Name, vpcs[j].IPRange))
+			}
+		}
+	}
+	if len(overlaps) > 0 {
+		return fmt.Errorf("godo: VPCs with overlapping ranges can't be peered: %s", strings.Join(overlaps, "; "))
+	}
+	return nil
+}
+
+func vpcPairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + " " + b
+}
+
+func vpcPeeringMeshName(prefix string, a, b *VPC) string {
+	return fmt.Sprintf("%s-%s-%s", prefix, a.Name, b.Name)
+}
+
+func vpcPeeringActionOrder(t VPCPeeringActionType) int {
+	switch t {
+	case VPCPeeringDelete:
+		return 0
+	case VPCPeeringRename:
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,103 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVPCPeeringMesh(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/vpcs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"vpcs": [
+			{"id": "vpc-a", "name": "ams", "region": "ams3", "ip_range": "10.1.0.0/16"},
+			{"id": "vpc-b", "name": "nyc", "region": "nyc1", "ip_range": "10.2.0.0/16"},
+			{"id": "vpc-c", "name": "sfo", "region": "sfo3", "ip_range": "10.3.0.0/16"},
+			{"id": "vpc-d", "name": "old", "region": "lon1", "ip_range": "10.4.0.0/16"},
+			{"id": "vpc-e", "name": "fra", "region": "fra1", "ip_range": "10.5.0.0/16"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/vpc_peerings", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"vpc_peerings": [
+				{"id": "p1", "name": "mesh-ams-nyc", "vpc_ids": ["vpc-b", "vpc-a"], "status": "ACTIVE", "created_at": "2026-01-02T00:00:00Z"},
+				{"id": "p2", "name": "ams-to-nyc", "vpc_ids": ["vpc-a", "vpc-b"], "status": "ACTIVE", "created_at": "2026-01-01T00:00:00Z"},
+				{"id": "p3", "name": "manual", "vpc_ids": ["vpc-a", "vpc-c"], "status": "ACTIVE", "created_at": "2026-01-01T00:00:00Z"},
+				{"id": "p4", "name": "mesh-ams-old", "vpc_ids": ["vpc-a", "vpc-d"], "status": "ACTIVE", "created_at": "2026-01-01T00:00:00Z"},
+				{"id": "p5", "name": "other", "vpc_ids": ["vpc-b", "vpc-d"], "status": "ACTIVE", "created_at": "2026-01-01T00:00:00Z"},
+				{"id": "p7", "name": "mesh-fra-old", "vpc_ids": ["vpc-e", "vpc-d"], "status": "ACTIVE", "created_at": "2026-01-01T00:00:00Z"}
+			]}`)
+			return
+		}
+		var req VPCPeeringCreateRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "mesh-nyc-sfo", req.Name)
+		assert.Equal(t, []string{"vpc-b", "vpc-c"}, req.VPCIDs)
+		fmt.Fprint(w, `{"vpc_peering": {"id": "p6", "name": "mesh-nyc-sfo", "status": "PROVISIONING"}}`)
+	})
+	var calls []string
+	polls := 0
+	mux.HandleFunc("/v2/vpc_peerings/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v2/vpc_peerings/")
+		if r.Method == http.MethodGet {
+			polls++
+			status := "PROVISIONING"
+			if polls > 2 {
+				status = "ACTIVE"
+			}
+			fmt.Fprintf(w, `{"vpc_peering": {"id": %q, "name": "mesh-nyc-sfo", "status": %q}}`, id, status)
+			return
+		}
+		call := r.Method + " " + id
+		if r.Method == http.MethodPatch {
+			var req VPCPeeringUpdateRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			call += " " + req.Name
+		}
+		calls = append(calls, call)
+		fmt.Fprintf(w, `{"vpc_peering": {"id": %q}}`, id)
+	})
+
+	plan, err := PlanVPCPeeringMesh(ctx, client, []string{"nyc", "vpc-a", "sfo"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `- ams-to-nyc (vpc-a, vpc-b)
+- mesh-ams-old (vpc-a, vpc-d)
+~ mesh-ams-sfo (vpc-a, vpc-c)
+  was manual
++ mesh-nyc-sfo (vpc-b, vpc-c)
+`, plan.String())
+
+	opts := &VPCPeeringMeshOptions{PollInterval: time.Millisecond}
+	require.NoError(t, ApplyVPCPeeringMesh(ctx, client, plan, opts))
+	assert.Equal(t, []string{"DELETE p2", "DELETE p4", "PATCH p3 mesh-ams-sfo"}, calls)
+	assert.Equal(t, 3, polls)
+}
+
+func TestPlanVPCPeeringMesh_Invalid(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/vpcs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"vpcs": [
+			{"id": "vpc-a", "name": "ams", "ip_range": "10.1.0.0/16"},
+			{"id": "vpc-b", "name": "nyc", "ip_range": "10.1.128.0/20"},
+			{"id": "vpc-c", "name": "dup", "ip_range": "10.3.0.0/16"},
+			{"id": "vpc-d", "name": "dup", "ip_range": "10.4.0.0/16"}
+		]}`)
+	})
+
+	_, err := PlanVPCPeeringMesh(ctx, client, []string{"ams", "nyc"}, nil)
+	assert.EqualError(t, err, "godo: VPCs with overlapping ranges can't be peered: ams (10.1.0.0/16) and nyc (10.1.128.0/20)")
+	_, err = PlanVPCPeeringMesh(ctx, client, []string{"ams", "dup"}, nil)
+	assert.EqualError(t, err, "vpcs is invalid because more than one VPC is named dup")
+	_, err = PlanVPCPeeringMesh(ctx, client, []string{"ams"}, nil)
+	assert.EqualError(t, err, "vpcs is invalid because must name at least two VPCs")
+}
@@ -0,0 +1,244 @@
+package godo
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Kinds of an IPAllocation.
+const (
+	IPAllocationVPC                     = "vpc"
+	IPAllocationKubernetesClusterSubnet = "kubernetes_cluster_subnet"
+	IPAllocationKubernetesServiceSubnet = "kubernetes_service_subnet"
+	IPAllocationPartnerAttachmentRoute  = "partner_attachment_route"
+	IPAllocationVPCNATGateway           = "vpc_nat_gateway"
+	IPAllocationReserved                = "reserved"
+)
+
+// IPAllocation is an address range in use by a resource.
+type IPAllocation struct {
+	Kind   string
+	Prefix netip.Prefix
+	// ID and Name identify the resource, and VPCID the VPC it belongs to,
+	// if any.
+	ID     string
+	Name   string
+	Region string
+	VPCID  string
+}
+
+func (a IPAllocation) String() string {
+	if a.Name != "" {
+		return fmt.Sprintf("%s %s (%s)", a.Kind, a.Name, a.Prefix)
+	}
+	return fmt.Sprintf("%s %s (%s)", a.Kind, a.ID, a.Prefix)
+}
+
+// IPConflict is a pair of overlapping allocations.
+type IPConflict struct {
+	A, B IPAllocation
+}
+
+func (c IPConflict) String() string {
+	return fmt.Sprintf("%s overlaps %s", c.A, c.B)
+}
+
+// IPAddressPlan is the set of address ranges in use in an account, used to
+// find overlapping ranges and to pick free ones for new VPCs, VPC peerings,
+// partner attachments and Kubernetes clusters.
+type IPAddressPlan struct {
+	Allocations []IPAllocation
+}
+
+// GatherIPAddressPlan collects the address ranges of the VPCs, the cluster
+// and service subnets of the Kubernetes clusters, the remote routes of the
+// partner attachments and the gateway addresses of the VPC NAT gateways.
+// The local routes of a partner attachment are the ranges of its VPCs.
+func GatherIPAddressPlan(ctx context.Context, client *Client) (*IPAddressPlan, error) {
+	plan := &IPAddressPlan{}
+
+	vpcs, err := collectPages(func(opt *ListOptions) ([]*VPC, *Response, error) {
+		return client.VPCs.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vpcs {
+		plan.add(IPAllocation{Kind: IPAllocationVPC, ID: v.ID, Name: v.Name, Region: v.RegionSlug, VPCID: v.ID}, v.IPRange)
+	}
+
+	clusters, err := collectPages(func(opt *ListOptions) ([]*KubernetesCluster, *Response, error) {
+		return client.Kubernetes.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clusters {
+		a := IPAllocation{ID: c.ID, Name: c.Name, Region: c.RegionSlug, VPCID: c.VPCUUID}
+		a.Kind = IPAllocationKubernetesClusterSubnet
+		plan.add(a, c.ClusterSubnet)
+		a.Kind = IPAllocationKubernetesServiceSubnet
+		plan.add(a, c.ServiceSubnet)
+	}
+
+	attachments, err := collectPages(func(opt *ListOptions) ([]*PartnerAttachment, *Response, error) {
+		return client.PartnerAttachment.List(ctx, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pa := range attachments {
+		routes, err := collectPages(func(opt *ListOptions) ([]*RemoteRoute, *Response, error) {
+			return client.PartnerAttachment.ListRoutes(ctx, pa.ID, opt)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("godo: listing routes of partner attachment %s: %w", pa.ID, err)
+		}
+		for _, r := range routes {
+			plan.add(IPAllocation{Kind: IPAllocationPartnerAttachmentRoute, ID: pa.ID, Name: pa.Name, Region: pa.Region}, r.Cidr)
+		}
+	}
+
+	gateways, err := collectPages(func(opt *ListOptions) ([]*VPCNATGateway, *Response, error) {
+		return client.VPCNATGateways.List(ctx, &VPCNATGatewaysListOptions{ListOptions: *opt})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gateways {
+		for _, v := range g.VPCs {
+			plan.add(IPAllocation{Kind: IPAllocationVPCNATGateway, ID: g.ID, Name: g.Name, Region: g.Region, VPCID: v.VpcUUID}, v.GatewayIP)
+		}
+	}
+	return plan, nil
+}
+
+// add records an allocation, skipping empty and invalid ranges. Addresses
+// are recorded as single-address prefixes.
+func (p *IPAddressPlan) add(a IPAllocation, cidr string) {
+	if cidr == "" {
+		return
+	}
+	prefix, err := parseFirewallPrefix(cidr)
+	if err != nil {
+		return
+	}
+	a.Prefix = prefix
+	p.Allocations = append(p.Allocations, a)
+}
+
+// Reserve records a range that must not be used, such as one used outside
+// of DigitalOcean.
+func (p *IPAddressPlan) Reserve(cidr, name string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return NewArgError("cidr", err.Error())
+	}
+	p.Allocations = append(p.Allocations, IPAllocation{Kind: IPAllocationReserved, Name: name, Prefix: prefix.Masked()})
+	return nil
+}
+
+// Conflicts returns the pairs of overlapping allocations. The cluster and
+// service subnets of a Kubernetes cluster must not overlap any range,
+// including the one of their VPC, but a NAT gateway's address is expected
+// to lie in the range of its VPC.
+func (p *IPAddressPlan) Conflicts() []IPConflict {
+	var conflicts []IPConflict
+	for i, a := range p.Allocations {
+		for _, b := range p.Allocations[i+1:] {
+			if a.Prefix.Overlaps(b.Prefix) && !ipAllocationNested(a, b) && !ipAllocationNested(b, a) {
+				conflicts = append(conflicts, IPConflict{A: a, B: b})
+			}
+		}
+	}
+	return conflicts
+}
+
+// ipAllocationNested reports whether inner is expected to lie within outer.
+func ipAllocationNested(outer, inner IPAllocation) bool {
+	return outer.Kind == IPAllocationVPC && inner.Kind == IPAllocationVPCNATGateway && inner.VPCID == outer.ID
+}
+
+// Overlapping returns the allocations a range overlaps.
+func (p *IPAddressPlan) Overlapping(cidr string) ([]IPAllocation, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, NewArgError("cidr", err.Error())
+	}
+	var overlapping []IPAllocation
+	for _, a := range p.Allocations {
+		if a.Prefix.Overlaps(prefix) {
+			overlapping = append(overlapping, a)
+		}
+	}
+	return overlapping, nil
+}
+
+// NextFree returns the first range with a prefix length of bits within an
+// IPv4 supernet that overlaps no allocation, such as the IPRange of a
+// VPCCreateRequest or the ClusterSubnet of a KubernetesClusterCreateRequest.
+func (p *IPAddressPlan) NextFree(supernet string, bits int) (string, error) {
+	super, err := netip.ParsePrefix(supernet)
+	if err != nil {
+		return "", NewArgError("supernet", err.Error())
+	}
+	super = super.Masked()
+	if !super.Addr().Is4() {
+		return "", NewArgError("supernet", "must be an IPv4 range")
+	}
+	if bits < super.Bits() || bits > 32 {
+		return "", NewArgError("bits", fmt.Sprintf("must be between %d and 32", super.Bits()))
+	}
+
+	type span struct{ lo, hi uint64 }
+	var used []span
+	for _, a := range p.Allocations {
+		if a.Prefix.Addr().Is4() && a.Prefix.Overlaps(super) {
+			lo := uint64(ipv4ToUint32(a.Prefix.Addr()))
+			used = append(used, span{lo, lo + 1<<(32-a.Prefix.Bits()) - 1})
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].lo < used[j].lo })
+
+	size := uint64(1) << (32 - bits)
+	end := uint64(ipv4ToUint32(super.Addr())) + 1<<(32-super.Bits())
+	candidate := uint64(ipv4ToUint32(super.Addr()))
+	for _, u := range used {
+		if candidate+size-1 < u.lo {
+			break
+		}
+		if u.hi >= candidate {
+			// Skip past the allocation to the next aligned range.
+			candidate = (u.hi/size + 1) * size
+		}
+	}
+	if candidate+size > end {
+		return "", fmt.Errorf("godo: no free /%d range in %s", bits, super)
+	}
+	return netip.PrefixFrom(uint32ToIPv4(uint32(candidate)), bits).String(), nil
+}
+
+// Allocate returns the next free range like NextFree and reserves it, so
+// that several ranges can be planned at once, such as the cluster and
+// service subnets of a Kubernetes cluster.
+func (p *IPAddressPlan) Allocate(supernet string, bits int, name string) (string, error) {
+	cidr, err := p.NextFree(supernet, bits)
+	if err != nil {
+		return "", err
+	}
+	return cidr, p.Reserve(cidr, name)
+}
+
+func ipv4ToUint32(a netip.Addr) uint32 {
+	b := a.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToIPv4(v uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return netip.AddrFrom4(b)
+}
@@ -0,0 +1,82 @@
+package godo
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherIPAddressPlan(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/vpcs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"vpcs": [
+			{"id": "vpc-1", "name": "prod", "region": "nyc1", "ip_range": "10.10.0.0/16"},
+			{"id": "vpc-2", "name": "staging", "region": "nyc1", "ip_range": "10.20.0.0/20"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_clusters": [
+			{"id": "k8s-1", "name": "apps", "region": "nyc1", "vpc_uuid": "vpc-1", "cluster_subnet": "10.100.0.0/16", "service_subnet": "10.20.8.0/22"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/partner_network_connect/attachments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"partner_attachments": [{"id": "pa-1", "name": "dc", "vpc_ids": ["vpc-1"]}]}`)
+	})
+	mux.HandleFunc("/v2/partner_network_connect/attachments/pa-1/remote_routes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"remote_routes": [{"cidr": "192.168.0.0/16"}, {"cidr": "10.10.128.0/17"}]}`)
+	})
+	mux.HandleFunc("/v2/vpc_nat_gateways", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"vpc_nat_gateways": [{"id": "nat-1", "name": "egress", "vpcs": [{"vpc_uuid": "vpc-1", "gateway_ip": "10.10.0.5"}]}]}`)
+	})
+
+	plan, err := GatherIPAddressPlan(ctx, client)
+	require.NoError(t, err)
+	assert.Len(t, plan.Allocations, 7)
+
+	var conflicts []string
+	for _, c := range plan.Conflicts() {
+		conflicts = append(conflicts, c.String())
+	}
+	assert.Equal(t, []string{
+		"vpc prod (10.10.0.0/16) overlaps partner_attachment_route dc (10.10.128.0/17)",
+		"vpc staging (10.20.0.0/20) overlaps kubernetes_service_subnet apps (10.20.8.0/22)",
+	}, conflicts)
+
+	overlapping, err := plan.Overlapping("10.0.0.0/8")
+	require.NoError(t, err)
+	assert.Len(t, overlapping, 6)
+
+	cidr, err := plan.NextFree("10.0.0.0/8", 16)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/16", cidr)
+	cidr, err = plan.NextFree("10.10.0.0/15", 16)
+	require.NoError(t, err)
+	assert.Equal(t, "10.11.0.0/16", cidr)
+	_, err = plan.NextFree("10.10.0.0/16", 24)
+	assert.EqualError(t, err, "godo: no free /24 range in 10.10.0.0/16")
+}
+
+func TestIPAddressPlan_Allocate(t *testing.T) {
+	plan := &IPAddressPlan{}
+	require.NoError(t, plan.Reserve("172.16.0.0/24", "office"))
+	require.NoError(t, plan.Reserve("172.16.2.0/23", "datacenter"))
+
+	var got []string
+	for _, bits := range []int{24, 24, 22, 25} {
+		cidr, err := plan.Allocate("172.16.0.0/16", bits, "new")
+		require.NoError(t, err)
+		got = append(got, cidr)
+	}
+	assert.Equal(t, []string{"172.16.1.0/24", "172.16.4.0/24", "172.16.8.0/22", "172.16.5.0/25"}, got)
+	assert.Empty(t, plan.Conflicts())
+
+	_, err := plan.NextFree("172.16.0.0/16", 8)
+	assert.EqualError(t, err, "bits is invalid because must be between 16 and 32")
+	_, err = plan.NextFree("fd00::/8", 16)
+	assert.EqualError(t, err, "supernet is invalid because must be an IPv4 range")
+}
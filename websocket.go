@@ -0,0 +1,289 @@
+package godo
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// This file implements the subset of the WebSocket protocol (RFC 6455) needed
+// to consume the App Platform log and console endpoints. The handshake is
+// performed through the Client's HTTP client, so that its transport,
+// authentication and proxies apply to websocket connections as well.
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsCloseNormal     = 1000
+	wsCloseNoStatus   = 1005
+	wsMaxControlFrame = 125
+
+	// wsMaxMessageSize bounds the size of a single (possibly fragmented)
+	// message to protect against misbehaving servers.
+	wsMaxMessageSize = 32 << 20
+
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// errNotWebsocket is returned by dialWebsocket when the server answered the
+// upgrade request with a regular HTTP response.
+var errNotWebsocket = errors.New("godo: server did not upgrade to websocket")
+
+// wsCloseError is returned by wsConn.readMessage when the peer closes the
+// connection.
+type wsCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *wsCloseError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Text)
+	}
+	return fmt.Sprintf("websocket closed: %d", e.Code)
+}
+
+// wsConn is a websocket connection. Reads must not be called concurrently;
+// writes are serialized internally.
+type wsConn struct {
+	rw     io.ReadWriteCloser
+	br     *bufio.Reader
+	client bool
+
+	wmu       sync.Mutex
+	closeOnce sync.Once
+}
+
+func newWSConn(rw io.ReadWriteCloser, br *bufio.Reader, client bool) *wsConn {
+	if br == nil {
+		br = bufio.NewReader(rw)
+	}
+	return &wsConn{rw: rw, br: br, client: client}
+}
+
+// dialWebsocket sends req as a websocket upgrade request using httpClient.
+// ws and wss URLs are sent as http and https respectively. When the server
+// answers with anything other than 101 Switching Protocols, the response is
+// returned with its body open along with errNotWebsocket, so that callers can
+// fall back to plain HTTP streaming.
+func dialWebsocket(ctx context.Context, httpClient *http.Client, req *http.Request) (*wsConn, *http.Response, error) {
+	switch req.URL.Scheme {
+	case "ws":
+		req.URL.Scheme = "http"
+	case "wss":
+		req.URL.Scheme = "https"
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, keyBytes); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := DoRequestWithClient(ctx, httpClient, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp, errNotWebsocket
+	}
+
+	rw, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, resp, errors.New("godo: websocket response body is not writable")
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		rw.Close()
+		return nil, resp, errors.New("godo: invalid websocket handshake response")
+	}
+
+	return newWSConn(rw, nil, true), resp, nil
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// readMessage returns the next data message, reassembling fragmented
+// messages and answering pings. A close frame from the peer is answered and
+// returned as a *wsCloseError.
+func (c *wsConn) readMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err == io.EOF {
+			// The connection was dropped without a close frame.
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			closeErr := &wsCloseError{Code: wsCloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Text = string(payload[2:])
+			}
+			_ = c.writeFrame(wsOpClose, payload[:min(len(payload), 2)])
+			c.rw.Close()
+			return 0, nil, closeErr
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, errors.New("godo: unexpected websocket continuation frame")
+			}
+		default:
+			if opcode != 0 {
+				return 0, nil, errors.New("godo: interleaved websocket data frames")
+			}
+			opcode = op
+		}
+
+		if len(message)+len(payload) > wsMaxMessageSize {
+			return 0, nil, errors.New("godo: websocket message too large")
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	op := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, errors.New("godo: websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// writeMessage sends data as a single unfragmented message.
+func (c *wsConn) writeMessage(opcode int, data []byte) error {
+	return c.writeFrame(opcode, data)
+}
+
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode))
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= wsMaxControlFrame:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.client {
+		// Clients must mask every frame they send.
+		var mask [4]byte
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.rw.Write(frame)
+	return err
+}
+
+// close sends a normal closure frame and closes the underlying connection.
+func (c *wsConn) close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		_ = c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+		err = c.rw.Close()
+	})
+	return err
+}
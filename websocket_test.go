@@ -0,0 +1,84 @@
+package godo
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upgradeTestWebsocket completes a websocket handshake on the server side of
+// a test HTTP handler and returns the server end of the connection.
+func upgradeTestWebsocket(t *testing.T, w http.ResponseWriter, r *http.Request) *wsConn {
+	t.Helper()
+
+	require.Equal(t, "websocket", r.Header.Get("Upgrade"))
+	key := r.Header.Get("Sec-WebSocket-Key")
+	require.NotEmpty(t, key)
+
+	hj, ok := w.(http.Hijacker)
+	require.True(t, ok, "response writer does not support hijacking")
+	conn, brw, err := hj.Hijack()
+	require.NoError(t, err)
+
+	_, err = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	require.NoError(t, err)
+	require.NoError(t, brw.Flush())
+
+	return newWSConn(conn, brw.Reader, false)
+}
+
+func TestWebsocket_RoundTrip(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn := upgradeTestWebsocket(t, w, r)
+		for {
+			op, msg, err := conn.readMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.writeMessage(op, append([]byte("echo "), msg...)); err != nil {
+				return
+			}
+		}
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "ws"+server.URL[len("http"):]+"/ws", nil)
+	require.NoError(t, err)
+	conn, _, err := dialWebsocket(context.Background(), http.DefaultClient, req)
+	require.NoError(t, err)
+	defer conn.close()
+
+	large := make([]byte, 70000)
+	for _, payload := range [][]byte{[]byte("hello"), large} {
+		require.NoError(t, conn.writeMessage(wsOpBinary, payload))
+		op, msg, err := conn.readMessage()
+		require.NoError(t, err)
+		assert.Equal(t, wsOpBinary, op)
+		assert.Equal(t, append([]byte("echo "), payload...), msg)
+	}
+}
+
+func TestWebsocket_NotUpgraded(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	})
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/plain", nil)
+	require.NoError(t, err)
+	_, resp, err := dialWebsocket(context.Background(), http.DefaultClient, req)
+	require.ErrorIs(t, err, errNotWebsocket)
+	require.NotNil(t, resp)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}